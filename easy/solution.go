@@ -3,6 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/EmirShimshir/buffered-reader-writer/internal/terminalcookie"
 )
 
 var (
@@ -16,7 +20,7 @@ type Producer interface {
 	// Next возвращает:
 	// - пакет элементов для обработки
 	// - cookie для подтверждения после обработки
-	// - ошибку
+	// - ошибку; ErrEofCommitCookie или io.EOF означают конец данных
 	Next() (items []any, cookie int, err error)
 
 	// Commit подтверждает обработку пакета данных
@@ -34,7 +38,35 @@ func Pipe(p Producer, c Consumer, maxItems int) error {
 
 	for {
 		items, cookie, err := p.Next()
-		if errors.Is(err, ErrEofCommitCookie) {
+		eof := isEOF(err)
+		if err != nil && !eof {
+			return fmt.Errorf("%w: %v", ErrNextFailed, err)
+		}
+
+		// Источник может отдать последние элементы вместе с EOF
+		if !eof || len(items) > 0 {
+			// Проверяем, помещаются ли новые данные в буфер
+			if len(buf)+len(items) > maxItems {
+				// Буфер переполнен, обрабатываем текущие данные
+				if err := c.Process(buf); err != nil {
+					return fmt.Errorf("%w: %v", ErrProcessFailed, err)
+				}
+				for _, cookie := range cookies {
+					if err := p.Commit(cookie); err != nil {
+						return fmt.Errorf("%w: %v", ErrCommitFailed, err)
+					}
+				}
+				// Сбрасываем буферы
+				buf = make([]any, 0, maxItems)
+				cookies = []int{}
+			}
+
+			// Добавляем новые данные в буфер
+			buf = append(buf, items...)
+			cookies = append(cookies, cookie)
+		}
+
+		if eof {
 			// Обрабатываем оставшиеся данные в буфере
 			if len(buf) > 0 {
 				if err := c.Process(buf); err != nil {
@@ -48,28 +80,63 @@ func Pipe(p Producer, c Consumer, maxItems int) error {
 			}
 			return nil
 		}
-		if err != nil {
-			return fmt.Errorf("%w: %v", ErrNextFailed, err)
-		}
+	}
+}
 
-		// Проверяем, помещаются ли новые данные в буфер
-		if len(buf)+len(items) > maxItems {
-			// Буфер переполнен, обрабатываем текущие данные
-			if err := c.Process(buf); err != nil {
-				return fmt.Errorf("%w: %v", ErrProcessFailed, err)
-			}
-			for _, cookie := range cookies {
-				if err := p.Commit(cookie); err != nil {
-					return fmt.Errorf("%w: %v", ErrCommitFailed, err)
-				}
-			}
-			// Сбрасываем буферы
-			buf = make([]any, 0, maxItems)
-			cookies = []int{}
-		}
+// DefaultTerminalCookie — классификация терминальных cookie по умолчанию:
+// конец потока обозначает cookie == -1
+func DefaultTerminalCookie(cookie int) bool {
+	return terminalcookie.Default(cookie)
+}
+
+// PipeTerminal работает как Pipe, но кроме ErrEofCommitCookie завершает
+// поток и по терминальному cookie, для которого terminal возвращает true
+// (по умолчанию DefaultTerminalCookie). Так источник может различать
+// причины окончания, например -1 — штатный конец, -2 — усечённые данные.
+// Накопленный буфер в обоих случаях обрабатывается и фиксируется. Элементы
+// терминального результата, как и элементы вместе с ErrEofCommitCookie,
+// обрабатываются последним батчем, а сам терминальный cookie не
+// фиксируется. Возвращается терминальный cookie, завершивший поток, или -1,
+// если источник вернул ErrEofCommitCookie.
+func PipeTerminal(p Producer, c Consumer, maxItems int, terminal func(cookie int) bool) (int, error) {
+	tp := terminalcookie.New(p, terminal, ErrEofCommitCookie)
+	if err := Pipe(tp, c, maxItems); err != nil {
+		return 0, err
+	}
+	return tp.End(), nil
+}
 
-		// Добавляем новые данные в буфер
-		buf = append(buf, items...)
-		cookies = append(cookies, cookie)
+// PipeYield работает как Pipe, но каждые every вызовов Next уступает
+// процессор через yield (по умолчанию runtime.Gosched), чтобы длинный
+// синхронный цикл не монополизировал поток планировщика.
+// every <= 0 отключает уступку.
+func PipeYield(p Producer, c Consumer, maxItems int, every int, yield func()) error {
+	if every <= 0 {
+		return Pipe(p, c, maxItems)
 	}
+	if yield == nil {
+		yield = runtime.Gosched
+	}
+	return Pipe(&yieldingProducer{Producer: p, every: every, yield: yield}, c, maxItems)
+}
+
+// yieldingProducer вызывает yield после каждых every вызовов Next
+type yieldingProducer struct {
+	Producer
+	every int
+	yield func()
+	calls int
+}
+
+func (p *yieldingProducer) Next() ([]any, int, error) {
+	p.calls++
+	if p.calls%p.every == 0 {
+		p.yield()
+	}
+	return p.Producer.Next()
+}
+
+// isEOF — конец данных по контракту Next
+func isEOF(err error) bool {
+	return errors.Is(err, ErrEofCommitCookie) || errors.Is(err, io.EOF)
 }
@@ -2,8 +2,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"testing"
 
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -313,3 +317,151 @@ func TestPipe_NoDataButWithCookieMinusOne(t *testing.T) {
 	producer.AssertExpectations(t)
 	consumer.AssertExpectations(t)
 }
+
+func TestPipe_MemoryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for maxItems := 1; maxItems <= 20; maxItems++ {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			source := pipetest.NewRandomMemorySource(ErrEofCommitCookie, rng, 100, maxItems)
+			sink := &pipetest.MemorySink{}
+
+			err := Pipe(source, sink, maxItems)
+			require.NoError(t, err)
+			pipetest.AssertRoundTrip(t, source, sink, maxItems)
+		})
+	}
+}
+
+func TestPipe_IOEOFFlushesBuffer(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Источник поверх io.Reader сообщает о конце данных через io.EOF
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, io.EOF).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItems(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок данных приходит вместе с EOF
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItemsOverflow(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок не помещается в буфер и уходит отдельным батчем
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 2)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeTerminal_CustomClassification(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Любой отрицательный cookie терминальный: -2 — данные усечены
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	// элементы терминального результата обрабатываются, как вместе с EOF
+	producer.On("Next").Return([]any{"tail"}, -2, nil).Once()
+	consumer.On("Process", []any{"item1", "item2", "tail"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	end, err := PipeTerminal(producer, consumer, 10, func(cookie int) bool { return cookie < 0 })
+	require.NoError(t, err)
+	require.Equal(t, -2, end)
+
+	producer.AssertExpectations(t)
+	producer.AssertNotCalled(t, "Commit", -2)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeTerminal_Default(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, -1, nil).Once()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+
+	end, err := PipeTerminal(producer, consumer, 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, -1, end)
+
+	// -2 по умолчанию не терминальный
+	require.False(t, DefaultTerminalCookie(-2))
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeTerminal_EOFError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	end, err := PipeTerminal(producer, consumer, 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, -1, end)
+}
+
+func TestPipeYield_Cadence(t *testing.T) {
+	steps := make([]int, 10)
+	for i := range steps {
+		steps[i] = 1
+	}
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 10), steps...)
+	sink := &pipetest.MemorySink{}
+
+	// 10 результатов и финальный eof — 11 вызовов Next
+	yields := 0
+	err := PipeYield(source, sink, 3, 3, func() { yields++ })
+	require.NoError(t, err)
+	require.Equal(t, 3, yields)
+	pipetest.AssertRoundTrip(t, source, sink, 3)
+}
+
+func TestPipeYield_DefaultGosched(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	sink := &pipetest.MemorySink{}
+
+	err := PipeYield(source, sink, 2, 1, nil)
+	require.NoError(t, err)
+	pipetest.AssertRoundTrip(t, source, sink, 2)
+}
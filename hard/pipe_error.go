@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// PipeError — ошибка Pipe с машиночитаемыми подробностями для агрегаторов
+// логов. Error() совпадает с текстом исходной ошибки, а Unwrap возвращает её
+// саму, поэтому errors.Is с ErrProcessFailed и другими сигнальными ошибками
+// работает как прежде.
+type PipeError struct {
+	// Stage — стадия первой ошибки: next, process, commit или pipeline,
+	// если причина не относится к конкретной стадии (например, отмена)
+	Stage string
+	// Sentinel — сигнальная ошибка стадии или nil
+	Sentinel error
+	// Message — текст первопричины без префикса стадии
+	Message string
+	// LastCommitted — последний успешно зафиксированный cookie;
+	// имеет смысл, только если HasCommitted
+	LastCommitted int
+	HasCommitted  bool
+	// UncommittedCookies — cookie, переданные в Process, чей Commit так и не
+	// завершился успешно, в порядке их выдачи источником
+	UncommittedCookies []int
+
+	err error
+}
+
+func (e *PipeError) Error() string { return e.err.Error() }
+
+func (e *PipeError) Unwrap() error { return e.err }
+
+// pipeErrorJSON — JSON-представление PipeError
+type pipeErrorJSON struct {
+	Stage         string `json:"stage"`
+	Sentinel      string `json:"sentinel,omitempty"`
+	Message       string `json:"message"`
+	LastCommitted *int   `json:"last_committed_cookie"`
+	Uncommitted   []int  `json:"uncommitted_cookies,omitempty"`
+	Error         string `json:"error"`
+}
+
+func (e *PipeError) MarshalJSON() ([]byte, error) {
+	out := pipeErrorJSON{Stage: e.Stage, Message: e.Message, Uncommitted: e.UncommittedCookies, Error: e.Error()}
+	if e.Sentinel != nil {
+		out.Sentinel = e.Sentinel.Error()
+	}
+	if e.HasCommitted {
+		last := e.LastCommitted
+		out.LastCommitted = &last
+	}
+	return json.Marshal(out)
+}
+
+// stageSentinels — сигнальные ошибки стадий в порядке проверки
+var stageSentinels = []struct {
+	stage string
+	err   error
+}{
+	{"next", ErrNextFailed},
+	{"process", ErrProcessFailed},
+	{"commit", ErrCommitFailed},
+}
+
+// newPipeError оборачивает итоговую ошибку Pipe, описывая первую из
+// объединённых ошибок
+func newPipeError(err error, last lastCommit, uncommitted []int) error {
+	if err == nil {
+		return nil
+	}
+	pe := &PipeError{
+		Stage:              "pipeline",
+		LastCommitted:      last.cookie,
+		HasCommitted:       last.ok,
+		UncommittedCookies: uncommitted,
+		err:                err,
+	}
+	first := firstError(err)
+	pe.Message = first.Error()
+	for _, s := range stageSentinels {
+		if errors.Is(first, s.err) {
+			pe.Stage, pe.Sentinel = s.stage, s.err
+			pe.Message = strings.TrimPrefix(pe.Message, s.err.Error()+": ")
+			break
+		}
+	}
+	return pe
+}
+
+// firstError спускается по errors.Join к первой ошибке. Ошибка стадии вида
+// "%w: %w" тоже раскрывается в список, но её первый элемент — сигнальная
+// ошибка, и на ней спуск останавливается.
+func firstError(err error) error {
+	for {
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			return err
+		}
+		errs := joined.Unwrap()
+		if len(errs) == 0 || isStageSentinel(errs[0]) {
+			return err
+		}
+		err = errs[0]
+	}
+}
+
+func isStageSentinel(err error) bool {
+	for _, s := range stageSentinels {
+		if err == s.err {
+			return true
+		}
+	}
+	return false
+}
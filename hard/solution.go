@@ -4,6 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/EmirShimshir/buffered-reader-writer/internal/stagelabel"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -18,7 +24,7 @@ type Producer interface {
 	// Next возвращает:
 	// - пакет элементов для обработки
 	// - cookie для подтверждения после обработки
-	// - ошибку
+	// - ошибку; ErrEofCommitCookie или io.EOF означают конец данных
 	Next() (items []any, cookie int, err error)
 
 	// Commit подтверждает обработку пакета данных
@@ -31,34 +37,94 @@ type Consumer interface {
 }
 
 type batch struct {
+	seq     int
 	buf     []any
 	cookies []int
 }
 
+// processed — обработанный батч, чьи cookie ждут фиксации
+type processed struct {
+	seq     int
+	cookies []int
+}
+
 func Pipe(p Producer, c Consumer, maxItems int) error {
+	return PipeWorkers(p, c, maxItems, 1)
+}
+
+// PipeWorkers работает как Pipe, но обрабатывает до workers батчей
+// параллельно. Cookie фиксируются строго в порядке выдачи источником,
+// независимо от того, в каком порядке завершаются вызовы Process.
+func PipeWorkers(p Producer, c Consumer, maxItems int, workers int) error {
+	workers = max(workers, 1)
 	g, ctx := errgroup.WithContext(context.Background())
+	handed := handedBatches{bySeq: make(map[int][]int)}
 
 	batchCh := make(chan batch, 1)
-	cookiesCh := make(chan int, 256)
+	processedCh := make(chan processed, workers)
 
 	g.Go(func() error {
-		return runNext(ctx, p, maxItems, batchCh)
+		return stagelabel.Do(ctx, "next", func() error {
+			return runNext(ctx, p, maxItems, batchCh)
+		})
 	})
 
 	g.Go(func() error {
-		return runProcess(ctx, c, batchCh, cookiesCh)
+		return stagelabel.Do(ctx, "process", func() error {
+			return runProcess(ctx, c, workers, batchCh, processedCh, &handed)
+		})
 	})
 
+	var last lastCommit
 	g.Go(func() error {
-		return runCommit(ctx, p, cookiesCh)
+		return stagelabel.Do(ctx, "commit", func() error {
+			return runCommit(ctx, p, processedCh, &last)
+		})
 	})
 
-	return g.Wait()
+	err := g.Wait()
+	// g.Wait гарантирует, что runCommit больше не пишет в last
+	return newPipeError(err, last, handed.uncommitted(last.n))
+}
+
+// lastCommit — последний успешно зафиксированный cookie
+type lastCommit struct {
+	cookie int
+	ok     bool
+	n      int // сколько cookie зафиксировано
+}
+
+// handedBatches — cookie батчей, переданных в Process, по номерам батчей
+type handedBatches struct {
+	mu    sync.Mutex
+	bySeq map[int][]int
+}
+
+func (h *handedBatches) add(b batch) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bySeq[b.seq] = b.cookies
+}
+
+// uncommitted возвращает cookie переданных батчей в порядке выдачи, кроме
+// первых committed: Commit идёт строго по порядку батчей
+func (h *handedBatches) uncommitted(committed int) []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cookies []int
+	for _, seq := range slices.Sorted(maps.Keys(h.bySeq)) {
+		cookies = append(cookies, h.bySeq[seq]...)
+	}
+	if committed >= len(cookies) {
+		return nil
+	}
+	return cookies[committed:]
 }
 
 func runNext(ctx context.Context, p Producer, maxItems int, batchCh chan<- batch) error {
 	defer close(batchCh)
 
+	seq := 0
 	buf := make([]any, 0, maxItems)
 	var cookies []int
 	for {
@@ -66,65 +132,94 @@ func runNext(ctx context.Context, p Producer, maxItems int, batchCh chan<- batch
 			return ctx.Err()
 		}
 		items, cookie, err := p.Next()
-		if errors.Is(err, ErrEofCommitCookie) {
-			if len(buf) > 0 {
-				if err := writeChanWithContext(ctx, batchCh, batch{buf: buf, cookies: cookies}); err != nil {
+		eof := isEOF(err)
+		if err != nil && !eof {
+			return fmt.Errorf("%w: %v", ErrNextFailed, err)
+		}
+
+		// Источник может отдать последние элементы вместе с EOF
+		if !eof || len(items) > 0 {
+			if len(buf)+len(items) > maxItems {
+				if err := writeChanWithContext(ctx, batchCh, batch{seq: seq, buf: buf, cookies: cookies}); err != nil {
 					return err
 				}
+				seq++
+				buf = make([]any, 0, maxItems)
+				cookies = []int{}
 			}
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("%w: %v", ErrNextFailed, err)
+			buf = append(buf, items...)
+			cookies = append(cookies, cookie)
 		}
 
-		if len(buf)+len(items) > maxItems {
-			if err := writeChanWithContext(ctx, batchCh, batch{buf: buf, cookies: cookies}); err != nil {
-				return err
+		if eof {
+			if len(buf) > 0 {
+				if err := writeChanWithContext(ctx, batchCh, batch{seq: seq, buf: buf, cookies: cookies}); err != nil {
+					return err
+				}
 			}
-			buf = make([]any, 0, maxItems)
-			cookies = []int{}
+			return nil
 		}
-		buf = append(buf, items...)
-		cookies = append(cookies, cookie)
 	}
 
 }
 
-func runProcess(ctx context.Context, c Consumer, batchCh <-chan batch, cookiesCh chan<- int) error {
-	defer close(cookiesCh)
+// runProcess раздаёт батчи пулу из workers обработчиков. SetLimit блокирует
+// чтение следующего батча, пока все обработчики заняты.
+func runProcess(ctx context.Context, c Consumer, workers int, batchCh <-chan batch, processedCh chan<- processed, handed *handedBatches) error {
+	defer close(processedCh)
 
+	pool, poolCtx := errgroup.WithContext(ctx)
+	pool.SetLimit(workers)
 	for {
-		batch, ok, err := readChanWithContext(ctx, batchCh)
+		batch, ok, err := readChanWithContext(poolCtx, batchCh)
 		if err != nil {
+			// ошибка обработчика важнее вызванной ею отмены контекста
+			if poolErr := pool.Wait(); poolErr != nil {
+				return poolErr
+			}
 			return err
 		}
 		if !ok {
-			return nil
-		}
-		if err := c.Process(batch.buf); err != nil {
-			return fmt.Errorf("%w: %v", ErrProcessFailed, err)
+			return pool.Wait()
 		}
-		for _, cookie := range batch.cookies {
-			if err := writeChanWithContext(ctx, cookiesCh, cookie); err != nil {
-				return err
+		pool.Go(func() error {
+			// слот мог освободиться из-за упавшего обработчика
+			if poolCtx.Err() != nil {
+				return nil
 			}
-		}
+			handed.add(batch)
+			if err := c.Process(batch.buf); err != nil {
+				return fmt.Errorf("%w: %v", ErrProcessFailed, err)
+			}
+			return writeChanWithContext(poolCtx, processedCh, processed{seq: batch.seq, cookies: batch.cookies})
+		})
 	}
 
 }
 
-func runCommit(ctx context.Context, p Producer, cookiesCh <-chan int) error {
+// runCommit фиксирует cookie в порядке батчей, придерживая батчи,
+// обработанные раньше предыдущих
+func runCommit(ctx context.Context, p Producer, processedCh <-chan processed, last *lastCommit) error {
+	pending := make(map[int][]int)
+	next := 0
 	for {
-		cookie, ok, err := readChanWithContext(ctx, cookiesCh)
+		done, ok, err := readChanWithContext(ctx, processedCh)
 		if err != nil {
 			return err
 		}
 		if !ok {
 			return nil
 		}
-		if err := p.Commit(cookie); err != nil {
-			return fmt.Errorf("%w: %v", ErrCommitFailed, err)
+		pending[done.seq] = done.cookies
+		for cookies, ok := pending[next]; ok; cookies, ok = pending[next] {
+			delete(pending, next)
+			next++
+			for _, cookie := range cookies {
+				if err := p.Commit(cookie); err != nil {
+					return fmt.Errorf("%w: %v", ErrCommitFailed, err)
+				}
+				*last = lastCommit{cookie: cookie, ok: true, n: last.n + 1}
+			}
 		}
 	}
 
@@ -151,3 +246,12 @@ func writeChanWithContext[T any](ctx context.Context, ch chan<- T, value T) erro
 		return nil
 	}
 }
+
+// isEOF сообщает, что источник исчерпан
+func isEOF(err error) bool {
+	return errors.Is(err, ErrEofCommitCookie) || errors.Is(err, io.EOF)
+}
+
+// LabelStage — pprof-метка горутины стадии: next, process или commit.
+// По ней стадии различимы в профилях и дампах горутин.
+const LabelStage = stagelabel.Stage
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -319,3 +327,225 @@ func TestPipe_NoDataButWithCookieMinusOne(t *testing.T) {
 	producer.AssertExpectations(t)
 	consumer.AssertExpectations(t)
 }
+
+func TestPipeWorkers_CommitOrderPreserved(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	for i := 1; i <= 4; i++ {
+		producer.On("Next").Return([]any{i}, i, nil).Once()
+	}
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Первый батч обрабатывается дольше остальных
+	consumer.On("Process", []any{1}).Return(nil).Once().After(50 * time.Millisecond)
+	consumer.On("Process", mock.Anything).Return(nil).Times(3)
+
+	var mu sync.Mutex
+	var commits []int
+	producer.On("Commit", mock.Anything).Return(nil).Times(4).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		commits = append(commits, args.Int(0))
+	})
+
+	err := PipeWorkers(producer, consumer, maxItems, 4)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3, 4}, commits)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+// countingProducer отдаёт total пакетов по size элементов
+type countingProducer struct {
+	total, size, n int
+}
+
+func (p *countingProducer) Next() ([]any, int, error) {
+	if p.n >= p.total {
+		return nil, 0, ErrEofCommitCookie
+	}
+	p.n++
+	items := make([]any, p.size)
+	for i := range items {
+		items[i] = p.n
+	}
+	return items, p.n, nil
+}
+
+func (p *countingProducer) Commit(int) error { return nil }
+
+// cpuConsumer имитирует CPU-bound обработку батча
+type cpuConsumer struct{}
+
+func (cpuConsumer) Process(items []any) error {
+	sum := [32]byte{}
+	for range items {
+		for i := 0; i < 200; i++ {
+			sum = sha256.Sum256(sum[:])
+		}
+	}
+	return nil
+}
+
+func BenchmarkPipeWorkers(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p := &countingProducer{total: 64, size: 8}
+				if err := PipeWorkers(p, cpuConsumer{}, 16, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPipe_MemoryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for maxItems := 1; maxItems <= 20; maxItems++ {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			source := pipetest.NewRandomMemorySource(ErrEofCommitCookie, rng, 100, maxItems)
+			sink := &pipetest.MemorySink{}
+
+			err := Pipe(source, sink, maxItems)
+			require.NoError(t, err)
+			pipetest.AssertRoundTrip(t, source, sink, maxItems)
+		})
+	}
+}
+
+func TestPipe_IOEOFFlushesBuffer(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Источник поверх io.Reader сообщает о конце данных через io.EOF
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, io.EOF).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItems(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок данных приходит вместе с EOF
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItemsOverflow(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок не помещается в буфер и уходит отдельным батчем
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 2)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_PipeErrorJSON(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	committed := make(chan struct{})
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) { close(committed) })
+	consumer.On("Process", []any{"item2"}).Return(errors.New("payload rejected")).Once().
+		Run(func(mock.Arguments) { <-committed })
+
+	err := Pipe(producer, consumer, 1)
+	require.ErrorIs(t, err, ErrProcessFailed)
+
+	var pe *PipeError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "process", pe.Stage)
+	require.Equal(t, 1, pe.LastCommitted)
+
+	data, jerr := json.Marshal(err)
+	require.NoError(t, jerr)
+	require.JSONEq(t, `{
+		"stage": "process",
+		"sentinel": "process failed",
+		"message": "payload rejected",
+		"last_committed_cookie": 1,
+		"uncommitted_cookies": [2],
+		"error": "process failed: payload rejected"
+	}`, string(data))
+}
+
+func TestPipe_UncommittedCookiesOnCommitError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Все три пакета попадают в один батч
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+
+	// Первый коммит успешен, второй падает
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(errors.New("commit error")).Once()
+
+	err := Pipe(producer, consumer, 5)
+	require.ErrorIs(t, err, ErrCommitFailed)
+
+	var pe *PipeError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, 1, pe.LastCommitted)
+	require.Equal(t, []int{2, 3}, pe.UncommittedCookies)
+
+	producer.AssertExpectations(t)
+	producer.AssertNotCalled(t, "Commit", 3)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_StageGoroutineLabels(t *testing.T) {
+	release := make(chan struct{})
+	consumer := &pipetest.RecordingConsumer{Fail: func([]any) error {
+		<-release
+		return nil
+	}}
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(pipetest.NewCountingProducer(ErrEofCommitCookie, 100, 1), consumer, 1)
+	}()
+
+	pipetest.AwaitGoroutineLabels(t, LabelStage, "next", LabelStage, "process", LabelStage, "commit")
+	close(release)
+	require.NoError(t, <-done)
+}
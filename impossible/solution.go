@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
+
+	"github.com/EmirShimshir/buffered-reader-writer/internal/stagelabel"
+	"github.com/EmirShimshir/buffered-reader-writer/internal/terminalcookie"
 )
 
 var (
@@ -11,13 +16,16 @@ var (
 	ErrNextFailed      = errors.New("next failed")
 	ErrProcessFailed   = errors.New("process failed")
 	ErrCommitFailed    = errors.New("commit failed")
+
+	// ErrFinalBatchDropped — последний батч не удалось отправить в обработку из-за отмены
+	ErrFinalBatchDropped = errors.New("final batch dropped")
 )
 
 type Producer interface {
 	// Next возвращает:
 	// - пакет элементов для обработки
 	// - cookie для подтверждения после обработки
-	// - ошибку
+	// - ошибку; ErrEofCommitCookie или io.EOF означают конец данных
 	Next() (items []any, cookie int, err error)
 
 	// Commit подтверждает обработку пакета данных
@@ -34,11 +42,30 @@ type batch struct {
 	cookies []int
 }
 
+// ErrorMode определяет, какие ошибки стадий возвращает Pipe
+type ErrorMode int
+
+const (
+	// JoinAll объединяет ошибки всех стадий через errors.Join
+	JoinAll ErrorMode = iota
+	// FirstCause возвращает только самую раннюю ошибку, не являющуюся
+	// отменой контекста, то есть первопричину, а не её каскадные последствия
+	FirstCause
+)
+
 func Pipe(p Producer, c Consumer, maxItems int) error {
+	return PipeWithErrorMode(p, c, maxItems, JoinAll)
+}
+
+// PipeWithErrorMode работает как Pipe, но сводит ошибки стадий согласно mode
+func PipeWithErrorMode(p Producer, c Consumer, maxItems int, mode ErrorMode) error {
 	batchCh := make(chan batch, 1)
 	cookiesCh := make(chan int, 256)
 	errCh := make(chan error, 3) // по количеству стадий
 	var wg sync.WaitGroup
+	var last lastCommit
+	// cookie батчей, переданных в Process, в порядке выдачи
+	var handed []int
 
 	// сигнальные каналы для каскадного shutdown
 	cancelNextCh := make(chan struct{})
@@ -48,24 +75,30 @@ func Pipe(p Producer, c Consumer, maxItems int) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := runNext(cancelNextCh, p, maxItems, batchCh); err != nil {
-			errCh <- fmt.Errorf("%w: %v", ErrNextFailed, err)
+		if err := stagelabel.Do(context.Background(), "next", func() error {
+			return runNext(cancelNextCh, p, maxItems, batchCh)
+		}); err != nil {
+			errCh <- fmt.Errorf("%w: %w", ErrNextFailed, err)
 		}
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := runProcess(cancelProcessCh, c, batchCh, cookiesCh); err != nil {
-			errCh <- fmt.Errorf("%w: %v", ErrProcessFailed, err)
+		if err := stagelabel.Do(context.Background(), "process", func() error {
+			return runProcess(cancelProcessCh, c, batchCh, cookiesCh, &handed)
+		}); err != nil {
+			errCh <- fmt.Errorf("%w: %w", ErrProcessFailed, err)
 		}
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := runCommit(cancelCommitCh, p, cookiesCh); err != nil {
-			errCh <- fmt.Errorf("%w: %v", ErrCommitFailed, err)
+		if err := stagelabel.Do(context.Background(), "commit", func() error {
+			return runCommit(cancelCommitCh, p, cookiesCh, &last)
+		}); err != nil {
+			errCh <- fmt.Errorf("%w: %w", ErrCommitFailed, err)
 		}
 	}()
 
@@ -102,10 +135,36 @@ func Pipe(p Producer, c Consumer, maxItems int) error {
 		allErrs = append(allErrs, e)
 	}
 
-	if len(allErrs) > 0 {
-		return errors.Join(allErrs...)
+	// wg.Wait гарантирует, что стадии больше не пишут в last и handed;
+	// Commit идёт в порядке передачи в Process
+	var uncommitted []int
+	if last.n < len(handed) {
+		uncommitted = handed[last.n:]
 	}
-	return nil
+	return newPipeError(combineErrors(allErrs, mode), last, uncommitted)
+}
+
+// combineErrors сводит ошибки стадий согласно mode
+func combineErrors(allErrs []error, mode ErrorMode) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	if mode == FirstCause {
+		for _, e := range allErrs {
+			if !errors.Is(e, context.Canceled) && !errors.Is(e, context.DeadlineExceeded) {
+				return e
+			}
+		}
+		return allErrs[0]
+	}
+	return errors.Join(allErrs...)
+}
+
+// lastCommit — последний успешно зафиксированный cookie
+type lastCommit struct {
+	cookie int
+	ok     bool
+	n      int // сколько cookie зафиксировано
 }
 
 func runNext(cancelCh <-chan struct{}, p Producer, maxItems int, batchCh chan<- batch) error {
@@ -119,39 +178,59 @@ func runNext(cancelCh <-chan struct{}, p Producer, maxItems int, batchCh chan<-
 			return nil
 		default:
 			items, cookie, err := p.Next()
-			if errors.Is(err, ErrEofCommitCookie) {
-				if len(buf) > 0 {
+			eof := isEOF(err)
+			if err != nil && !eof {
+				return err
+			}
+
+			// Источник может отдать последние элементы вместе с EOF
+			if !eof || len(items) > 0 {
+				if len(buf)+len(items) > maxItems {
 					if ok := writeChanWithCancel(cancelCh, batchCh, batch{buf: buf, cookies: cookies}); !ok {
 						return nil
 					}
+					buf = make([]any, 0, maxItems)
+					cookies = []int{}
+
 				}
-				return nil
-			}
-			if err != nil {
-				return err
+				buf = append(buf, items...)
+				cookies = append(cookies, cookie)
 			}
 
-			if len(buf)+len(items) > maxItems {
-				if ok := writeChanWithCancel(cancelCh, batchCh, batch{buf: buf, cookies: cookies}); !ok {
-					return nil
+			if eof {
+				if len(buf) > 0 {
+					return flushFinal(cancelCh, batchCh, batch{buf: buf, cookies: cookies})
 				}
-				buf = make([]any, 0, maxItems)
-				cookies = []int{}
-
+				return nil
 			}
-			buf = append(buf, items...)
-			cookies = append(cookies, cookie)
 		}
 	}
 }
 
-func runProcess(cancelCh <-chan struct{}, c Consumer, batchCh <-chan batch, cookiesCh chan<- int) error {
+// flushFinal отправляет последний батч при EOF. Данные уже полностью получены
+// от источника, поэтому отправка имеет приоритет над отменой: если в канале
+// есть место, батч уходит даже при закрытом cancelCh. Если батч всё же
+// пришлось бросить, это не проходит молча — возвращается ErrFinalBatchDropped.
+func flushFinal(cancelCh <-chan struct{}, batchCh chan<- batch, b batch) error {
+	select {
+	case batchCh <- b:
+		return nil
+	default:
+	}
+	if ok := writeChanWithCancel(cancelCh, batchCh, b); !ok {
+		return fmt.Errorf("%w: %d items, cookies %v", ErrFinalBatchDropped, len(b.buf), b.cookies)
+	}
+	return nil
+}
+
+func runProcess(cancelCh <-chan struct{}, c Consumer, batchCh <-chan batch, cookiesCh chan<- int, handed *[]int) error {
 	defer close(cookiesCh)
 	for {
 		batch, ok := readChanWithCancel(cancelCh, batchCh)
 		if !ok {
 			return nil
 		}
+		*handed = append(*handed, batch.cookies...)
 		if err := c.Process(batch.buf); err != nil {
 			return err
 		}
@@ -164,7 +243,7 @@ func runProcess(cancelCh <-chan struct{}, c Consumer, batchCh <-chan batch, cook
 
 }
 
-func runCommit(cancelCh <-chan struct{}, p Producer, cookiesCh <-chan int) error {
+func runCommit(cancelCh <-chan struct{}, p Producer, cookiesCh <-chan int, last *lastCommit) error {
 	for {
 		cookie, ok := readChanWithCancel(cancelCh, cookiesCh)
 		if !ok {
@@ -173,6 +252,7 @@ func runCommit(cancelCh <-chan struct{}, p Producer, cookiesCh <-chan int) error
 		if err := p.Commit(cookie); err != nil {
 			return err
 		}
+		*last = lastCommit{cookie: cookie, ok: true, n: last.n + 1}
 	}
 
 }
@@ -198,3 +278,28 @@ func writeChanWithCancel[T any](cancelCh <-chan struct{}, dataCh chan<- T, value
 		return true
 	}
 }
+
+// DefaultTerminalCookie считает терминальным cookie -1
+func DefaultTerminalCookie(cookie int) bool {
+	return terminalcookie.Default(cookie)
+}
+
+// PipeTerminal завершает поток по терминальному cookie так же, как по
+// ErrEofCommitCookie, и возвращает этот cookie (-1 при обычном EOF). Сам
+// терминальный cookie не фиксируется. Ошибки стадий сводятся как в Pipe.
+func PipeTerminal(p Producer, c Consumer, maxItems int, terminal func(cookie int) bool) (int, error) {
+	tp := terminalcookie.New(p, terminal, ErrEofCommitCookie)
+	if err := Pipe(tp, c, maxItems); err != nil {
+		return 0, err
+	}
+	return tp.End(), nil
+}
+
+// isEOF распознаёт конец данных, в том числе обёрнутый
+func isEOF(err error) bool {
+	return errors.Is(err, ErrEofCommitCookie) || errors.Is(err, io.EOF)
+}
+
+// LabelStage — pprof-метка горутины стадии: next, process или commit.
+// По ней стадии различимы в профилях и дампах горутин.
+const LabelStage = stagelabel.Stage
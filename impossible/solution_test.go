@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"testing"
 
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -381,3 +387,269 @@ func TestPipe_GracefulShutdownMultipleStageErrors(t *testing.T) {
 	producer.AssertExpectations(t)
 	consumer.AssertExpectations(t)
 }
+
+// cancelOnEofProducer закрывает cancelCh в момент выдачи EOF,
+// воспроизводя гонку отмены с финальным сбросом буфера
+type cancelOnEofProducer struct {
+	MockProducer
+	cancelCh chan struct{}
+}
+
+func (p *cancelOnEofProducer) Next() ([]any, int, error) {
+	items, cookie, err := p.MockProducer.Next()
+	if errors.Is(err, ErrEofCommitCookie) {
+		close(p.cancelCh)
+	}
+	return items, cookie, err
+}
+
+func TestRunNext_FinalBatchWinsOverCancel(t *testing.T) {
+	producer := &cancelOnEofProducer{cancelCh: make(chan struct{})}
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	batchCh := make(chan batch, 1)
+	err := runNext(producer.cancelCh, producer, 10, batchCh)
+	require.NoError(t, err)
+
+	// В канале есть место — финальный батч доставлен несмотря на отмену
+	b, ok := <-batchCh
+	require.True(t, ok)
+	require.Equal(t, []any{"item1"}, b.buf)
+	require.Equal(t, []int{1}, b.cookies)
+
+	producer.AssertExpectations(t)
+}
+
+func TestRunNext_FinalBatchDroppedIsReported(t *testing.T) {
+	producer := &cancelOnEofProducer{cancelCh: make(chan struct{})}
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Канал занят, а стадия отменена — батч отправить некуда
+	batchCh := make(chan batch, 1)
+	batchCh <- batch{}
+	err := runNext(producer.cancelCh, producer, 10, batchCh)
+	require.ErrorIs(t, err, ErrFinalBatchDropped)
+	require.Contains(t, err.Error(), "cookies [1]")
+
+	producer.AssertExpectations(t)
+}
+
+func TestPipe_ErrorModes(t *testing.T) {
+	processErr := errors.New("process stage failed")
+	for _, mode := range []ErrorMode{JoinAll, FirstCause} {
+		producer, consumer := pipetest.NewCascade(processErr)
+
+		err := PipeWithErrorMode(producer, consumer, 1, mode)
+		require.ErrorIs(t, err, processErr)
+		require.ErrorIs(t, err, ErrProcessFailed)
+		if mode == FirstCause {
+			// Каскадная отмена не попадает в результат
+			require.NotErrorIs(t, err, context.Canceled)
+			require.NotErrorIs(t, err, ErrNextFailed)
+		} else {
+			require.ErrorIs(t, err, context.Canceled)
+		}
+	}
+}
+
+func TestPipe_MemoryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for maxItems := 1; maxItems <= 20; maxItems++ {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			source := pipetest.NewRandomMemorySource(ErrEofCommitCookie, rng, 100, maxItems)
+			sink := &pipetest.MemorySink{}
+
+			err := Pipe(source, sink, maxItems)
+			require.NoError(t, err)
+			pipetest.AssertRoundTrip(t, source, sink, maxItems)
+		})
+	}
+}
+
+func TestPipe_IOEOFFlushesBuffer(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Источник поверх io.Reader сообщает о конце данных через io.EOF
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, io.EOF).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItems(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок данных приходит вместе с EOF
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItemsOverflow(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок не помещается в буфер и уходит отдельным батчем
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 2)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_PipeErrorJSON(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	committed := make(chan struct{})
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) { close(committed) })
+	consumer.On("Process", []any{"item2"}).Return(errors.New("payload rejected")).Once().
+		Run(func(mock.Arguments) { <-committed })
+
+	err := Pipe(producer, consumer, 1)
+	require.ErrorIs(t, err, ErrProcessFailed)
+
+	var pe *PipeError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "process", pe.Stage)
+	require.Equal(t, 1, pe.LastCommitted)
+
+	data, jerr := json.Marshal(err)
+	require.NoError(t, jerr)
+	require.JSONEq(t, `{
+		"stage": "process",
+		"sentinel": "process failed",
+		"message": "payload rejected",
+		"last_committed_cookie": 1,
+		"uncommitted_cookies": [2],
+		"error": "process failed: payload rejected"
+	}`, string(data))
+}
+
+func TestPipe_UncommittedCookiesOnCommitError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Все три пакета попадают в один батч
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+
+	// Первый коммит успешен, второй падает
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(errors.New("commit error")).Once()
+
+	err := Pipe(producer, consumer, 5)
+	require.ErrorIs(t, err, ErrCommitFailed)
+
+	var pe *PipeError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, 1, pe.LastCommitted)
+	require.Equal(t, []int{2, 3}, pe.UncommittedCookies)
+
+	producer.AssertExpectations(t)
+	producer.AssertNotCalled(t, "Commit", 3)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeTerminal_CustomClassification(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Любой отрицательный cookie терминальный: -2 — данные усечены
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	// элементы терминального результата обрабатываются, как вместе с EOF
+	producer.On("Next").Return([]any{"tail"}, -2, nil).Once()
+	consumer.On("Process", []any{"item1", "item2", "tail"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	end, err := PipeTerminal(producer, consumer, 10, func(cookie int) bool { return cookie < 0 })
+	require.NoError(t, err)
+	require.Equal(t, -2, end)
+
+	producer.AssertExpectations(t)
+	producer.AssertNotCalled(t, "Commit", -2)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeTerminal_Default(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, -1, nil).Once()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+
+	end, err := PipeTerminal(producer, consumer, 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, -1, end)
+
+	// -2 по умолчанию не терминальный
+	require.False(t, DefaultTerminalCookie(-2))
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeTerminal_EOFError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	end, err := PipeTerminal(producer, consumer, 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, -1, end)
+}
+
+func TestPipe_StageGoroutineLabels(t *testing.T) {
+	release := make(chan struct{})
+	consumer := &pipetest.RecordingConsumer{Fail: func([]any) error {
+		<-release
+		return nil
+	}}
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(pipetest.NewCountingProducer(ErrEofCommitCookie, 100, 1), consumer, 1)
+	}()
+
+	pipetest.AwaitGoroutineLabels(t, LabelStage, "next", LabelStage, "process", LabelStage, "commit")
+	close(release)
+	require.NoError(t, <-done)
+}
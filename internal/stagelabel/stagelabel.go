@@ -0,0 +1,27 @@
+// Package stagelabel помечает горутины стадий pipeline pprof-метками, общими
+// для всех вариантов.
+package stagelabel
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Ключи pprof-меток. По ним стадии и pipeline различимы в профилях и дампах
+// горутин.
+const (
+	// Stage — стадия: next, process или commit
+	Stage = "pipe.stage"
+	// Name — имя pipeline, если оно задано
+	Name = "pipe.name"
+)
+
+// Do выполняет run с меткой Stage = stage и дополнительными парами
+// ключ-значение extra; горутины, запущенные внутри, наследуют метки
+func Do(ctx context.Context, stage string, run func() error, extra ...string) error {
+	var err error
+	pprof.Do(ctx, pprof.Labels(append([]string{Stage, stage}, extra...)...), func(context.Context) {
+		err = run()
+	})
+	return err
+}
@@ -0,0 +1,26 @@
+package stagelabel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	release := make(chan struct{})
+	stageErr := errors.New("stage failed")
+	done := make(chan error, 1)
+	go func() {
+		done <- Do(context.Background(), "next", func() error {
+			<-release
+			return stageErr
+		}, Name, "orders")
+	}()
+
+	pipetest.AwaitGoroutineLabels(t, Stage, "next", Name, "orders")
+	close(release)
+	require.ErrorIs(t, <-done, stageErr)
+}
@@ -0,0 +1,55 @@
+// Package terminalcookie завершает поток источника по терминальному cookie.
+// Общий для вариантов, в которых есть PipeTerminal.
+package terminalcookie
+
+// Producer — источник в контракте вариантов pipeline
+type Producer interface {
+	Next() (items []any, cookie int, err error)
+	Commit(cookie int) error
+}
+
+// Default — классификация по умолчанию: конец потока обозначает cookie == -1
+func Default(cookie int) bool {
+	return cookie == -1
+}
+
+// Adapter превращает терминальный cookie в ошибку конца данных eof и
+// запоминает его. Элементы терминального результата остаются в нём.
+type Adapter struct {
+	Producer
+	terminal func(cookie int) bool
+	eof      error
+	end      int
+}
+
+// New оборачивает p; terminal == nil означает Default
+func New(p Producer, terminal func(cookie int) bool, eof error) *Adapter {
+	if terminal == nil {
+		terminal = Default
+	}
+	return &Adapter{Producer: p, terminal: terminal, eof: eof, end: -1}
+}
+
+func (a *Adapter) Next() ([]any, int, error) {
+	items, cookie, err := a.Producer.Next()
+	if err == nil && a.terminal(cookie) {
+		a.end = cookie
+		return items, cookie, a.eof
+	}
+	return items, cookie, err
+}
+
+// Commit не передаёт источнику терминальный cookie: им отмечен конец
+// потока, а не обработанные данные
+func (a *Adapter) Commit(cookie int) error {
+	if a.terminal(cookie) {
+		return nil
+	}
+	return a.Producer.Commit(cookie)
+}
+
+// End возвращает терминальный cookie, завершивший поток, или -1, если
+// источник закончился ошибкой сам
+func (a *Adapter) End() int {
+	return a.end
+}
@@ -0,0 +1,33 @@
+package terminalcookie
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+var errEOF = errors.New("eof")
+
+func TestAdapter(t *testing.T) {
+	source := pipetest.NewScriptedProducer(errEOF,
+		pipetest.Step{Items: []any{"a"}, Cookie: 1},
+		pipetest.Step{Items: []any{"tail"}, Cookie: -2},
+	)
+	a := New(source, func(cookie int) bool { return cookie < 0 }, errEOF)
+
+	items, cookie, err := a.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{"a"}, items)
+	require.NoError(t, a.Commit(cookie))
+	require.Equal(t, -1, a.End())
+
+	// элементы терминального результата не теряются
+	items, cookie, err = a.Next()
+	require.ErrorIs(t, err, errEOF)
+	require.Equal(t, []any{"tail"}, items)
+	require.NoError(t, a.Commit(cookie))
+	require.Equal(t, -2, a.End())
+	require.Equal(t, []int{1}, source.Committed())
+}
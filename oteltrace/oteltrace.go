@@ -0,0 +1,59 @@
+// Package oteltrace связывает трассировку батчей pipeline с OpenTelemetry.
+//
+// Tracer из этого пакета структурно совместим с интерфейсом Tracer варианта
+// ultimate и передаётся в WithTracer напрямую.
+package oteltrace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanName — имя span одного батча
+const SpanName = "pipe.batch"
+
+// Ключи атрибутов span батча
+const (
+	AttrBatchSize    = attribute.Key("pipe.batch.size")
+	AttrBatchCookies = attribute.Key("pipe.batch.cookies")
+	AttrPipelineName = attribute.Key("pipe.name")
+)
+
+// Tracer открывает span OpenTelemetry на каждый батч
+type Tracer struct {
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+// New создаёт адаптер поверх tracer. Span батчей становятся дочерними для
+// span из ctx, если он там есть.
+func New(ctx context.Context, tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer, ctx: ctx}
+}
+
+// StartBatch открывает span батча и возвращает функцию его завершения
+func (t *Tracer) StartBatch(size int, cookies []int) func(err error) {
+	return t.start(size, cookies)
+}
+
+// StartNamedBatch работает как StartBatch и добавляет к span имя pipeline
+func (t *Tracer) StartNamedBatch(pipeline string, size int, cookies []int) func(err error) {
+	return t.start(size, cookies, AttrPipelineName.String(pipeline))
+}
+
+func (t *Tracer) start(size int, cookies []int, attrs ...attribute.KeyValue) func(err error) {
+	attrs = append(attrs, AttrBatchSize.Int(size), AttrBatchCookies.IntSlice(cookies))
+	_, span := t.tracer.Start(t.ctx, SpanName, trace.WithAttributes(attrs...))
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+	}
+}
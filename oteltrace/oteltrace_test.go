@@ -0,0 +1,65 @@
+package oteltrace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newRecorder() (*tracetest.SpanRecorder, *Tracer) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return recorder, New(context.Background(), provider.Tracer("test"))
+}
+
+func TestTracer_SpanAttributes(t *testing.T) {
+	recorder, tracer := newRecorder()
+
+	end := tracer.StartBatch(3, []int{7, 8})
+	require.Empty(t, recorder.Ended())
+	end(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, SpanName, spans[0].Name())
+	require.Equal(t, codes.Ok, spans[0].Status().Code)
+
+	attrs := map[string]any{}
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	require.Equal(t, int64(3), attrs[string(AttrBatchSize)])
+	require.Equal(t, []int64{7, 8}, attrs[string(AttrBatchCookies)])
+}
+
+func TestTracer_SpanError(t *testing.T) {
+	recorder, tracer := newRecorder()
+
+	tracer.StartBatch(1, []int{1})(errors.New("commit failed"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, "commit failed", spans[0].Status().Description)
+	require.Len(t, spans[0].Events(), 1)
+}
+
+func TestTracer_NamedSpan(t *testing.T) {
+	recorder, tracer := newRecorder()
+
+	tracer.StartNamedBatch("partition-3", 2, []int{4})(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	attrs := map[string]any{}
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	require.Equal(t, "partition-3", attrs[string(AttrPipelineName)])
+	require.Equal(t, int64(2), attrs[string(AttrBatchSize)])
+}
@@ -0,0 +1,341 @@
+// Package pipetest содержит тестовые реализации Producer и Consumer для
+// табличных тестов Pipe без ручных моков.
+package pipetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Step — один заранее заданный результат вызова Next
+type Step struct {
+	Items  []any
+	Cookie int
+	Err    error
+}
+
+// ScriptedProducer отдаёт шаги по порядку, а после их окончания — всегда eof.
+// Вызовы Commit записываются встроенным RecordingCommitter.
+type ScriptedProducer struct {
+	RecordingCommitter
+
+	mu    sync.Mutex
+	steps []Step
+	pos   int
+	eof   error
+}
+
+// NewScriptedProducer создаёт источник, отдающий steps и затем eof
+// (ErrEofCommitCookie тестируемого пакета)
+func NewScriptedProducer(eof error, steps ...Step) *ScriptedProducer {
+	return &ScriptedProducer{steps: steps, eof: eof}
+}
+
+func (p *ScriptedProducer) Next() ([]any, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pos >= len(p.steps) {
+		p.pos++
+		return nil, 0, p.eof
+	}
+	step := p.steps[p.pos]
+	p.pos++
+	return step.Items, step.Cookie, step.Err
+}
+
+// NextCalls возвращает число вызовов Next
+func (p *ScriptedProducer) NextCalls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pos
+}
+
+// RecordingCommitter записывает все успешные вызовы Commit
+type RecordingCommitter struct {
+	// FailOn задаёт ошибки Commit для отдельных cookie
+	FailOn map[int]error
+
+	mu      sync.Mutex
+	cookies []int
+}
+
+func (c *RecordingCommitter) Commit(cookie int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err, ok := c.FailOn[cookie]; ok {
+		return err
+	}
+	c.cookies = append(c.cookies, cookie)
+	return nil
+}
+
+// Committed возвращает зафиксированные cookie в порядке вызовов Commit
+func (c *RecordingCommitter) Committed() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.cookies...)
+}
+
+// RecordingConsumer записывает копии всех батчей, переданных в Process
+type RecordingConsumer struct {
+	// Fail, если задан, вызывается для каждого батча; ненулевая ошибка
+	// возвращается из Process, и батч не записывается
+	Fail func(items []any) error
+
+	mu      sync.Mutex
+	batches [][]any
+}
+
+func (c *RecordingConsumer) Process(items []any) error {
+	if c.Fail != nil {
+		if err := c.Fail(items); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches = append(c.batches, append([]any(nil), items...))
+	return nil
+}
+
+// Batches возвращает записанные батчи в порядке вызовов Process
+func (c *RecordingConsumer) Batches() [][]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]any(nil), c.batches...)
+}
+
+// Items возвращает все записанные элементы одним срезом
+func (c *RecordingConsumer) Items() []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var items []any
+	for _, b := range c.batches {
+		items = append(items, b...)
+	}
+	return items
+}
+
+// MemorySource — источник поверх среза: отдаёт Items кусками заданной длины,
+// cookie куска — его номер начиная с 1. Вместе с MemorySink служит эталоном
+// корректности: всё, что отдал источник, должно дойти до потребителя
+// по порядку и быть зафиксировано.
+type MemorySource struct {
+	RecordingCommitter
+
+	// Items — все элементы источника
+	Items []any
+
+	mu     sync.Mutex
+	steps  []int
+	pos    int
+	cookie int
+	eof    error
+}
+
+// NewMemorySource создаёт источник, отдающий items кусками длины steps.
+// Если сумма steps меньше len(items), остаток отдаётся последним куском.
+func NewMemorySource(eof error, items []any, steps ...int) *MemorySource {
+	return &MemorySource{Items: items, steps: steps, eof: eof}
+}
+
+// NewRandomMemorySource создаёт источник с n элементами, нарезанными на
+// куски случайной длины от 0 до maxStep
+func NewRandomMemorySource(eof error, rng *rand.Rand, n, maxStep int) *MemorySource {
+	items := make([]any, n)
+	for i := range items {
+		items[i] = i
+	}
+	var steps []int
+	for rest := n; rest > 0; {
+		step := min(rng.Intn(maxStep+1), rest)
+		steps = append(steps, step)
+		rest -= step
+	}
+	return NewMemorySource(eof, items, steps...)
+}
+
+func (s *MemorySource) Next() ([]any, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pos >= len(s.Items) && s.cookie >= len(s.steps) {
+		return nil, 0, s.eof
+	}
+	step := len(s.Items) - s.pos
+	if s.cookie < len(s.steps) {
+		step = min(s.steps[s.cookie], step)
+	}
+	items := s.Items[s.pos : s.pos+step]
+	s.pos += step
+	s.cookie++
+	return items, s.cookie, nil
+}
+
+// Cookies возвращает все выданные cookie по порядку
+func (s *MemorySource) Cookies() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cookies := make([]int, s.cookie)
+	for i := range cookies {
+		cookies[i] = i + 1
+	}
+	return cookies
+}
+
+// MemorySink — потребитель, накапливающий все обработанные батчи
+type MemorySink struct {
+	RecordingConsumer
+}
+
+// AssertRoundTrip проверяет, что элементы всех батчей sink в сумме совпадают
+// с элементами source по порядку, ни один батч не длиннее maxItems
+// (при maxItems > 0), а все выданные cookie зафиксированы
+func AssertRoundTrip(t testing.TB, source *MemorySource, sink *MemorySink, maxItems int) {
+	t.Helper()
+	items := sink.Items()
+	if len(items) == 0 {
+		items = []any{}
+	}
+	want := append([]any{}, source.Items...)
+	if !reflect.DeepEqual(want, items) {
+		t.Errorf("processed items differ from source:\nwant: %v\ngot:  %v", want, items)
+	}
+	if maxItems > 0 {
+		for i, b := range sink.Batches() {
+			if len(b) > maxItems {
+				t.Errorf("batch %d has %d items, want at most %d", i, len(b), maxItems)
+			}
+		}
+	}
+	if cookies, committed := source.Cookies(), source.Committed(); !slices.Equal(cookies, committed) {
+		t.Errorf("committed cookies differ from produced:\nwant: %v\ngot:  %v", cookies, committed)
+	}
+}
+
+// AwaitGoroutineLabels ждёт до секунды, пока у горутин процесса не появятся
+// все pprof-метки из пар ключ-значение pairs, и возвращает дамп горутин.
+// Стадии стартуют в своих горутинах не одновременно, поэтому одного снимка
+// мало.
+func AwaitGoroutineLabels(t testing.TB, pairs ...string) string {
+	t.Helper()
+	var dump bytes.Buffer
+	missing := ""
+	for deadline := time.Now().Add(time.Second); ; {
+		dump.Reset()
+		if err := pprof.Lookup("goroutine").WriteTo(&dump, 1); err != nil {
+			t.Fatalf("goroutine profile: %v", err)
+		}
+		missing = ""
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if label := fmt.Sprintf("%q:%q", pairs[i], pairs[i+1]); !strings.Contains(dump.String(), label) {
+				missing = label
+				break
+			}
+		}
+		if missing == "" {
+			return dump.String()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no goroutine labeled %s", missing)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// NullConsumer отбрасывает все батчи; нужен для замеров накладных расходов
+// самого pipeline без реального ввода-вывода
+type NullConsumer struct{}
+
+func (NullConsumer) Process([]any) error { return nil }
+
+// CountingProducer отдаёт N синтетических элементов по PerNext за вызов
+// Next с последовательными cookie начиная с 1, затем eof. Commit ничего не
+// записывает, чтобы не искажать замеры.
+type CountingProducer struct {
+	N       int
+	PerNext int
+
+	eof   error
+	items []any
+	sent  int
+	next  int
+}
+
+// NewCountingProducer создаёт источник на n элементов по perNext за вызов
+func NewCountingProducer(eof error, n, perNext int) *CountingProducer {
+	perNext = max(perNext, 1)
+	items := make([]any, perNext)
+	for i := range items {
+		items[i] = i
+	}
+	return &CountingProducer{N: n, PerNext: perNext, eof: eof, items: items}
+}
+
+func (p *CountingProducer) Next() ([]any, int, error) {
+	if p.sent >= p.N {
+		return nil, 0, p.eof
+	}
+	n := min(p.PerNext, p.N-p.sent)
+	p.sent += n
+	p.next++
+	return p.items[:n], p.next, nil
+}
+
+func (p *CountingProducer) Commit(int) error { return nil }
+
+// CascadeProducer отдаёт два пакета, а затем, дождавшись начала Process,
+// возвращает context.Canceled — как источник, отменённый вслед за потребителем
+type CascadeProducer struct {
+	processing chan struct{}
+	nextFailed chan struct{}
+	startOnce  sync.Once
+	failOnce   sync.Once
+
+	mu sync.Mutex
+	n  int
+}
+
+func (p *CascadeProducer) Next() ([]any, int, error) {
+	p.mu.Lock()
+	p.n++
+	n := p.n
+	p.mu.Unlock()
+	if n <= 2 {
+		return []any{n}, n, nil
+	}
+	<-p.processing
+	p.failOnce.Do(func() { close(p.nextFailed) })
+	return nil, 0, context.Canceled
+}
+
+func (p *CascadeProducer) Commit(int) error { return nil }
+
+// CascadeConsumer падает с Err, как только источник вернул ошибку отмены.
+// Повторные вызовы Process сразу возвращают Err.
+type CascadeConsumer struct {
+	Err error
+
+	producer *CascadeProducer
+}
+
+func (c *CascadeConsumer) Process([]any) error {
+	c.producer.startOnce.Do(func() { close(c.producer.processing) })
+	<-c.producer.nextFailed
+	return c.Err
+}
+
+// NewCascade создаёт связанную пару источника и потребителя для проверки
+// каскадных ошибок: Process падает с err, а Next — с вызванной этим отменой
+func NewCascade(err error) (*CascadeProducer, *CascadeConsumer) {
+	p := &CascadeProducer{processing: make(chan struct{}), nextFailed: make(chan struct{})}
+	return p, &CascadeConsumer{Err: err, producer: p}
+}
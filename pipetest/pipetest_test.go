@@ -0,0 +1,173 @@
+package pipetest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errEOF = errors.New("eof")
+
+func TestScriptedProducer(t *testing.T) {
+	stepErr := errors.New("step error")
+	p := NewScriptedProducer(errEOF,
+		Step{Items: []any{1, 2}, Cookie: 1},
+		Step{Err: stepErr},
+	)
+
+	items, cookie, err := p.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{1, 2}, items)
+	require.Equal(t, 1, cookie)
+
+	_, _, err = p.Next()
+	require.ErrorIs(t, err, stepErr)
+
+	// После окончания шагов — всегда eof
+	for i := 0; i < 2; i++ {
+		_, _, err = p.Next()
+		require.ErrorIs(t, err, errEOF)
+	}
+	require.Equal(t, 4, p.NextCalls())
+}
+
+func TestRecordingCommitter(t *testing.T) {
+	commitErr := errors.New("commit error")
+	c := &RecordingCommitter{FailOn: map[int]error{2: commitErr}}
+
+	require.NoError(t, c.Commit(1))
+	require.ErrorIs(t, c.Commit(2), commitErr)
+	require.NoError(t, c.Commit(3))
+	require.Equal(t, []int{1, 3}, c.Committed())
+}
+
+func TestRecordingConsumer(t *testing.T) {
+	processErr := errors.New("process error")
+	c := &RecordingConsumer{Fail: func(items []any) error {
+		if len(items) > 2 {
+			return processErr
+		}
+		return nil
+	}}
+
+	batch := []any{1, 2}
+	require.NoError(t, c.Process(batch))
+	require.ErrorIs(t, c.Process([]any{3, 4, 5}), processErr)
+	require.NoError(t, c.Process([]any{6}))
+
+	// Записываются копии: изменение исходного среза не портит запись
+	batch[0] = 100
+	require.Equal(t, [][]any{{1, 2}, {6}}, c.Batches())
+	require.Equal(t, []any{1, 2, 6}, c.Items())
+}
+
+func TestMemorySource(t *testing.T) {
+	s := NewMemorySource(errEOF, []any{1, 2, 3, 4}, 1, 0, 2)
+
+	items, cookie, err := s.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{1}, items)
+	require.Equal(t, 1, cookie)
+
+	items, cookie, err = s.Next()
+	require.NoError(t, err)
+	require.Empty(t, items)
+	require.Equal(t, 2, cookie)
+
+	items, _, err = s.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{2, 3}, items)
+
+	// Остаток сверх steps отдаётся последним куском
+	items, cookie, err = s.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{4}, items)
+	require.Equal(t, 4, cookie)
+
+	_, _, err = s.Next()
+	require.ErrorIs(t, err, errEOF)
+	require.Equal(t, []int{1, 2, 3, 4}, s.Cookies())
+}
+
+func TestAssertRoundTrip(t *testing.T) {
+	source := NewRandomMemorySource(errEOF, rand.New(rand.NewSource(1)), 30, 4)
+	sink := &MemorySink{}
+
+	for {
+		items, cookie, err := source.Next()
+		if errors.Is(err, errEOF) {
+			break
+		}
+		require.NoError(t, sink.Process(items))
+		require.NoError(t, source.Commit(cookie))
+	}
+	AssertRoundTrip(t, source, sink, 4)
+}
+
+// failRecorder перехватывает ошибки AssertRoundTrip, не проваливая сам тест
+type failRecorder struct {
+	testing.TB
+	errors int
+}
+
+func (r *failRecorder) Helper() {}
+
+func (r *failRecorder) Errorf(string, ...any) { r.errors++ }
+
+func TestAssertRoundTrip_OversizedBatch(t *testing.T) {
+	source := NewMemorySource(errEOF, []any{1, 2, 3}, 3)
+	sink := &MemorySink{}
+	items, cookie, err := source.Next()
+	require.NoError(t, err)
+	require.NoError(t, sink.Process(items))
+	require.NoError(t, source.Commit(cookie))
+
+	rec := &failRecorder{TB: t}
+	AssertRoundTrip(rec, source, sink, 2)
+	require.Equal(t, 1, rec.errors)
+
+	rec = &failRecorder{TB: t}
+	AssertRoundTrip(rec, source, sink, 3)
+	require.Zero(t, rec.errors)
+}
+
+func TestCountingProducer(t *testing.T) {
+	p := NewCountingProducer(errEOF, 5, 2)
+
+	var sizes, cookies []int
+	for {
+		items, cookie, err := p.Next()
+		if errors.Is(err, errEOF) {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, NullConsumer{}.Process(items))
+		sizes = append(sizes, len(items))
+		cookies = append(cookies, cookie)
+	}
+	require.Equal(t, []int{2, 2, 1}, sizes)
+	require.Equal(t, []int{1, 2, 3}, cookies)
+}
+
+func TestCascade_RepeatedCalls(t *testing.T) {
+	errProcess := errors.New("process failed")
+	p, c := NewCascade(errProcess)
+
+	for i := 1; i <= 2; i++ {
+		_, cookie, err := p.Next()
+		require.NoError(t, err)
+		require.Equal(t, i, cookie)
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Process(nil) }()
+	for range 2 {
+		_, _, err := p.Next()
+		require.ErrorIs(t, err, context.Canceled)
+	}
+	require.ErrorIs(t, <-done, errProcess)
+	// повторный вызов не паникует
+	require.ErrorIs(t, c.Process(nil), errProcess)
+}
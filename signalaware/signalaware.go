@@ -0,0 +1,117 @@
+// Package signalaware останавливает pipeline по SIGINT/SIGTERM без потери
+// накопленного буфера.
+//
+// Первый сигнал переводит обёрнутый источник в состояние конца потока:
+// следующий Next возвращает eof, pipeline сбрасывает буфер, обрабатывает и
+// фиксирует всё полученное и завершается штатно. Второй сигнал отменяет
+// контекст из Context — для случая, когда корректное завершение зависло.
+package signalaware
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Producer — источник данных pipeline; совпадает по методам с Producer
+// вариантов, поэтому обёрнутый источник передаётся в Pipe напрямую
+type Producer interface {
+	Next() (items []any, cookie int, err error)
+	Commit(cookie int) error
+}
+
+// SignalAware следит за сигналами завершения
+type SignalAware struct {
+	eof     error
+	signals <-chan os.Signal
+	release func()
+
+	draining chan struct{}
+	aborted  chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New подписывается на SIGINT и SIGTERM. eof — ErrEofCommitCookie
+// используемого пакета. После завершения работы нужно вызвать Stop.
+func New(eof error) *SignalAware {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	s := NewWithChannel(eof, ch)
+	s.release = func() { signal.Stop(ch) }
+	return s
+}
+
+// NewWithChannel работает как New, но берёт сигналы из ch; используется в
+// тестах и при собственной подписке на сигналы
+func NewWithChannel(eof error, ch <-chan os.Signal) *SignalAware {
+	s := &SignalAware{
+		eof:      eof,
+		signals:  ch,
+		release:  func() {},
+		draining: make(chan struct{}),
+		aborted:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.watch()
+	return s
+}
+
+func (s *SignalAware) watch() {
+	for _, stage := range []chan struct{}{s.draining, s.aborted} {
+		select {
+		case <-s.signals:
+			close(stage)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Wrap возвращает источник, который после первого сигнала отдаёт eof
+// вместо вызова p.Next. Commit всегда передаётся в p.
+func (s *SignalAware) Wrap(p Producer) Producer {
+	return &producer{Producer: p, s: s}
+}
+
+// Context возвращает контекст, отменяемый вторым сигналом
+func (s *SignalAware) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-s.aborted:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Draining закрывается при первом сигнале
+func (s *SignalAware) Draining() <-chan struct{} {
+	return s.draining
+}
+
+// Stop отписывается от сигналов
+func (s *SignalAware) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		s.release()
+	})
+}
+
+type producer struct {
+	Producer
+	s *SignalAware
+}
+
+func (p *producer) Next() ([]any, int, error) {
+	select {
+	case <-p.s.draining:
+		return nil, 0, p.s.eof
+	default:
+		return p.Producer.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package signalaware
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errEOF = errors.New("eof")
+
+// endlessProducer никогда не заканчивается сам
+type endlessProducer struct {
+	next      int
+	committed []int
+}
+
+func (p *endlessProducer) Next() ([]any, int, error) {
+	p.next++
+	return []any{p.next}, p.next, nil
+}
+
+func (p *endlessProducer) Commit(cookie int) error {
+	p.committed = append(p.committed, cookie)
+	return nil
+}
+
+func TestSignalAware_FirstSignalDrains(t *testing.T) {
+	ch := make(chan os.Signal, 1)
+	s := NewWithChannel(errEOF, ch)
+	defer s.Stop()
+
+	src := &endlessProducer{}
+	p := s.Wrap(src)
+
+	_, cookie, err := p.Next()
+	require.NoError(t, err)
+	require.Equal(t, 1, cookie)
+
+	ch <- syscall.SIGINT
+	<-s.Draining()
+
+	_, _, err = p.Next()
+	require.ErrorIs(t, err, errEOF)
+	require.Equal(t, 1, src.next)
+
+	// фиксация после сигнала проходит как обычно
+	require.NoError(t, p.Commit(1))
+	require.Equal(t, []int{1}, src.committed)
+}
+
+func TestSignalAware_SecondSignalCancelsContext(t *testing.T) {
+	ch := make(chan os.Signal, 2)
+	s := NewWithChannel(errEOF, ch)
+	defer s.Stop()
+
+	ctx, cancel := s.Context(context.Background())
+	defer cancel()
+
+	ch <- syscall.SIGTERM
+	<-s.Draining()
+	require.NoError(t, ctx.Err())
+
+	ch <- syscall.SIGTERM
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not canceled after second signal")
+	}
+}
+
+func TestSignalAware_SelfSentSignal(t *testing.T) {
+	s := New(errEOF)
+	defer s.Stop()
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	select {
+	case <-s.Draining():
+	case <-time.After(time.Second):
+		t.Fatal("SIGINT not observed")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrAborted — причина остановки по умолчанию для Controller.Abort(nil)
+var ErrAborted = errors.New("pipeline aborted")
+
+// Abort немедленно останавливает pipeline: все стадии отменяются без
+// корректной остановки — буфер runNext не сбрасывается даже при FlushFirst,
+// WithCommitDrain не фиксирует ожидающие cookie, а CommitAtEnd не фиксирует
+// ничего. Wait возвращает err (ErrAborted, если err == nil) вместо ошибок
+// отменённых стадий. Повторные вызовы и вызов после завершения стадий
+// ничего не меняют; безопасен для вызова из любой горутины.
+func (ctrl *Controller) Abort(err error) {
+	if err == nil {
+		err = ErrAborted
+	}
+	ctrl.abortOnce.Do(func() {
+		ctrl.abortErr = err
+		close(ctrl.aborted)
+	})
+}
+
+// Состояния abortLatch запуска
+const (
+	abortRunning int32 = iota
+	abortApplied
+	abortFinished
+)
+
+// abortLatch решает гонку Abort с обычным завершением запуска: причина
+// Abort становится результатом, только если он успел отменить стадии
+type abortLatch struct {
+	state   atomic.Int32
+	applied chan struct{}
+}
+
+func newAbortLatch() *abortLatch {
+	return &abortLatch{applied: make(chan struct{})}
+}
+
+// watchAbort отменяет запуск по Controller.Abort. Запуск помечается
+// упавшим до отмены, чтобы стадии при остановке уже видели, что
+// дорабатывать ничего не нужно. Abort после завершения стадий не действует.
+func (pp *pipe) watchAbort(cancel context.CancelFunc) {
+	go func() {
+		select {
+		case <-pp.ctrl.aborted:
+			if !pp.abort.state.CompareAndSwap(abortRunning, abortApplied) {
+				return
+			}
+			close(pp.abort.applied)
+			pp.markFailed(pp.ctrl.abortErr)
+			cancel()
+		case <-pp.shutdown.done:
+		}
+	}()
+}
+
+// settle отмечает завершение стадий и сообщает, успел ли Abort их отменить
+func (l *abortLatch) settle() bool {
+	return !l.state.CompareAndSwap(abortRunning, abortFinished)
+}
+
+// aborted сообщает, что запуск остановлен через Controller.Abort
+func (pp *pipe) aborted() bool {
+	return isClosed(pp.abort.applied)
+}
+
+// drainOnCancel сообщает, нужно ли при отмене фиксировать cookie уже
+// обработанных батчей
+func (pp *pipe) drainOnCancel() bool {
+	return (pp.opts.commitDrain || pp.opts.atLeastOnce) && !pp.aborted()
+}
+
+// cancelled сообщает, отменён ли запуск: контекстом или каналом стадии
+func (pp *pipe) cancelled(cancelCh <-chan struct{}) bool {
+	if pp.ctx.Err() != nil {
+		return true
+	}
+	select {
+	case <-cancelCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_AbortMidStream(t *testing.T) {
+	corrupted := errors.New("data corruption")
+	producer := &endlessProducer{}
+	var batches atomic.Int64
+	ctrlCh := make(chan *Controller, 1)
+	consumer := ConsumerFunc(func([]any) error {
+		if batches.Add(1) == 3 {
+			ctrl := <-ctrlCh
+			ctrl.Abort(corrupted)
+		}
+		return nil
+	})
+	ctrl := PipeControlled(producer, consumer, 2)
+	ctrlCh <- ctrl
+
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, corrupted)
+	require.NotErrorIs(t, err, ErrProcessFailed)
+
+	calls := producer.calls.Load()
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, calls, producer.calls.Load(), "Next called after Abort")
+}
+
+func TestController_AbortIsIdempotent(t *testing.T) {
+	first := errors.New("first")
+	ctrl := PipeControlled(&endlessProducer{}, ConsumerFunc(func([]any) error { return nil }), 1)
+
+	ctrl.Abort(first)
+	ctrl.Abort(errors.New("second"))
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, first)
+
+	// после завершения Abort ничего не меняет
+	ctrl.Abort(nil)
+	_, err = ctrl.Wait()
+	require.ErrorIs(t, err, first)
+}
+
+func TestController_AbortDefaultError(t *testing.T) {
+	ctrl := PipeControlled(&endlessProducer{}, ConsumerFunc(func([]any) error { return nil }), 1)
+
+	ctrl.Abort(nil)
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, ErrAborted)
+}
+
+func TestController_AbortSkipsGracefulShutdown(t *testing.T) {
+	items := make([]any, 1000)
+	steps := make([]int, len(items))
+	for i := range steps {
+		steps[i] = 1
+	}
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, items, steps...)
+	ctrlCh := make(chan *Controller, 1)
+	consumer := ConsumerFunc(func([]any) error {
+		if ctrl, ok := <-ctrlCh; ok {
+			ctrl.Abort(nil)
+		}
+		return nil
+	})
+	ctrl := PipeControlled(source, consumer, 5,
+		WithCommitMode(CommitAtEnd), WithShutdownPreference(FlushFirst, 0), WithCommitDrain())
+	ctrlCh <- ctrl
+	close(ctrlCh)
+
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, ErrAborted)
+	require.Empty(t, source.Committed())
+}
+
+func TestPipe_AbortRacingCompletion(t *testing.T) {
+	corrupted := errors.New("data corruption")
+
+	t.Run("after stages finished", func(t *testing.T) {
+		pp := newPipe(&endlessProducer{}, pipetest.NullConsumer{}, 1, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pp.watchAbort(cancel)
+
+		require.False(t, pp.abort.settle())
+		pp.ctrl.Abort(corrupted)
+		time.Sleep(20 * time.Millisecond)
+		require.False(t, pp.aborted())
+		require.NoError(t, ctx.Err(), "finished run cancelled by a late Abort")
+		close(pp.shutdown.done)
+	})
+
+	t.Run("before stages finished", func(t *testing.T) {
+		pp := newPipe(&endlessProducer{}, pipetest.NullConsumer{}, 1, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pp.watchAbort(cancel)
+
+		pp.ctrl.Abort(corrupted)
+		<-ctx.Done()
+		require.True(t, pp.aborted())
+		require.True(t, pp.abort.settle())
+		close(pp.shutdown.done)
+	})
+}
+
+func TestController_AbortAfterCompletionKeepsResult(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	ctrl := PipeControlled(source, pipetest.NullConsumer{}, 2)
+
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+	ctrl.Abort(nil)
+	_, err = ctrl.Wait()
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, source.Committed())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// adaptiveBatching — AIMD-регулятор порога сброса буфера. Если Process
+// укладывается в целевую задержку, порог растёт на единицу, иначе
+// уменьшается вдвое. Порог всегда остаётся в [minBatch, maxBatch].
+type adaptiveBatching struct {
+	minBatch int
+	maxBatch int
+	target   time.Duration
+
+	mu    sync.Mutex
+	limit int
+}
+
+func newAdaptiveBatching(minBatch, maxBatch int, target time.Duration) *adaptiveBatching {
+	if minBatch < 1 {
+		minBatch = 1
+	}
+	if maxBatch < minBatch {
+		maxBatch = minBatch
+	}
+	return &adaptiveBatching{
+		minBatch: minBatch,
+		maxBatch: maxBatch,
+		target:   target,
+		limit:    maxBatch,
+	}
+}
+
+// current возвращает действующий порог сброса
+func (a *adaptiveBatching) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
+
+// observe учитывает задержку очередного Process
+func (a *adaptiveBatching) observe(latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if latency <= a.target {
+		a.limit++
+	} else {
+		a.limit /= 2
+	}
+	a.limit = max(a.minBatch, min(a.limit, a.maxBatch))
+}
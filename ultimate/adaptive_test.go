@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveBatching_ConvergesToTargetLatency(t *testing.T) {
+	ab := newAdaptiveBatching(1, 100, 10*time.Millisecond)
+
+	// Задержка пропорциональна размеру батча: 1мс на элемент,
+	// значит целевой задержке соответствует батч из 10 элементов
+	var sizes []int
+	for i := 0; i < 200; i++ {
+		size := ab.current()
+		sizes = append(sizes, size)
+		ab.observe(time.Duration(size) * time.Millisecond)
+	}
+
+	// После разгона регулятор колеблется вокруг цели (пила AIMD)
+	for _, size := range sizes[100:] {
+		require.GreaterOrEqual(t, size, 5)
+		require.LessOrEqual(t, size, 11)
+	}
+}
+
+func TestAdaptiveBatching_Bounds(t *testing.T) {
+	ab := newAdaptiveBatching(4, 8, time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		ab.observe(0)
+	}
+	require.Equal(t, 8, ab.current())
+
+	for i := 0; i < 10; i++ {
+		ab.observe(time.Second)
+	}
+	require.Equal(t, 4, ab.current())
+}
+
+// sizeLatencyConsumer обрабатывает батч тем дольше, чем он больше
+type sizeLatencyConsumer struct {
+	perItem time.Duration
+
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (c *sizeLatencyConsumer) Process(items []any) error {
+	c.mu.Lock()
+	c.sizes = append(c.sizes, len(items))
+	c.mu.Unlock()
+	time.Sleep(time.Duration(len(items)) * c.perItem)
+	return nil
+}
+
+func TestPipe_AdaptiveBatchingShrinksSlowBatches(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &sizeLatencyConsumer{perItem: time.Millisecond}
+	maxItems := 50
+
+	for i := 0; i < 200; i++ {
+		producer.On("Next").Return([]any{i}, i, nil).Once()
+	}
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	producer.On("Commit", mock.Anything).Return(nil)
+
+	err := Pipe(producer, consumer, maxItems, WithAdaptiveBatching(1, maxItems, 5*time.Millisecond))
+	require.NoError(t, err)
+	producer.AssertNumberOfCalls(t, "Commit", 200)
+
+	// Первый батч — максимальный, дальше регулятор его уменьшает
+	require.Equal(t, maxItems, consumer.sizes[0])
+	require.Less(t, consumer.sizes[len(consumer.sizes)-2], maxItems)
+}
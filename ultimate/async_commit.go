@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AsyncCommitter — источник, подтверждающий фиксацию асинхронно. CommitAsync
+// не блокируется: результат фиксации приходит в возвращённый канал одним
+// значением (nil — успех) либо канал закрывается без значения, что тоже
+// считается успехом.
+type AsyncCommitter interface {
+	CommitAsync(cookie int) <-chan error
+}
+
+// defaultAsyncCommitDepth — сколько подтверждений AsyncCommitter может
+// ожидаться одновременно, если WithCommitConcurrency не задан
+const defaultAsyncCommitDepth = 16
+
+// asyncCommit — cookie, отправленный на фиксацию и ждущий подтверждения
+type asyncCommit struct {
+	cookie int
+	ack    <-chan error
+}
+
+// runCommitAsync — стадия Commit для источника, реализующего AsyncCommitter.
+// Следующие cookie отправляются, не дожидаясь подтверждения предыдущих, но
+// подтверждения учитываются строго в порядке отправки, а первая ошибка
+// останавливает стадию. Глубину конвейера задаёт WithCommitConcurrency.
+func (pp *pipe) runCommitAsync(ac AsyncCommitter, cancelCh <-chan struct{}) error {
+	depth := defaultAsyncCommitDepth
+	if pp.opts.commitConcurrency > 1 {
+		depth = pp.opts.commitConcurrency
+	}
+
+	var pending []asyncCommit
+	cookiesCh := pp.cookiesCh
+	for cookiesCh != nil || len(pending) > 0 {
+		// пока конвейер заполнен, новые cookie не читаем
+		in := cookiesCh
+		if len(pending) >= depth {
+			in = nil
+		}
+		var ack <-chan error
+		if len(pending) > 0 {
+			ack = pending[0].ack
+		}
+
+		select {
+		case cookie, ok := <-in:
+			if !ok {
+				cookiesCh = nil
+				continue
+			}
+			c, err := pp.commitAsync(ac, cookie)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, c)
+		case err := <-ack:
+			if err := pp.acknowledged(ac, pending[0].cookie, err, cancelCh); err != nil {
+				return err
+			}
+			pending = pending[1:]
+		case <-cancelCh:
+			if !pp.drainOnCancel() {
+				return nil
+			}
+			return pp.drainAsyncCommits(ac, pending)
+		}
+	}
+	return nil
+}
+
+// commitAsync отправляет cookie на асинхронную фиксацию. Канал nil
+// подтверждения никогда не даст, поэтому считается ошибкой фиксации.
+func (pp *pipe) commitAsync(ac AsyncCommitter, cookie int) (asyncCommit, error) {
+	pp.enterStage(StageCommit)
+	ack := ac.CommitAsync(cookie)
+	if ack == nil {
+		return asyncCommit{}, pp.acknowledged(ac, cookie, errNilAck, nil)
+	}
+	return asyncCommit{cookie: cookie, ack: ack}, nil
+}
+
+// errNilAck — CommitAsync вернул nil вместо канала подтверждения
+var errNilAck = errors.New("CommitAsync returned nil channel")
+
+// drainAsyncCommits при отмене отправляет cookie, ожидающие в канале, и
+// дожидается подтверждения всех отправленных, но не дольше WithDrainTimeout
+// по часам WithClock. Controller.Abort прекращает ожидание.
+func (pp *pipe) drainAsyncCommits(ac AsyncCommitter, pending []asyncCommit) error {
+	for drained := false; !drained; {
+		select {
+		case cookie, ok := <-pp.cookiesCh:
+			if !ok {
+				drained = true
+				continue
+			}
+			c, err := pp.commitAsync(ac, cookie)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, c)
+		default:
+			drained = true
+		}
+	}
+
+	var deadline <-chan time.Time
+	if pp.opts.drainTimeout > 0 {
+		timer := pp.opts.clock.NewTimer(pp.opts.drainTimeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-deadline:
+		case <-pp.abort.applied:
+		case <-finished:
+			return
+		}
+		close(stop)
+	}()
+
+	for i, c := range pending {
+		select {
+		case err := <-c.ack:
+			if err := pp.acknowledged(ac, c.cookie, err, stop); err != nil {
+				return err
+			}
+		case <-stop:
+			if pp.aborted() {
+				return nil
+			}
+			return fmt.Errorf("%w: %d async commits unacknowledged", ErrDrainTimeout, len(pending)-i)
+		}
+	}
+	return nil
+}
+
+// acknowledged учитывает подтверждение асинхронной фиксации cookie. Ошибку
+// подтверждения повторяет политика WithStageRetry: cookie отправляется
+// заново, и его подтверждение ждётся до закрытия stop.
+func (pp *pipe) acknowledged(ac AsyncCommitter, cookie int, err error, stop <-chan struct{}) error {
+	if err != nil && err != errNilAck {
+		retried := false
+		err = pp.withRetry(func() error {
+			if !retried {
+				retried = true
+				return err
+			}
+			ack := ac.CommitAsync(cookie)
+			if ack == nil {
+				return errNilAck
+			}
+			select {
+			case err := <-ack:
+				return err
+			case <-stop:
+				return err
+			}
+		})
+	}
+	pp.leaveStage(StageCommit)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrCommitFailed, err)
+		pp.tracing.commitFailed(cookie, err)
+		return err
+	}
+	return pp.committed(cookie)
+}
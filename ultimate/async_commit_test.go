@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// asyncProducer подтверждает фиксацию асинхронно спустя delay и запоминает
+// наибольшее число одновременно ожидающих подтверждений
+type asyncProducer struct {
+	*pipetest.MemorySource
+	delay  time.Duration
+	failOn int
+
+	mu          sync.Mutex
+	outstanding int
+	peak        int
+	acked       []int
+}
+
+func (p *asyncProducer) CommitAsync(cookie int) <-chan error {
+	p.mu.Lock()
+	p.outstanding++
+	p.peak = max(p.peak, p.outstanding)
+	p.mu.Unlock()
+
+	ack := make(chan error, 1)
+	go func() {
+		time.Sleep(p.delay)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.outstanding--
+		if cookie == p.failOn {
+			ack <- errors.New("rejected")
+			return
+		}
+		p.acked = append(p.acked, cookie)
+		close(ack)
+	}()
+	return ack
+}
+
+func newAsyncProducer(n int, delay time.Duration) *asyncProducer {
+	items := make([]any, n)
+	steps := make([]int, n)
+	for i := range items {
+		items[i] = i
+		steps[i] = 1
+	}
+	return &asyncProducer{MemorySource: pipetest.NewMemorySource(ErrEofCommitCookie, items, steps...), delay: delay}
+}
+
+func TestPipe_AsyncCommitterCommitsAll(t *testing.T) {
+	p := newAsyncProducer(8, 5*time.Millisecond)
+
+	stats, err := PipeWithStats(p, ConsumerFunc(func([]any) error { return nil }), 1, WithMaxInflightBatches(8))
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, p.Cookies(), p.acked)
+	require.Equal(t, p.Cookies(), stats.CommittedCookies)
+	// синхронный Commit источника не используется
+	require.Empty(t, p.Committed())
+	// подтверждения ждутся параллельно
+	require.Greater(t, p.peak, 1)
+}
+
+func TestPipe_AsyncCommitterRespectsDepth(t *testing.T) {
+	p := newAsyncProducer(8, 2*time.Millisecond)
+
+	err := Pipe(p, ConsumerFunc(func([]any) error { return nil }), 1, WithMaxInflightBatches(8), WithCommitConcurrency(2))
+	require.NoError(t, err)
+
+	require.Len(t, p.acked, 8)
+	require.LessOrEqual(t, p.peak, 2)
+}
+
+func TestPipe_AsyncCommitterError(t *testing.T) {
+	p := newAsyncProducer(8, time.Millisecond)
+	p.failOn = 3
+
+	err := Pipe(p, ConsumerFunc(func([]any) error { return nil }), 1)
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.ErrorContains(t, err, "rejected")
+}
+
+// scriptedAsync подтверждает фиксацию по сценарию acks: для каждого cookie
+// по порядку вызовов CommitAsync — готовый канал или nil
+type scriptedAsync struct {
+	*pipetest.MemorySource
+
+	mu    sync.Mutex
+	acks  []func() <-chan error
+	calls []int
+}
+
+func (p *scriptedAsync) CommitAsync(cookie int) <-chan error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, cookie)
+	if len(p.acks) == 0 {
+		ack := make(chan error)
+		close(ack)
+		return ack
+	}
+	next := p.acks[0]
+	p.acks = p.acks[1:]
+	return next()
+}
+
+func ackWith(err error) func() <-chan error {
+	return func() <-chan error {
+		ack := make(chan error, 1)
+		ack <- err
+		return ack
+	}
+}
+
+func TestPipe_AsyncCommitterNilAck(t *testing.T) {
+	p := &scriptedAsync{
+		MemorySource: pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1),
+		acks:         []func() <-chan error{func() <-chan error { return nil }},
+	}
+
+	err := Pipe(p, ConsumerFunc(func([]any) error { return nil }), 1)
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.ErrorIs(t, err, errNilAck)
+}
+
+func TestPipe_AsyncCommitterStageRetry(t *testing.T) {
+	p := &scriptedAsync{
+		MemorySource: pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1),
+		acks:         []func() <-chan error{ackWith(Retryable(errors.New("busy")))},
+	}
+
+	stats, err := PipeWithStats(p, ConsumerFunc(func([]any) error { return nil }), 1,
+		WithStageRetry(3, Backoff{}))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, stats.CommittedCookies)
+	// cookie 1 отправлен повторно после ошибки подтверждения
+	require.ElementsMatch(t, []int{1, 1, 2}, p.calls)
+}
+
+func TestPipe_AsyncCommitDrainTimeout(t *testing.T) {
+	// подтверждение cookie 1 не придёт никогда
+	p := &scriptedAsync{
+		MemorySource: pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1),
+		acks:         []func() <-chan error{func() <-chan error { return make(chan error) }},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	consumer := ConsumerFunc(func(items []any) error {
+		if items[0] == 2 {
+			cancel()
+		}
+		return nil
+	})
+
+	_, err := PipeContext(ctx, p, consumer, 1, WithCommitDrain(), WithDrainTimeout(20*time.Millisecond))
+	require.ErrorIs(t, err, ErrDrainTimeout)
+	// стадия Commit не осталась ждать подтверждения в фоне
+	require.Eventually(t, func() bool {
+		buf := make([]byte, 1<<20)
+		return !strings.Contains(string(buf[:runtime.Stack(buf, true)]), "drainAsyncCommits")
+	}, time.Second, time.Millisecond)
+}
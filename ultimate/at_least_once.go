@@ -0,0 +1,12 @@
+package main
+
+// awaitCommits в режиме WithAtLeastOnce после ошибки стадии обработки ждёт,
+// пока стадия Commit зафиксирует cookie всех успешно обработанных батчей,
+// и только потом отдаёт ошибку в pipeline. Так ошибка Process не обгоняет
+// фиксацию предыдущих батчей, и WithDrainTimeout отсчитывается уже после неё.
+func (pp *pipe) awaitCommits(err error) {
+	if err == nil || !pp.opts.atLeastOnce || pp.inlineCommit() {
+		return
+	}
+	<-pp.commitDone
+}
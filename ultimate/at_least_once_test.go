@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedCommitter задерживает Commit до закрытия release
+type gatedCommitter struct {
+	*pipetest.ScriptedProducer
+	release chan struct{}
+}
+
+func (p *gatedCommitter) Commit(cookie int) error {
+	<-p.release
+	return p.ScriptedProducer.Commit(cookie)
+}
+
+// failSecond обрабатывает первый батч и падает на элементе "bad"
+var failSecond = ConsumerFunc(func(items []any) error {
+	if items[0] == "bad" {
+		return errors.New("sink rejected batch")
+	}
+	return nil
+})
+
+func twoBatches() *pipetest.ScriptedProducer {
+	return pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"ok"}, Cookie: 1},
+		pipetest.Step{Items: []any{"bad"}, Cookie: 2},
+	)
+}
+
+func TestPipe_AtLeastOnceCommitsBeforeError(t *testing.T) {
+	scripted := twoBatches()
+	producer := &gatedCommitter{ScriptedProducer: scripted, release: make(chan struct{})}
+	time.AfterFunc(50*time.Millisecond, func() { close(producer.release) })
+
+	// фиксация первого батча медленнее срока завершения, но ошибка Process
+	// ждёт её и срок начинает отсчитываться только после неё
+	err := Pipe(producer, failSecond, 1, WithAtLeastOnce(), WithDrainTimeout(time.Millisecond))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.NotErrorIs(t, err, ErrDrainTimeout)
+	require.Equal(t, []int{1}, scripted.Committed())
+}
+
+func TestPipe_AtLeastOnceCommitAtEnd(t *testing.T) {
+	producer := twoBatches()
+	err := Pipe(producer, failSecond, 1, WithCommitMode(CommitAtEnd))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.Empty(t, producer.Committed())
+
+	producer = twoBatches()
+	err = Pipe(producer, failSecond, 1, WithCommitMode(CommitAtEnd), WithAtLeastOnce())
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.Equal(t, []int{1}, producer.Committed())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBackpressureTimeout — runNext слишком долго ждал освобождения буфера
+var ErrBackpressureTimeout = errors.New("backpressure timeout")
+
+// inflightLimiter — счётный лимит: элементов в батчах "в полёте" между
+// runNext и runProcess или незафиксированных cookie для WithMaxUncommitted
+type inflightLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	used  int
+	freed chan struct{} // закрывается и пересоздаётся при каждом release
+}
+
+func newInflightLimiter(limit int) *inflightLimiter {
+	return &inflightLimiter{limit: limit, freed: make(chan struct{})}
+}
+
+// acquire резервирует n элементов. Батч, превышающий лимит целиком,
+// пропускается, когда в полёте ничего нет, иначе pipeline зависнет навсегда.
+// Возвращает false без ошибки, если стадию отменили во время ожидания.
+func (l *inflightLimiter) acquire(cancelCh <-chan struct{}, clock Clock, n int, timeout time.Duration) (bool, error) {
+	if l.limit <= 0 {
+		return true, nil
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := clock.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C()
+	}
+
+	for {
+		l.mu.Lock()
+		if l.used == 0 || l.used+n <= l.limit {
+			l.used += n
+			l.mu.Unlock()
+			return true, nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-cancelCh:
+			return false, nil
+		case <-timeoutCh:
+			return false, ErrBackpressureTimeout
+		case <-freed:
+		}
+	}
+}
+
+// release возвращает n элементов в лимит и будит ожидающего acquire
+func (l *inflightLimiter) release(n int) {
+	if l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.used -= n
+	close(l.freed)
+	l.freed = make(chan struct{})
+	l.mu.Unlock()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingConsumer зависает в Process, пока не закроют release
+type blockingConsumer struct {
+	release chan struct{}
+}
+
+func (c *blockingConsumer) Process(items []any) error {
+	<-c.release
+	return nil
+}
+
+func TestPipe_BackpressureTimeout(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &blockingConsumer{release: make(chan struct{})}
+	maxItems := 2
+
+	// Источник бесконечно отдаёт данные
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil)
+	producer.On("Commit", mock.Anything).Return(nil).Maybe()
+
+	// Отпускаем потребителя уже после срабатывания таймаута
+	time.AfterFunc(200*time.Millisecond, func() { close(consumer.release) })
+
+	err := Pipe(producer, consumer, maxItems, WithMaxBufferedItems(4, 20*time.Millisecond))
+	require.ErrorIs(t, err, ErrBackpressureTimeout)
+	require.ErrorIs(t, err, ErrNextFailed)
+
+	// Два батча в полёте и один в буфере runNext — дальше источник не читается
+	producer.AssertNumberOfCalls(t, "Next", 4)
+}
+
+func TestPipe_BackpressureWaitsForRelease(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 2
+
+	batches := [][]any{{"item1", "item2"}, {"item3", "item4"}, {"item5", "item6"}}
+	for i, b := range batches {
+		producer.On("Next").Return(b, i+1, nil).Once()
+		consumer.On("Process", b).Return(nil).Once()
+		producer.On("Commit", i+1).Return(nil).Once()
+	}
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Лимит в один батч: runNext ждёт, пока Process освободит место
+	err := Pipe(producer, consumer, maxItems, WithMaxBufferedItems(2, 0))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+// endlessProducer бесконечно отдаёт по одному элементу, пока не выставлен eof
+type endlessProducer struct {
+	calls atomic.Int64
+	eof   atomic.Bool
+}
+
+func (p *endlessProducer) Next() ([]any, int, error) {
+	if p.eof.Load() {
+		return nil, 0, ErrEofCommitCookie
+	}
+	n := int(p.calls.Add(1))
+	return []any{n}, n, nil
+}
+
+func (p *endlessProducer) Commit(int) error { return nil }
+
+func TestPipe_MaxInflightBatches(t *testing.T) {
+	for _, n := range []int{1, 4} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			producer := &endlessProducer{}
+			consumer := &blockingConsumer{release: make(chan struct{})}
+
+			done := make(chan error)
+			go func() { done <- Pipe(producer, consumer, 1, WithMaxInflightBatches(n)) }()
+
+			// Один батч в Process, n ждут в канале, ещё один — в буфере
+			// runNext, и следующий уже не может быть отправлен
+			want := int64(n + 3)
+			require.Eventually(t, func() bool {
+				return producer.calls.Load() >= want
+			}, time.Second, time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+			require.Equal(t, want, producer.calls.Load())
+
+			producer.eof.Store(true)
+			close(consumer.release)
+			require.NoError(t, <-done)
+		})
+	}
+}
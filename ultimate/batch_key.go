@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+)
+
+// batchKeyKey — ключ контекста для ключа идемпотентности батча
+type batchKeyKey struct{}
+
+// BatchKeyFromContext возвращает ключ идемпотентности батча из контекста,
+// переданного в ProcessCtx. В отличие от номера BatchSeqFromContext, ключ
+// вычисляется по cookie батча и поэтому совпадает при повторной обработке
+// тех же данных, в том числе после перезапуска, если батч собран из тех же
+// cookie. Приёмник без идемпотентной записи может по нему отбрасывать
+// повторы. Части батча, разделённого из-за ErrBatchTooLarge или
+// WithGroupKey, содержат разные элементы и получают разные ключи: к ключу
+// исходного батча добавляется путь части, например "/1/0" — первая
+// половина второй половины. Деление воспроизводится на тех же данных,
+// поэтому ключ части при повторе тоже совпадает.
+func BatchKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(batchKeyKey{}).(string)
+	return key, ok
+}
+
+// DefaultBatchKey — ключ батча по умолчанию: SHA-256 отсортированных cookie
+// в шестнадцатеричном виде. Порядок cookie на ключ не влияет.
+func DefaultBatchKey(cookies []int) string {
+	sorted := slices.Clone(cookies)
+	slices.Sort(sorted)
+	h := sha256.New()
+	var buf []byte
+	for _, cookie := range sorted {
+		buf = strconv.AppendInt(buf[:0], int64(cookie), 10)
+		buf = append(buf, ',')
+		h.Write(buf)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// batchKey вычисляет ключ идемпотентности батча
+func (pp *pipe) batchKey(b batch) string {
+	key := DefaultBatchKey
+	if pp.opts.batchKey != nil {
+		key = pp.opts.batchKey
+	}
+	return key(b.cookies) + b.part
+}
+
+// batchPart возвращает i-ю часть батча b с элементами items
+func batchPart(b batch, i int, items []any) batch {
+	b.buf = items
+	b.part += "/" + strconv.Itoa(i)
+	return b
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// keyConsumer запоминает ключи батчей и падает на батче с элементом failOn
+type keyConsumer struct {
+	failOn any
+	keys   []string
+}
+
+func (c *keyConsumer) Process(items []any) error {
+	panic("ProcessCtx must be preferred")
+}
+
+func (c *keyConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	key, ok := BatchKeyFromContext(ctx)
+	if !ok {
+		return errors.New("no batch key")
+	}
+	c.keys = append(c.keys, key)
+	for _, item := range items {
+		if item == c.failOn {
+			return errors.New("sink unavailable")
+		}
+	}
+	return nil
+}
+
+func TestPipe_BatchKeyStableAcrossRetries(t *testing.T) {
+	items := []any{1, 2, 3, 4, 5, 6}
+
+	// первый запуск падает на втором батче, второй обрабатывает те же данные
+	failing := &keyConsumer{failOn: 3}
+	err := Pipe(pipetest.NewMemorySource(ErrEofCommitCookie, items, 2, 2, 2), failing, 2)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.Len(t, failing.keys, 2)
+
+	retry := &keyConsumer{}
+	err = Pipe(pipetest.NewMemorySource(ErrEofCommitCookie, items, 2, 2, 2), retry, 2)
+	require.NoError(t, err)
+	require.Len(t, retry.keys, 3)
+
+	require.Equal(t, failing.keys, retry.keys[:2])
+	require.NotEqual(t, retry.keys[0], retry.keys[1])
+	require.NotEqual(t, retry.keys[1], retry.keys[2])
+}
+
+func TestPipe_WithBatchKey(t *testing.T) {
+	consumer := &keyConsumer{}
+	key := func(cookies []int) string { return fmt.Sprint(cookies) }
+
+	err := Pipe(pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1}, Cookie: 10},
+		pipetest.Step{Items: []any{2}, Cookie: 11},
+		pipetest.Step{Items: []any{3}, Cookie: 12},
+	), consumer, 2, WithBatchKey(key))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[10 11]", "[12]"}, consumer.keys)
+}
+
+func TestDefaultBatchKey(t *testing.T) {
+	key := DefaultBatchKey([]int{3, 1, 2})
+	require.Equal(t, key, DefaultBatchKey([]int{1, 2, 3}))
+	require.NotEqual(t, key, DefaultBatchKey([]int{1, 23}))
+	require.NotEqual(t, key, DefaultBatchKey([]int{1, 2}))
+	require.Len(t, key, 64)
+	require.Equal(t, strings.ToLower(key), key)
+}
+
+// splitKeyConsumer запоминает ключи частей и отвергает батчи длиннее двух
+type splitKeyConsumer struct {
+	keys  []string
+	items [][]any
+}
+
+func (c *splitKeyConsumer) Process(items []any) error {
+	panic("ProcessCtx must be preferred")
+}
+
+func (c *splitKeyConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	if len(items) > 2 {
+		return ErrBatchTooLarge
+	}
+	key, _ := BatchKeyFromContext(ctx)
+	c.keys = append(c.keys, key)
+	c.items = append(c.items, items)
+	return nil
+}
+
+func TestPipe_BatchKeyDistinctForSplitParts(t *testing.T) {
+	run := func() *splitKeyConsumer {
+		source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5}, 5)
+		consumer := &splitKeyConsumer{}
+		require.NoError(t, Pipe(source, consumer, 5))
+		return consumer
+	}
+
+	first := run()
+	// 5 → 2 + 3, а 3 → 1 + 2
+	require.Equal(t, [][]any{{1, 2}, {3}, {4, 5}}, first.items)
+	whole := DefaultBatchKey([]int{1})
+	require.Equal(t, []string{whole + "/0", whole + "/1/0", whole + "/1/1"}, first.keys)
+
+	// на тех же данных части получают те же ключи
+	require.Equal(t, first.keys, run().keys)
+}
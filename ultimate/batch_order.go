@@ -0,0 +1,71 @@
+package main
+
+// BatchOrder определяет порядок, в котором стадия обработки берёт готовые
+// батчи
+type BatchOrder int
+
+const (
+	// FIFO — батчи обрабатываются в порядке формирования
+	FIFO BatchOrder = iota
+	// LIFO — из ожидающих батчей первым обрабатывается самый свежий.
+	// Cookie фиксируются в порядке обработки, то есть более новые раньше
+	// старых, поэтому режим подходит только для независимых cookie и
+	// несовместим по смыслу с WithOffsetCommitMode: фиксация нового смещения
+	// подтвердила бы ещё не обработанные старые батчи.
+	LIFO
+)
+
+// lifoQueue выдаёт самый свежий из ожидающих батчей. Стек пополняется всем,
+// что уже лежит в канале, но не больше limit батчей.
+type lifoQueue struct {
+	in     <-chan batch
+	limit  int
+	stack  []batch
+	closed bool
+}
+
+func (q *lifoQueue) next(cancelCh <-chan struct{}) (batch, bool) {
+	if len(q.stack) == 0 {
+		if q.closed {
+			return batch{}, false
+		}
+		b, ok := readChanWithCancel(cancelCh, q.in)
+		if !ok {
+			return batch{}, false
+		}
+		q.stack = append(q.stack, b)
+	}
+	q.collect()
+	b := q.stack[len(q.stack)-1]
+	q.stack = q.stack[:len(q.stack)-1]
+	return b, true
+}
+
+// collect забирает в стек батчи, уже ожидающие в канале
+func (q *lifoQueue) collect() {
+	for !q.closed && len(q.stack) < q.limit {
+		select {
+		case b, ok := <-q.in:
+			if !ok {
+				q.closed = true
+				return
+			}
+			q.stack = append(q.stack, b)
+		default:
+			return
+		}
+	}
+}
+
+// batchReader возвращает функцию чтения батчей для стадии обработки
+func (pp *pipe) batchReader(cancelCh <-chan struct{}) func() (batch, bool) {
+	if pp.opts.batchOrder != LIFO {
+		return func() (batch, bool) {
+			return readChanWithCancel(cancelCh, pp.batchCh)
+		}
+	}
+	q := &lifoQueue{in: pp.batchCh, limit: max(pp.opts.maxInflightBatches, 1)}
+	return func() (batch, bool) {
+		return q.next(cancelCh)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// heldProducer не отдаёт второй результат, пока не закрыт started
+type heldProducer struct {
+	*pipetest.ScriptedProducer
+	started chan struct{}
+}
+
+func (p *heldProducer) Next() ([]any, int, error) {
+	if p.NextCalls() == 1 {
+		<-p.started
+	}
+	return p.ScriptedProducer.Next()
+}
+
+func TestPipe_LIFOProcessesNewestFirst(t *testing.T) {
+	scripted := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"b1"}, Cookie: 1},
+		pipetest.Step{Items: []any{"b2"}, Cookie: 2},
+		pipetest.Step{Items: []any{"b3"}, Cookie: 3},
+		pipetest.Step{Items: []any{"b4"}, Cookie: 4},
+	)
+	// Первый батч уходит в обработку один, остальные встают в очередь за ним
+	producer := &heldProducer{ScriptedProducer: scripted, started: make(chan struct{})}
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []any
+	consumer := ConsumerFunc(func(items []any) error {
+		if items[0] == "b1" {
+			close(producer.started)
+			<-release
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, items[0])
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Pipe(producer, consumer, 0, WithBatchOrder(LIFO), WithMaxInflightBatches(3))
+	}()
+	// четыре результата и EOF: все батчи сформированы
+	require.Eventually(t, func() bool { return producer.NextCalls() == 5 }, 5*time.Second, time.Millisecond)
+	close(release)
+
+	require.NoError(t, <-errCh)
+	require.Equal(t, []any{"b1", "b4", "b3", "b2"}, order)
+	require.Equal(t, []int{1, 4, 3, 2}, producer.Committed())
+}
+
+func TestPipe_LIFOTracerMatchesCookies(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	tracer := &fakeTracer{}
+
+	err := Pipe(producer, pipetest.NullConsumer{}, 0, WithBatchOrder(LIFO), WithMaxInflightBatches(3), WithTracer(tracer))
+	require.NoError(t, err)
+	require.Len(t, tracer.spans, 3)
+	for _, span := range tracer.spans {
+		require.Equal(t, 1, span.ended)
+		require.NoError(t, span.err)
+	}
+}
+
+func TestPipeWithStats_LIFOUnprocessedCookies(t *testing.T) {
+	scripted := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"b1"}, Cookie: 1},
+		pipetest.Step{Items: []any{"b2"}, Cookie: 2},
+		pipetest.Step{Items: []any{"b3"}, Cookie: 3},
+		pipetest.Step{Items: []any{"b4"}, Cookie: 4},
+	)
+	producer := &heldProducer{ScriptedProducer: scripted, started: make(chan struct{})}
+
+	release := make(chan struct{})
+	// после b1 первым берётся b4, и на нём обработка падает
+	consumer := ConsumerFunc(func(items []any) error {
+		switch items[0] {
+		case "b1":
+			close(producer.started)
+			<-release
+		case "b4":
+			return errors.New("sink unavailable")
+		}
+		return nil
+	})
+
+	type result struct {
+		stats PipeStats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := PipeWithStats(producer, consumer, 0, WithBatchOrder(LIFO), WithMaxInflightBatches(3))
+		done <- result{stats, err}
+	}()
+	require.Eventually(t, func() bool { return producer.NextCalls() == 5 }, 5*time.Second, time.Millisecond)
+	close(release)
+
+	r := <-done
+	require.ErrorIs(t, r.err, ErrProcessFailed)
+	// b4 упал в Process, b2 и b3 до него не дошли
+	require.Equal(t, []int{2, 3, 4}, r.stats.UnprocessedCookies)
+	require.NotContains(t, r.stats.UncommittedCookies, 4)
+}
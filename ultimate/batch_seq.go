@@ -0,0 +1,26 @@
+package main
+
+import "context"
+
+// batchSeqKey — ключ контекста для номера батча
+type batchSeqKey struct{}
+
+// BatchSeqFromContext возвращает номер батча из контекста, переданного в
+// ProcessCtx. Батчи нумеруются с 0 в порядке отправки в обработку, номер
+// уникален лишь в пределах одного запуска Pipe: после перезапуска нумерация
+// начинается заново. Части батча, разделённого из-за ErrBatchTooLarge или
+// WithGroupKey, получают номер исходного батча.
+func BatchSeqFromContext(ctx context.Context) (int, bool) {
+	seq, ok := ctx.Value(batchSeqKey{}).(int)
+	return seq, ok
+}
+
+// batchContext возвращает контекст обработки батча b
+func (pp *pipe) batchContext(b batch) context.Context {
+	ctx := pp.processCtx
+	if ctx == nil {
+		ctx = pp.ctx
+	}
+	ctx = context.WithValue(ctx, batchSeqKey{}, b.seq)
+	return context.WithValue(ctx, batchKeyKey{}, pp.batchKey(b))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// seqConsumer запоминает номера батчей из контекста
+type seqConsumer struct {
+	seqs []int
+}
+
+func (c *seqConsumer) Process(items []any) error {
+	panic("ProcessCtx must be preferred")
+}
+
+func (c *seqConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	seq, ok := BatchSeqFromContext(ctx)
+	if !ok {
+		seq = -1
+	}
+	c.seqs = append(c.seqs, seq)
+	return nil
+}
+
+func TestPipe_BatchSeqFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "plain"},
+		{name: "per batch timeout", opts: []Option{WithPerBatchTimeout(time.Minute)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5}, 2, 1, 2)
+			consumer := &seqConsumer{}
+
+			err := Pipe(producer, consumer, 2, tt.opts...)
+			require.NoError(t, err)
+			require.Equal(t, []int{0, 1, 2}, consumer.seqs)
+		})
+	}
+}
+
+func TestBatchSeqFromContext_Missing(t *testing.T) {
+	_, ok := BatchSeqFromContext(context.Background())
+	require.False(t, ok)
+}
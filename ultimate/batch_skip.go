@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrBatchSkipped — причина отмены контекста батча, пропущенного через
+// Controller.SkipCurrentBatch; её возвращает context.Cause
+var ErrBatchSkipped = errors.New("batch skipped")
+
+// currentBatch — батч, который сейчас обрабатывает стадия Process
+type currentBatch struct {
+	cancel  context.CancelCauseFunc
+	skipped atomic.Bool
+}
+
+// SkipCurrentBatch пропускает батч, который обрабатывается прямо сейчас:
+// контекст ContextConsumer отменяется с причиной ErrBatchSkipped, и
+// pipeline переходит к следующему батчу, не дожидаясь конца обработки
+// отменённого, если потребитель вернётся по отмене. Cookie пропущенного
+// батча не фиксируются и попадают в SkippedCookies статистики.
+// Обычный Consumer прервать нельзя: его батч дорабатывается, но тоже
+// считается пропущенным. Возвращает false, если обрабатываемого батча нет.
+func (ctrl *Controller) SkipCurrentBatch() bool {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	if ctrl.current == nil {
+		return false
+	}
+	ctrl.current.skipped.Store(true)
+	ctrl.current.cancel(ErrBatchSkipped)
+	return true
+}
+
+// beginBatch регистрирует батч как текущий и возвращает его контекст
+func (ctrl *Controller) beginBatch(parent context.Context) (context.Context, *currentBatch) {
+	ctx, cancel := context.WithCancelCause(parent)
+	cur := &currentBatch{cancel: cancel}
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	ctrl.current = cur
+	return ctx, cur
+}
+
+// endBatch снимает регистрацию батча и сообщает, был ли он пропущен
+func (ctrl *Controller) endBatch(cur *currentBatch) bool {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	ctrl.current = nil
+	cur.cancel(nil)
+	return cur.skipped.Load()
+}
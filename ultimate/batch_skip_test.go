@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// skippingConsumer зависает на первом батче до отмены его контекста,
+// остальные батчи записывает
+type skippingConsumer struct {
+	entered chan struct{}
+
+	mu        sync.Mutex
+	cause     error
+	processed []any
+}
+
+func (c *skippingConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	if items[0] == 1 {
+		close(c.entered)
+		<-ctx.Done()
+		c.mu.Lock()
+		c.cause = context.Cause(ctx)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processed = append(c.processed, items...)
+	return nil
+}
+
+func (c *skippingConsumer) Process(items []any) error {
+	return c.ProcessCtx(context.Background(), items)
+}
+
+func TestController_SkipCurrentBatch(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	consumer := &skippingConsumer{entered: make(chan struct{})}
+
+	ctrl := PipeControlled(source, consumer, 1)
+	<-consumer.entered
+	require.True(t, ctrl.SkipCurrentBatch())
+
+	stats, err := ctrl.Wait()
+	require.NoError(t, err)
+	require.ErrorIs(t, consumer.cause, ErrBatchSkipped)
+	require.Equal(t, []any{2, 3}, consumer.processed)
+	require.Equal(t, []int{2, 3}, source.Committed())
+	require.Equal(t, 1, stats.SkippedBatches)
+	require.Equal(t, []int{1}, stats.SkippedCookies)
+	require.Empty(t, stats.UncommittedCookies)
+
+	require.False(t, ctrl.SkipCurrentBatch())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BroadcastConsumer передаёт каждый батч нескольким потребителям, например
+// записи и аудиту. Process успешен, только если успешны все потребители,
+// поэтому cookie батча фиксируются лишь после доставки всем.
+type BroadcastConsumer struct {
+	consumers []Consumer
+	// Concurrent включает параллельный вызов потребителей. Все они получают
+	// один и тот же срез и не должны его изменять.
+	Concurrent bool
+}
+
+// NewBroadcastConsumer создаёт BroadcastConsumer, по умолчанию вызывающий
+// потребителей последовательно в переданном порядке
+func NewBroadcastConsumer(consumers ...Consumer) *BroadcastConsumer {
+	return &BroadcastConsumer{consumers: consumers}
+}
+
+// Process возвращает первую ошибку: в последовательном режиме следующие
+// потребители после неё не вызываются, в параллельном ошибка выбирается по
+// порядку потребителей.
+func (b *BroadcastConsumer) Process(items []any) error {
+	if !b.Concurrent {
+		for i, c := range b.consumers {
+			if err := c.Process(items); err != nil {
+				return fmt.Errorf("consumer %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(b.consumers))
+	var wg sync.WaitGroup
+	for i, c := range b.consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Process(items)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("consumer %d: %w", i, err)
+		}
+	}
+	return nil
+}
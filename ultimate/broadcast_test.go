@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastConsumer(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("concurrent=%v", concurrent), func(t *testing.T) {
+			t.Run("all succeed", func(t *testing.T) {
+				source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+				writer, auditor := &pipetest.MemorySink{}, &pipetest.MemorySink{}
+				consumer := NewBroadcastConsumer(writer, auditor)
+				consumer.Concurrent = concurrent
+
+				err := Pipe(source, consumer, 2)
+				require.NoError(t, err)
+				pipetest.AssertRoundTrip(t, source, writer, 2)
+				pipetest.AssertRoundTrip(t, source, auditor, 2)
+				// по одному Commit на cookie
+				require.Equal(t, []int{1, 2, 3}, source.Committed())
+			})
+
+			t.Run("one fails", func(t *testing.T) {
+				auditErr := errors.New("audit unavailable")
+				source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+				writer := &pipetest.MemorySink{}
+				auditor := &pipetest.MemorySink{RecordingConsumer: pipetest.RecordingConsumer{
+					Fail: func([]any) error { return auditErr },
+				}}
+				consumer := NewBroadcastConsumer(writer, auditor)
+				consumer.Concurrent = concurrent
+
+				err := Pipe(source, consumer, 2)
+				require.ErrorIs(t, err, ErrProcessFailed)
+				require.ErrorIs(t, err, auditErr)
+				require.Empty(t, source.Committed())
+			})
+		})
+	}
+}
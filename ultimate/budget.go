@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTimeBudgetExceeded — pipeline остановлен по истечении WithTimeBudget
+var ErrTimeBudgetExceeded = errors.New("time budget exceeded")
+
+// startTimeBudget создаёт контекст бюджета времени, производный от ctx.
+// По истечении бюджета по часам WithClock контекст отменяется с причиной
+// ErrTimeBudgetExceeded. Возвращённая функция освобождает таймер.
+func (pp *pipe) startTimeBudget(ctx context.Context) context.CancelFunc {
+	if pp.opts.timeBudget <= 0 {
+		return func() {}
+	}
+	budget, cancel := context.WithCancelCause(ctx)
+	timer := pp.opts.clock.NewTimer(pp.opts.timeBudget)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			cancel(ErrTimeBudgetExceeded)
+		case <-budget.Done():
+		}
+	}()
+	pp.budget = budget
+	return func() { cancel(nil) }
+}
+
+// budgetExceeded сообщает, что бюджет времени исчерпан. Отмена внешнего
+// контекста исчерпанием бюджета не считается.
+func (pp *pipe) budgetExceeded() bool {
+	return pp.budget != nil && errors.Is(context.Cause(pp.budget), ErrTimeBudgetExceeded)
+}
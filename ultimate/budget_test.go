@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_TimeBudget(t *testing.T) {
+	for _, fail := range []bool{true, false} {
+		clock := newFakeClock()
+		producer := &endlessProducer{}
+
+		type result struct {
+			stats PipeStats
+			err   error
+		}
+		done := make(chan result, 1)
+		go func() {
+			stats, err := PipeWithStats(producer, ConsumerFunc(func([]any) error { return nil }), 4,
+				WithClock(clock), WithTimeBudget(time.Minute, fail))
+			done <- result{stats, err}
+		}()
+
+		require.Eventually(t, func() bool {
+			return clock.activeTimers() == 1 && producer.calls.Load() >= 20
+		}, time.Second, time.Millisecond)
+		clock.Advance(time.Minute)
+
+		res := <-done
+		if fail {
+			require.ErrorIs(t, res.err, ErrTimeBudgetExceeded)
+		} else {
+			require.NoError(t, res.err)
+		}
+		// всё прочитанное до истечения бюджета обработано и зафиксировано
+		require.Equal(t, int(producer.calls.Load()), res.stats.Items)
+		require.Equal(t, res.stats.Items, res.stats.Commits)
+		require.Empty(t, res.stats.UncommittedCookies)
+		require.Empty(t, res.stats.UnprocessedCookies)
+	}
+}
+
+// delayedProducer отдаёт по элементу раз в delay реального времени
+type delayedProducer struct {
+	endlessProducer
+	delay time.Duration
+}
+
+func (p *delayedProducer) Next() ([]any, int, error) {
+	time.Sleep(p.delay)
+	return p.endlessProducer.Next()
+}
+
+func TestPipe_TimeBudgetSlowProducer(t *testing.T) {
+	producer := &delayedProducer{delay: 5 * time.Millisecond}
+
+	start := time.Now()
+	stats, err := PipeWithStats(producer, ConsumerFunc(func([]any) error { return nil }), 100,
+		WithTimeBudget(50*time.Millisecond, true))
+	require.ErrorIs(t, err, ErrTimeBudgetExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	// батч из 100 элементов не успел заполниться, но всё прочитанное
+	// сброшено и зафиксировано
+	require.Positive(t, stats.Commits)
+	require.Equal(t, int(producer.calls.Load()), stats.Items)
+	require.Empty(t, stats.UncommittedCookies)
+}
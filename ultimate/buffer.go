@@ -0,0 +1,131 @@
+package main
+
+// BufferStrategy определяет, как runNext накапливает элементы до сброса
+type BufferStrategy int
+
+const (
+	// SliceAppend копит элементы в срезе и после каждого сброса отдаёт его
+	// в батч целиком, выделяя под следующий буфер новый срез ёмкостью maxItems
+	SliceAppend BufferStrategy = iota
+	// RingBuffer один раз выделяет кольцевой буфер на maxItems элементов и
+	// при сбросе отдаёт в батч непрерывную копию содержимого точного размера.
+	// Выгоден при больших maxItems и батчах, которые часто сбрасываются
+	// неполными: память под буфер не выделяется заново на каждый батч.
+	RingBuffer
+)
+
+// itemBuffer — накопитель элементов между сбросами
+type itemBuffer interface {
+	len() int
+	// view возвращает содержимое одним срезом; срез действителен до
+	// следующего изменения буфера
+	view() []any
+	push(items []any)
+	// replace заменяет содержимое, например результатом coalesce
+	replace(items []any)
+	// take возвращает содержимое для батча и опустошает буфер
+	take() []any
+}
+
+// newItemBuffer создаёт буфер на capacity элементов. Срезы, которые
+// возвращает take, имеют ещё не меньше headroom элементов свободной ёмкости,
+// пока результаты Next не переполнили буфер.
+func newItemBuffer(strategy BufferStrategy, capacity, headroom int) itemBuffer {
+	if strategy == RingBuffer {
+		return &ringBuffer{data: make([]any, capacity), headroom: headroom}
+	}
+	return &sliceBuffer{capacity: capacity + headroom, buf: make([]any, 0, capacity+headroom)}
+}
+
+type sliceBuffer struct {
+	capacity int
+	buf      []any
+}
+
+func (s *sliceBuffer) len() int            { return len(s.buf) }
+func (s *sliceBuffer) view() []any         { return s.buf }
+func (s *sliceBuffer) push(items []any)    { s.buf = append(s.buf, items...) }
+func (s *sliceBuffer) replace(items []any) { s.buf = items }
+
+func (s *sliceBuffer) take() []any {
+	buf := s.buf
+	s.buf = make([]any, 0, s.capacity)
+	return buf
+}
+
+// ringBuffer хранит элементы в data начиная с head с переходом через конец
+type ringBuffer struct {
+	data     []any
+	head     int
+	size     int
+	headroom int
+}
+
+func (r *ringBuffer) len() int { return r.size }
+
+func (r *ringBuffer) view() []any {
+	if r.head+r.size > len(r.data) {
+		// содержимое переходит через конец: выпрямляем его в начало
+		r.grow(len(r.data))
+	}
+	return r.data[r.head : r.head+r.size]
+}
+
+func (r *ringBuffer) push(items []any) {
+	if len(items) == 0 {
+		return
+	}
+	if r.size+len(items) > len(r.data) {
+		// результат Next больше свободного места: буфер растёт
+		r.grow(r.size + len(items))
+	}
+	tail := (r.head + r.size) % len(r.data)
+	n := copy(r.data[tail:], items)
+	copy(r.data, items[n:])
+	r.size += len(items)
+}
+
+func (r *ringBuffer) replace(items []any) {
+	r.head, r.size = 0, 0
+	r.push(items)
+}
+
+func (r *ringBuffer) take() []any {
+	out := make([]any, r.size, r.size+r.headroom)
+	n := copy(out, r.data[r.head:min(r.head+r.size, len(r.data))])
+	copy(out[n:], r.data[:r.size-n])
+	// освобождаем ссылки, чтобы буфер не удерживал элементы от сборщика мусора
+	r.clear()
+	r.head = (r.head + r.size) % max(len(r.data), 1)
+	r.size = 0
+	return out
+}
+
+func (r *ringBuffer) clear() {
+	end := r.head + r.size
+	if end <= len(r.data) {
+		clear(r.data[r.head:end])
+		return
+	}
+	clear(r.data[r.head:])
+	clear(r.data[:end-len(r.data)])
+}
+
+// grow переносит содержимое в начало нового массива ёмкостью не меньше capacity
+func (r *ringBuffer) grow(capacity int) {
+	data := make([]any, max(capacity, len(r.data)))
+	n := copy(data, r.data[r.head:min(r.head+r.size, len(r.data))])
+	copy(data[n:], r.data[:r.size-n])
+	r.data, r.head = data, 0
+}
+
+// withHeadroom возвращает items с не меньше чем headroom элементами
+// свободной ёмкости, копируя их в новый срез, только если места не хватает
+func withHeadroom(items []any, headroom int) []any {
+	if headroom <= 0 || cap(items)-len(items) >= headroom {
+		return items
+	}
+	out := make([]any, len(items), len(items)+headroom)
+	copy(out, items)
+	return out
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingBuffer_Wraparound(t *testing.T) {
+	r := newItemBuffer(RingBuffer, 4, 0)
+
+	r.push([]any{1, 2, 3})
+	require.Equal(t, []any{1, 2, 3}, r.take())
+
+	// запись переходит через конец массива
+	r.push([]any{4, 5})
+	r.push([]any{6})
+	require.Equal(t, 3, r.len())
+	require.Equal(t, []any{4, 5, 6}, r.view())
+	require.Equal(t, []any{4, 5, 6}, r.take())
+	require.Equal(t, 0, r.len())
+
+	// результат больше ёмкости: буфер растёт
+	r.push([]any{7, 8, 9})
+	r.push([]any{10, 11, 12})
+	require.Equal(t, []any{7, 8, 9, 10, 11, 12}, r.take())
+}
+
+func TestPipe_RingBufferRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for maxItems := 1; maxItems <= 20; maxItems++ {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			source := pipetest.NewRandomMemorySource(ErrEofCommitCookie, rng, 100, maxItems)
+			sink := &pipetest.MemorySink{}
+
+			err := Pipe(source, sink, maxItems, WithBufferStrategy(RingBuffer))
+			require.NoError(t, err)
+			pipetest.AssertRoundTrip(t, source, sink, maxItems)
+		})
+	}
+}
+
+func TestPipe_RingBufferWithCoalesce(t *testing.T) {
+	dedupe := func(buf []any, incoming []any) []any {
+		for _, item := range incoming {
+			if len(buf) == 0 || buf[len(buf)-1] != item {
+				buf = append(buf, item)
+			}
+		}
+		return buf
+	}
+
+	// Результат не зависит от стратегии буфера
+	var batches [][][]any
+	for _, strategy := range []BufferStrategy{SliceAppend, RingBuffer} {
+		source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 1, 2, 2, 3, 3, 3}, 1, 1, 1, 1, 1, 1, 1)
+		sink := &pipetest.MemorySink{}
+
+		err := Pipe(source, sink, 3, WithBufferStrategy(strategy), WithCoalesce(dedupe))
+		require.NoError(t, err)
+		batches = append(batches, sink.Batches())
+	}
+	require.Equal(t, [][]any{{1, 2, 3}, {3}}, batches[0])
+	require.Equal(t, batches[0], batches[1])
+}
+
+func benchmarkBufferStrategy(b *testing.B, strategy BufferStrategy) {
+	b.ReportAllocs()
+	const maxItems = 100000
+	items := make([]any, 1000)
+	for i := 0; i < b.N; i++ {
+		// каждый батч сбрасывается неполным по границе
+		boundary := func(buf []any, _ []any) bool { return len(buf) >= 100 }
+		steps := make([]int, 100)
+		for j := range steps {
+			steps[j] = 10
+		}
+		source := pipetest.NewMemorySource(ErrEofCommitCookie, items, steps...)
+		err := Pipe(source, ConsumerFunc(func([]any) error { return nil }), maxItems, WithBufferStrategy(strategy), WithBoundary(boundary))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBufferStrategy_SliceAppend(b *testing.B) {
+	benchmarkBufferStrategy(b, SliceAppend)
+}
+
+func BenchmarkBufferStrategy_RingBuffer(b *testing.B) {
+	benchmarkBufferStrategy(b, RingBuffer)
+}
+
+func TestPipe_HeadroomItems(t *testing.T) {
+	for _, strategy := range []BufferStrategy{SliceAppend, RingBuffer} {
+		source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6, 7}, 2)
+		var spare []int
+		var framed [][]any
+		consumer := ConsumerFunc(func(items []any) error {
+			spare = append(spare, cap(items)-len(items))
+			// кадр вписывается в запас на месте, без нового массива
+			n := len(items)
+			items = items[:n+2]
+			copy(items[1:], items[:n])
+			items[0], items[n+1] = "begin", "end"
+			framed = append(framed, slices.Clone(items))
+			return nil
+		})
+
+		require.NoError(t, Pipe(source, consumer, 4, WithBufferStrategy(strategy), WithHeadroomItems(2)))
+		require.NotEmpty(t, spare)
+		for _, n := range spare {
+			require.GreaterOrEqual(t, n, 2)
+		}
+		var items []any
+		for _, batch := range framed {
+			require.Equal(t, "begin", batch[0])
+			require.Equal(t, "end", batch[len(batch)-1])
+			items = append(items, batch[1:len(batch)-1]...)
+		}
+		require.Equal(t, []any{1, 2, 3, 4, 5, 6, 7}, items)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// BytesProducer — источник, отдающий элементы как []byte без упаковки в any
+type BytesProducer interface {
+	Next() (items [][]byte, cookie int, err error)
+	Commit(cookie int) error
+}
+
+// BytesConsumer — потребитель батчей []byte
+type BytesConsumer interface {
+	Process(items [][]byte) error
+}
+
+type bytesBatch struct {
+	buf     [][]byte
+	size    int
+	cookies []int
+}
+
+// PipeBytes — специализированный Pipe для потоков байт. Буфер ограничен
+// суммарной длиной элементов maxBytes, а не их количеством, и элементы не
+// упаковываются в any. Результат одного Next, превышающий maxBytes,
+// уходит отдельным батчем целиком.
+func PipeBytes(p BytesProducer, c BytesConsumer, maxBytes int) error {
+	switch {
+	case p == nil:
+		return fmt.Errorf("%w: producer is nil", ErrInvalidArgument)
+	case c == nil:
+		return fmt.Errorf("%w: consumer is nil", ErrInvalidArgument)
+	case maxBytes <= 0:
+		return fmt.Errorf("%w: maxBytes must be positive (%d)", ErrInvalidArgument, maxBytes)
+	}
+
+	batchCh := make(chan bytesBatch, 1)
+	cookiesCh := make(chan int, 256)
+
+	pipeline := NewPipeline()
+	pipeline.AddStage(func(cancelCh <-chan struct{}) error {
+		return runNextBytes(cancelCh, p, maxBytes, batchCh)
+	})
+	pipeline.AddStage(func(cancelCh <-chan struct{}) error {
+		return runProcessBytes(cancelCh, c, batchCh, cookiesCh)
+	})
+	pipeline.AddStage(func(cancelCh <-chan struct{}) error {
+		return runCommitBytes(cancelCh, p, cookiesCh)
+	})
+	return pipeline.Run()
+}
+
+func runNextBytes(cancelCh <-chan struct{}, p BytesProducer, maxBytes int, batchCh chan<- bytesBatch) error {
+	defer close(batchCh)
+
+	var b bytesBatch
+	for {
+		select {
+		case <-cancelCh:
+			return nil
+		default:
+			items, cookie, err := p.Next()
+			eof := isEOF(err)
+			if err != nil && !eof {
+				return fmt.Errorf("%w: %w", ErrNextFailed, err)
+			}
+
+			// источник может отдать последние элементы вместе с EOF
+			if !eof || len(items) > 0 {
+				size := 0
+				for _, item := range items {
+					size += len(item)
+				}
+				if len(b.buf) > 0 && b.size+size > maxBytes {
+					if ok := writeChanWithCancel(cancelCh, batchCh, b); !ok {
+						return nil
+					}
+					b = bytesBatch{}
+				}
+				b.buf = append(b.buf, items...)
+				b.size += size
+				b.cookies = append(b.cookies, cookie)
+			}
+
+			if eof {
+				if len(b.buf) > 0 {
+					if ok := writeChanWithCancel(cancelCh, batchCh, b); !ok {
+						// данные получены полностью: потерю хвоста нельзя выдать за успех
+						return fmt.Errorf("final batch of %d bytes dropped, cookies %v: %w", b.size, b.cookies, context.Canceled)
+					}
+				}
+				return nil
+			}
+		}
+	}
+}
+
+func runProcessBytes(cancelCh <-chan struct{}, c BytesConsumer, batchCh <-chan bytesBatch, cookiesCh chan<- int) error {
+	defer close(cookiesCh)
+	for {
+		batch, ok := readChanWithCancel(cancelCh, batchCh)
+		if !ok {
+			return nil
+		}
+		if err := c.Process(batch.buf); err != nil {
+			return fmt.Errorf("%w: %w", ErrProcessFailed, err)
+		}
+		for _, cookie := range batch.cookies {
+			if ok := writeChanWithCancel(cancelCh, cookiesCh, cookie); !ok {
+				return nil
+			}
+		}
+	}
+}
+
+func runCommitBytes(cancelCh <-chan struct{}, p BytesProducer, cookiesCh <-chan int) error {
+	for {
+		cookie, ok := readChanWithCancel(cancelCh, cookiesCh)
+		if !ok {
+			return nil
+		}
+		if err := p.Commit(cookie); err != nil {
+			return fmt.Errorf("%w: %w", ErrCommitFailed, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// chunkProducer отдаёт total пакетов по одному фрагменту chunk
+type chunkProducer struct {
+	chunk     []byte
+	total, n  int
+	committed []int
+}
+
+func (p *chunkProducer) Next() ([][]byte, int, error) {
+	if p.n >= p.total {
+		return nil, 0, ErrEofCommitCookie
+	}
+	p.n++
+	return [][]byte{p.chunk}, p.n, nil
+}
+
+func (p *chunkProducer) Commit(cookie int) error {
+	p.committed = append(p.committed, cookie)
+	return nil
+}
+
+// bytesRecorder записывает размеры батчей в байтах
+type bytesRecorder struct {
+	sizes []int
+}
+
+func (c *bytesRecorder) Process(items [][]byte) error {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	c.sizes = append(c.sizes, size)
+	return nil
+}
+
+func TestPipeBytes_FlushesAtMaxBytes(t *testing.T) {
+	producer := &chunkProducer{chunk: make([]byte, 3), total: 5}
+	consumer := &bytesRecorder{}
+
+	err := PipeBytes(producer, consumer, 7)
+	require.NoError(t, err)
+	require.Equal(t, []int{6, 6, 3}, consumer.sizes)
+	require.Equal(t, []int{1, 2, 3, 4, 5}, producer.committed)
+}
+
+func TestPipeBytes_OversizedNext(t *testing.T) {
+	producer := &chunkProducer{chunk: make([]byte, 10), total: 2}
+	consumer := &bytesRecorder{}
+
+	err := PipeBytes(producer, consumer, 4)
+	require.NoError(t, err)
+	require.Equal(t, []int{10, 10}, consumer.sizes)
+}
+
+func TestPipeBytes_InvalidArguments(t *testing.T) {
+	err := PipeBytes(&chunkProducer{}, &bytesRecorder{}, 0)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+// nopBytesConsumer отбрасывает батчи
+type nopBytesConsumer struct{}
+
+func (nopBytesConsumer) Process([][]byte) error { return nil }
+
+// anyChunkProducer — тот же поток фрагментов через обобщённый путь с any
+type anyChunkProducer struct {
+	chunk    []byte
+	total, n int
+}
+
+func (p *anyChunkProducer) Next() ([]any, int, error) {
+	if p.n >= p.total {
+		return nil, 0, ErrEofCommitCookie
+	}
+	p.n++
+	return []any{p.chunk}, p.n, nil
+}
+
+func (p *anyChunkProducer) Commit(int) error { return nil }
+
+func BenchmarkPipeBytes(b *testing.B) {
+	b.ReportAllocs()
+	chunk := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		p := &chunkProducer{chunk: chunk, total: 1000}
+		if err := PipeBytes(p, nopBytesConsumer{}, 64*100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPipeAnyBytes(b *testing.B) {
+	b.ReportAllocs()
+	chunk := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		p := &anyChunkProducer{chunk: chunk, total: 1000}
+		if err := Pipe(p, ConsumerFunc(func([]any) error { return nil }), 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// eofSignalProducer отдаёт total однобайтовых пакетов и закрывает eof, дойдя
+// до конца данных
+type eofSignalProducer struct {
+	chunkProducer
+	eof chan struct{}
+}
+
+func (p *eofSignalProducer) Next() ([][]byte, int, error) {
+	items, cookie, err := p.chunkProducer.Next()
+	if err != nil {
+		close(p.eof)
+	}
+	return items, cookie, err
+}
+
+// failSecondBytes падает на втором батче, когда источник уже исчерпан
+type failSecondBytes struct {
+	eof <-chan struct{}
+	n   int
+}
+
+func (c *failSecondBytes) Process([][]byte) error {
+	if c.n++; c.n == 2 {
+		<-c.eof
+		return errors.New("consumer error")
+	}
+	return nil
+}
+
+func TestPipeBytes_DroppedFinalBatchIsAnError(t *testing.T) {
+	producer := &eofSignalProducer{chunkProducer: chunkProducer{chunk: []byte{1}, total: 4}, eof: make(chan struct{})}
+	// батч 3 ждёт в канале, и последнему батчу отправляться некуда
+	consumer := &failSecondBytes{eof: producer.eof}
+
+	err := PipeBytes(producer, consumer, 1)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorContains(t, err, "final batch")
+	require.Equal(t, []int{1}, producer.committed)
+}
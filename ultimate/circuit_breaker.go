@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается из Process, когда предохранитель разомкнут:
+// потребитель подряд падал слишком часто, и новые батчи ему не передаются
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreakerMiddleware размыкает цепь после failures подряд идущих ошибок
+// Process, уложившихся в window. Разомкнутый предохранитель сразу возвращает
+// ErrCircuitOpen, не вызывая потребителя, и pipeline завершается с
+// ErrProcessFailed вместо того, чтобы тратить время на заведомо неудачные
+// попытки. Успешный Process сбрасывает счётчик. Через window после
+// размыкания предохранитель пропускает к потребителю один пробный вызов:
+// успех замыкает цепь, ошибка размыкает её ещё на window. failures меньше 1
+// — ошибка ErrInvalidArgument из каждого Process.
+//
+// Предохранитель ставится внутрь RetryMiddleware, чтобы считать каждую
+// попытку: Chain(c, RetryMiddleware(...), CircuitBreakerMiddleware(...)).
+// RetryMiddleware не повторяет вызов после ErrCircuitOpen. clock == nil
+// означает реальное время.
+func CircuitBreakerMiddleware(failures int, window time.Duration, clock Clock) ConsumerMiddleware {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return func(next Consumer) Consumer {
+		if failures < 1 {
+			return ConsumerFunc(func([]any) error {
+				return fmt.Errorf("%w: circuit breaker failures must be positive (%d)", ErrInvalidArgument, failures)
+			})
+		}
+		b := &circuitBreaker{failures: failures, window: window, clock: clock}
+		return ConsumerFunc(func(items []any) error {
+			if !b.allow() {
+				return ErrCircuitOpen
+			}
+			err := next.Process(items)
+			return b.record(err)
+		})
+	}
+}
+
+// circuitBreaker хранит моменты подряд идущих ошибок в пределах окна
+type circuitBreaker struct {
+	failures int
+	window   time.Duration
+	clock    Clock
+
+	mu       sync.Mutex
+	recent   []time.Time
+	open     bool
+	openedAt time.Time
+	probing  bool
+}
+
+// allow сообщает, можно ли вызвать потребителя. Разомкнутая цепь по
+// истечении окна пропускает один пробный вызов.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || b.clock.Now().Sub(b.openedAt) < b.window {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record учитывает результат Process и размыкает цепь, если ошибок набралось
+// достаточно
+func (b *circuitBreaker) record(err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.probing {
+		b.probing = false
+		if err == nil {
+			b.open = false
+			b.recent = b.recent[:0]
+			return nil
+		}
+		b.openedAt = b.clock.Now()
+		return fmt.Errorf("%w: probe failed: %w", ErrCircuitOpen, err)
+	}
+	if err == nil {
+		b.recent = b.recent[:0]
+		return nil
+	}
+	now := b.clock.Now()
+	b.recent = append(b.recent, now)
+	// ошибки старше окна не считаются
+	for len(b.recent) > 0 && now.Sub(b.recent[0]) > b.window {
+		b.recent = b.recent[1:]
+	}
+	if len(b.recent) >= b.failures {
+		b.open, b.openedAt = true, now
+		b.recent = b.recent[:0]
+		return fmt.Errorf("%w: %d failures within %v: %w", ErrCircuitOpen, b.failures, b.window, err)
+	}
+	return err
+}
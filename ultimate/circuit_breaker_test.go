@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_CircuitBreakerStopsRetries(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	downErr := errors.New("downstream unavailable")
+	calls := 0
+	consumer := Chain(ConsumerFunc(func(items []any) error {
+		calls++
+		return downErr
+	}), RetryMiddleware(10, 0, nil), CircuitBreakerMiddleware(3, time.Minute, nil))
+
+	err := Pipe(producer, consumer, 1)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.ErrorIs(t, err, downErr)
+	// После трёх ошибок попытки прекращаются, следующие батчи не обрабатываются
+	require.Equal(t, 3, calls)
+	require.Empty(t, producer.Committed())
+}
+
+func TestCircuitBreaker_Window(t *testing.T) {
+	clock := newFakeClock()
+	downErr := errors.New("downstream unavailable")
+	fail := true
+	calls := 0
+	consumer := Chain(ConsumerFunc(func(items []any) error {
+		calls++
+		if fail {
+			return downErr
+		}
+		return nil
+	}), CircuitBreakerMiddleware(2, time.Second, clock))
+
+	// Ошибки, разнесённые дальше окна, цепь не размыкают
+	require.ErrorIs(t, consumer.Process([]any{1}), downErr)
+	clock.Advance(2 * time.Second)
+	err := consumer.Process([]any{2})
+	require.ErrorIs(t, err, downErr)
+	require.NotErrorIs(t, err, ErrCircuitOpen)
+
+	// Успех сбрасывает счётчик
+	fail = false
+	require.NoError(t, consumer.Process([]any{3}))
+	fail = true
+	require.NotErrorIs(t, consumer.Process([]any{4}), ErrCircuitOpen)
+
+	// Вторая ошибка подряд в пределах окна размыкает цепь
+	require.ErrorIs(t, consumer.Process([]any{5}), ErrCircuitOpen)
+	require.Equal(t, 5, calls)
+
+	// Разомкнутая цепь не вызывает потребителя
+	require.ErrorIs(t, consumer.Process([]any{6}), ErrCircuitOpen)
+	require.Equal(t, 5, calls)
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	clock := newFakeClock()
+	downErr := errors.New("downstream unavailable")
+	fail := true
+	calls := 0
+	consumer := Chain(ConsumerFunc(func(items []any) error {
+		calls++
+		if fail {
+			return downErr
+		}
+		return nil
+	}), CircuitBreakerMiddleware(2, time.Second, clock))
+
+	require.ErrorIs(t, consumer.Process([]any{1}), downErr)
+	require.ErrorIs(t, consumer.Process([]any{2}), ErrCircuitOpen)
+	require.ErrorIs(t, consumer.Process([]any{3}), ErrCircuitOpen)
+	require.Equal(t, 2, calls)
+
+	// по истечении окна проходит одна проба; её ошибка снова размыкает цепь
+	clock.Advance(time.Second)
+	err := consumer.Process([]any{4})
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.ErrorIs(t, err, downErr)
+	require.Equal(t, 3, calls)
+	require.ErrorIs(t, consumer.Process([]any{5}), ErrCircuitOpen)
+	require.Equal(t, 3, calls)
+
+	// удачная проба замыкает цепь
+	clock.Advance(time.Second)
+	fail = false
+	require.NoError(t, consumer.Process([]any{6}))
+	require.NoError(t, consumer.Process([]any{7}))
+	require.Equal(t, 5, calls)
+
+	// после замыкания счётчик ошибок начинается заново
+	fail = true
+	require.NotErrorIs(t, consumer.Process([]any{8}), ErrCircuitOpen)
+}
+
+func TestCircuitBreaker_InvalidFailures(t *testing.T) {
+	for _, failures := range []int{0, -1} {
+		calls := 0
+		consumer := Chain(ConsumerFunc(func(items []any) error {
+			calls++
+			return nil
+		}), CircuitBreakerMiddleware(failures, time.Second, nil))
+
+		require.ErrorIs(t, consumer.Process([]any{1}), ErrInvalidArgument)
+		require.Zero(t, calls)
+	}
+}
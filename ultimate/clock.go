@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Clock — источник времени для pipeline. Через него идут все таймеры
+// и замеры, что позволяет подменить время в тестах.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer — минимальный интерфейс таймера, совместимый с time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock — Clock поверх пакета time
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// clockTimeoutCtx — контекст withClockTimeout. Err возвращает
+// context.DeadlineExceeded, как у context.WithTimeout, если его отменил
+// таймер, а не родитель или cancel.
+type clockTimeoutCtx struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c clockTimeoutCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func (c clockTimeoutCtx) Err() error {
+	err := c.Context.Err()
+	if err != nil && context.Cause(c.Context) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// withClockTimeout работает как context.WithTimeout, но отсчитывает d
+// по clock
+func withClockTimeout(parent context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	timer := clock.NewTimer(d)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+	return clockTimeoutCtx{Context: ctx, deadline: clock.Now().Add(d)}, func() { cancel(nil) }
+}
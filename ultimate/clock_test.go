@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock — управляемые часы: время идёт только через Advance
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.deadline = c.now.Add(d)
+	t.active = true
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance сдвигает время и срабатывают все наступившие таймеры
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.deadline.After(c.now) {
+			t.active = false
+			select {
+			case t.ch <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	ch       chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.deadline = t.clock.now.Add(d)
+	t.active = true
+	return wasActive
+}
+
+func TestPipe_FlushIntervalWithFakeClock(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	clock := newFakeClock()
+	maxItems := 10
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	// Пока источник отдаёт второй пакет, проходит интервал сброса
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once().
+		Run(func(mock.Arguments) { clock.Advance(time.Second) })
+	producer.On("Next").Return([]any{"item3"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Неполный буфер сброшен по таймеру, остаток — по EOF
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"item3"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+	producer.On("Commit", 3).Return(nil).Once()
+
+	err := Pipe(producer, consumer, maxItems, WithClock(clock), WithFlushInterval(time.Second))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_BackpressureTimeoutWithFakeClock(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &blockingConsumer{release: make(chan struct{})}
+	clock := newFakeClock()
+	maxItems := 2
+
+	producer.On("Commit", mock.Anything).Return(nil).Maybe()
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Times(3)
+	// Четвёртый Next — runNext упрётся в лимит, время уходит вперёд
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once().
+		Run(func(mock.Arguments) {
+			go func() {
+				// Ждём, пока runNext заведёт таймер ожидания
+				require.Eventually(t, func() bool {
+					clock.mu.Lock()
+					defer clock.mu.Unlock()
+					return len(clock.timers) > 0
+				}, time.Second, time.Millisecond)
+				clock.Advance(time.Minute)
+				close(consumer.release)
+			}()
+		})
+
+	err := Pipe(producer, consumer, maxItems, WithClock(clock), WithMaxBufferedItems(4, time.Minute))
+	require.ErrorIs(t, err, ErrBackpressureTimeout)
+}
@@ -0,0 +1,50 @@
+package main
+
+import "sync"
+
+// runCommitConcurrent раздаёт cookie пулу воркеров. Первая ошибка
+// останавливает остальные воркеры; уже начатые Commit завершаются. При
+// WithCommitDrain и WithAtLeastOnce отмена не останавливает воркеры: они
+// дофиксируют cookie обработанных батчей, пока канал не закроется.
+func (pp *pipe) runCommitConcurrent(cancelCh <-chan struct{}) error {
+	stopCh := make(chan struct{})
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for i := 0; i < pp.opts.commitConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cancelCh := cancelCh
+			for {
+				var cookie int
+				select {
+				case <-stopCh:
+					return
+				case <-cancelCh:
+					if !pp.drainOnCancel() {
+						return
+					}
+					cancelCh = nil
+					continue
+				case c, ok := <-pp.cookiesCh:
+					if !ok {
+						return
+					}
+					cookie = c
+				}
+				if err := pp.commit(cookie); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stopCh)
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// slowCommitter фиксирует cookie с задержкой и считает пик параллельности
+type slowCommitter struct {
+	*pipetest.MemorySource
+	active, peak atomic.Int32
+}
+
+func (s *slowCommitter) Commit(cookie int) error {
+	n := s.active.Add(1)
+	defer s.active.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return s.MemorySource.Commit(cookie)
+}
+
+func TestPipe_CommitConcurrencyCommitsAll(t *testing.T) {
+	steps := make([]int, 200)
+	for i := range steps {
+		steps[i] = 1
+	}
+	source := &slowCommitter{MemorySource: pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 200), steps...)}
+	sink := &pipetest.MemorySink{}
+
+	stats, err := PipeWithStats(source, sink, 10, WithCommitConcurrency(8))
+	require.NoError(t, err)
+	require.Equal(t, 200, stats.Commits)
+	require.Empty(t, stats.UncommittedCookies)
+	require.ElementsMatch(t, source.Cookies(), source.Committed())
+	require.Greater(t, source.peak.Load(), int32(1))
+}
+
+func TestPipe_CommitConcurrencyFailureAborts(t *testing.T) {
+	steps := make([]int, 200)
+	for i := range steps {
+		steps[i] = 1
+	}
+	commitErr := errors.New("commit error")
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 200), steps...)
+	source.FailOn = map[int]error{50: commitErr}
+	sink := &pipetest.MemorySink{}
+
+	stats, err := PipeWithStats(source, sink, 10, WithCommitConcurrency(8))
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.ErrorIs(t, err, commitErr)
+
+	require.NotContains(t, source.Committed(), 50)
+	require.Contains(t, stats.UncommittedCookies, 50)
+	require.Less(t, len(source.Committed()), 200)
+}
+
+func TestPipe_CommitConcurrencyDrainOnCancel(t *testing.T) {
+	for name, opt := range map[string]Option{"drain": WithCommitDrain(), "at-least-once": WithAtLeastOnce()} {
+		t.Run(name, func(t *testing.T) {
+			steps := make([]int, 60)
+			for i := range steps {
+				steps[i] = 1
+			}
+			source := &slowCommitter{MemorySource: pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 60), steps...)}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var batches atomic.Int32
+			// к обработке пятого батча cookie 1..40 уже отданы в фиксацию
+			consumer := ConsumerFunc(func([]any) error {
+				if batches.Add(1) == 5 {
+					cancel()
+				}
+				return nil
+			})
+
+			_, err := PipeContext(ctx, source, consumer, 10, WithCommitConcurrency(8), opt)
+			if err != nil {
+				require.ErrorIs(t, err, context.Canceled)
+			}
+			committed := source.Committed()
+			for cookie := 1; cookie <= 40; cookie++ {
+				require.Contains(t, committed, cookie)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// BatchCommitter — источник, умеющий зафиксировать несколько cookie одним
+// вызовом. Используется WithCommitDebounce.
+type BatchCommitter interface {
+	CommitBatch(cookies []int) error
+}
+
+// runCommitDebounced — стадия Commit для WithCommitDebounce
+func (pp *pipe) runCommitDebounced(cancelCh <-chan struct{}) error {
+	var pending []int
+	var timer Timer
+	var timerC <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case cookie, ok := <-pp.cookiesCh:
+			if !ok {
+				return pp.commitPending(pending)
+			}
+			pending = append(pending, cookie)
+			if timer == nil {
+				timer = pp.opts.clock.NewTimer(pp.opts.commitDebounce)
+				timerC = timer.C()
+			}
+		case <-timerC:
+			if err := pp.commitPending(pending); err != nil {
+				return err
+			}
+			pending = nil
+			timer, timerC = nil, nil
+		case <-cancelCh:
+			if !pp.drainOnCancel() {
+				return nil
+			}
+			// cookie уже обработанных батчей: и накопленные, и ждущие в канале
+			for {
+				select {
+				case cookie, ok := <-pp.cookiesCh:
+					if ok {
+						pending = append(pending, cookie)
+						continue
+					}
+				default:
+				}
+				return pp.commitPending(pending)
+			}
+		}
+	}
+}
+
+// commitPending фиксирует накопленную пачку cookie
+func (pp *pipe) commitPending(cookies []int) error {
+	if len(cookies) == 0 {
+		return nil
+	}
+	// в режиме смещений меньшие cookie подтверждаются максимальным и
+	// отдельно не фиксируются, но в журнале их тоже нужно подтвердить
+	var covered []int
+	if pp.opts.offsetCommit {
+		high := slices.Max(cookies)
+		for _, cookie := range cookies {
+			if cookie != high {
+				covered = append(covered, cookie)
+			}
+		}
+		pp.uncommitted.release(len(covered))
+		cookies = []int{high}
+	}
+	if err := pp.commitCookieBatch(cookies); err != nil {
+		return err
+	}
+	return pp.ackCommit(covered...)
+}
+
+// commitCookieBatch фиксирует cookies одним CommitBatch, если источник его
+// поддерживает, иначе по одному
+func (pp *pipe) commitCookieBatch(cookies []int) error {
+	bc, ok := pp.p.(BatchCommitter)
+	if !ok || pp.opts.dryRun {
+		for _, cookie := range cookies {
+			if err := pp.commit(cookie); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pp.enterStage(StageCommit)
+	err := pp.withRetry(func() error { return bc.CommitBatch(cookies) })
+	pp.leaveStage(StageCommit)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrCommitFailed, err)
+		pp.tracing.commitFailed(cookies[0], err)
+		return err
+	}
+	for _, cookie := range cookies {
+		if err := pp.committed(cookie); err != nil {
+			return err
+		}
+	}
+	return nil
+}
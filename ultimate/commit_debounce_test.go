@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// feedProducer отдаёт результаты из канала feed; закрытие канала — EOF.
+// CommitBatch записывает пачки cookie.
+type feedProducer struct {
+	feed chan int
+
+	mu      sync.Mutex
+	batches [][]int
+}
+
+func (p *feedProducer) Next() ([]any, int, error) {
+	cookie, ok := <-p.feed
+	if !ok {
+		return nil, 0, ErrEofCommitCookie
+	}
+	return []any{cookie}, cookie, nil
+}
+
+func (p *feedProducer) Commit(cookie int) error {
+	panic("CommitBatch must be used")
+}
+
+func (p *feedProducer) CommitBatch(cookies []int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches = append(p.batches, slices.Clone(cookies))
+	return nil
+}
+
+func (p *feedProducer) committedBatches() [][]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.batches)
+}
+
+// activeTimers возвращает число взведённых таймеров fakeClock
+func (c *fakeClock) activeTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPipe_CommitDebounceGroupsByWindow(t *testing.T) {
+	clock := newFakeClock()
+	producer := &feedProducer{feed: make(chan int)}
+	consumer := ConsumerFunc(func(items []any) error { return nil })
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := PipeContext(context.Background(), producer, consumer, 0,
+			WithClock(clock), WithCommitDebounce(time.Second))
+		errCh <- err
+	}()
+
+	// Первый cookie открывает окно; по его истечении пачка фиксируется
+	producer.feed <- 1
+	require.Eventually(t, func() bool { return clock.activeTimers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool { return len(producer.committedBatches()) == 1 }, time.Second, time.Millisecond)
+
+	// Следующее окно копит cookie 2 и 3, остаток фиксируется при завершении
+	producer.feed <- 2
+	require.Eventually(t, func() bool { return clock.activeTimers() == 1 }, time.Second, time.Millisecond)
+	producer.feed <- 3
+	close(producer.feed)
+
+	require.NoError(t, <-errCh)
+	require.Equal(t, [][]int{{1}, {2, 3}}, producer.committedBatches())
+}
+
+func TestPipe_CommitDebounceWithoutBatchCommitter(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	consumer.On("Process", []any{"item2"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	stats, err := PipeWithStats(producer, consumer, 1, WithClock(newFakeClock()), WithCommitDebounce(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, stats.CommittedCookies)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
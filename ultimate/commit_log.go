@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// CommitLog — журнал намерений фиксации для семантики exactly-once. Pipe
+// записывает cookie батча в журнал до вызова Commit и подтверждает каждый
+// после успешной фиксации. Если процесс упал между записью и фиксацией,
+// следующий запуск с тем же журналом до чтения источника дофиксирует
+// записанные, но не подтверждённые cookie. Commit источника должен
+// допускать повторную фиксацию того же cookie: падение возможно и между
+// Commit и Ack.
+type CommitLog interface {
+	// Record сохраняет намерение зафиксировать cookies
+	Record(cookies []int) error
+	// Committed возвращает cookie, записанные через Record, но ещё не
+	// подтверждённые через Ack, в порядке записи
+	Committed() ([]int, error)
+	// Ack подтверждает, что cookies зафиксированы в источнике
+	Ack(cookies []int) error
+}
+
+// recoverCommits дофиксирует cookie, оставшиеся в журнале от прошлого запуска
+func (pp *pipe) recoverCommits() error {
+	if pp.opts.commitLog == nil {
+		return nil
+	}
+	pending, err := pp.opts.commitLog.Committed()
+	if err != nil {
+		return fmt.Errorf("%w: commit log: %w", ErrCommitFailed, err)
+	}
+	for _, cookie := range pending {
+		if err := pp.p.Commit(cookie); err != nil {
+			return fmt.Errorf("%w: recover cookie %d: %w", ErrCommitFailed, cookie, err)
+		}
+		if err := pp.opts.commitLog.Ack([]int{cookie}); err != nil {
+			return fmt.Errorf("%w: commit log: %w", ErrCommitFailed, err)
+		}
+	}
+	return nil
+}
+
+// recordCommits записывает в журнал cookie обработанного батча до их фиксации
+func (pp *pipe) recordCommits(cookies []int) error {
+	if pp.opts.commitLog == nil || len(cookies) == 0 {
+		return nil
+	}
+	if err := pp.opts.commitLog.Record(cookies); err != nil {
+		return fmt.Errorf("%w: commit log: %w", ErrCommitFailed, err)
+	}
+	return nil
+}
+
+// ackCommit подтверждает в журнале зафиксированные cookies
+func (pp *pipe) ackCommit(cookies ...int) error {
+	if pp.opts.commitLog == nil || len(cookies) == 0 {
+		return nil
+	}
+	if err := pp.opts.commitLog.Ack(cookies); err != nil {
+		return fmt.Errorf("%w: commit log: %w", ErrCommitFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// memCommitLog — журнал фиксаций в памяти, переживающий «перезапуск» Pipe
+type memCommitLog struct {
+	mu      sync.Mutex
+	pending []int
+}
+
+func (l *memCommitLog) Record(cookies []int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = append(l.pending, cookies...)
+	return nil
+}
+
+func (l *memCommitLog) Committed() ([]int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.pending), nil
+}
+
+func (l *memCommitLog) Ack(cookies []int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, cookie := range cookies {
+		if i := slices.Index(l.pending, cookie); i >= 0 {
+			l.pending = slices.Delete(l.pending, i, i+1)
+		}
+	}
+	return nil
+}
+
+func TestPipe_CommitLogRecoversAfterCrash(t *testing.T) {
+	log := &memCommitLog{}
+
+	// Первый запуск «падает» между записью намерения и фиксацией cookie 2
+	first := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	first.FailOn = map[int]error{2: errors.New("crash")}
+	err := Pipe(first, &pipetest.RecordingConsumer{}, 1, WithCommitLog(log))
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.Equal(t, []int{1}, first.Committed())
+	pending, _ := log.Committed()
+	require.Equal(t, []int{2}, pending)
+
+	// Перезапуск: сначала дофиксируется cookie 2, затем читается источник
+	second := pipetest.NewMemorySource(ErrEofCommitCookie, []any{3}, 1)
+	err = Pipe(second, &pipetest.RecordingConsumer{}, 1, WithCommitLog(log))
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 1}, second.Committed())
+	pending, _ = log.Committed()
+	require.Empty(t, pending)
+}
+
+func TestPipe_CommitLogRecoveryFailureStopsPipe(t *testing.T) {
+	log := &memCommitLog{pending: []int{7}}
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1}, 1)
+	producer.FailOn = map[int]error{7: errors.New("source unavailable")}
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 1, WithCommitLog(log))
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.Empty(t, consumer.Batches())
+	require.Empty(t, producer.Cookies())
+	pending, _ := log.Committed()
+	require.Equal(t, []int{7}, pending)
+}
+
+func TestPipe_CommitLogCommitAtEndRecordsNothingOnFailure(t *testing.T) {
+	log := &memCommitLog{}
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	consumer := &pipetest.RecordingConsumer{Fail: func(items []any) error {
+		if items[0] == 2 {
+			return errors.New("consumer error")
+		}
+		return nil
+	}}
+
+	err := Pipe(producer, consumer, 1, WithCommitLog(log), WithCommitMode(CommitAtEnd))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	pending, _ := log.Committed()
+	require.Empty(t, pending)
+}
+
+func TestPipe_CommitLogDebouncedOffsetsRestart(t *testing.T) {
+	log := &memCommitLog{}
+	opts := []Option{WithCommitLog(log), WithOffsetCommitMode(), WithClock(newFakeClock()), WithCommitDebounce(time.Hour)}
+
+	// окно не истекает, и cookie 1–4 сворачиваются в одну фиксацию 4
+	first := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4}, 1, 1, 1, 1)
+	require.NoError(t, Pipe(first, &pipetest.RecordingConsumer{}, 1, opts...))
+	require.Equal(t, []int{4}, first.Committed())
+	pending, _ := log.Committed()
+	require.Empty(t, pending)
+
+	// перезапуск не дофиксирует меньшие cookie и не откатывает смещение
+	second := pipetest.NewMemorySource(ErrEofCommitCookie, []any{5}, 1)
+	require.NoError(t, Pipe(second, &pipetest.RecordingConsumer{}, 1, opts...))
+	require.Equal(t, []int{1}, second.Committed())
+}
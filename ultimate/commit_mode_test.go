@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_CommitPerBatchCommitsBeforeLaterProcess(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	committed := make(chan struct{})
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) { close(committed) })
+	// Второй батч обрабатывается только после фиксации первого cookie
+	consumer.On("Process", []any{"item2"}).Return(nil).Once().Run(func(mock.Arguments) { <-committed })
+	producer.On("Commit", 2).Return(nil).Once()
+
+	err := Pipe(producer, consumer, maxItems, WithCommitMode(CommitPerBatch))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_CommitAtEnd(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	processedAll := make(chan struct{})
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	consumer.On("Process", []any{"item2"}).Return(nil).Once().Run(func(mock.Arguments) { close(processedAll) })
+
+	// Фиксация начинается только после обработки всех батчей
+	assertAfterProcess := func(mock.Arguments) {
+		select {
+		case <-processedAll:
+		default:
+			t.Error("commit before all batches were processed")
+		}
+	}
+	producer.On("Commit", 1).Return(nil).Once().Run(assertAfterProcess)
+	producer.On("Commit", 2).Return(nil).Once().Run(assertAfterProcess)
+
+	err := Pipe(producer, consumer, maxItems, WithCommitMode(CommitAtEnd))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_CommitAtEndNothingOnFailure(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	consumer.On("Process", []any{"item2"}).Return(errors.New("consumer error")).Once()
+
+	stats, err := PipeWithStats(producer, consumer, maxItems, WithCommitMode(CommitAtEnd))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	// cookie упавшего батча — необработанные, а не незафиксированные
+	require.Equal(t, []int{1}, stats.UncommittedCookies)
+	require.Equal(t, []int{2}, stats.UnprocessedCookies)
+
+	producer.AssertNotCalled(t, "Commit", mock.Anything)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_CommitAtEndNothingOnNextFailure(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, errors.New("producer error")).Once()
+	consumer.On("Process", mock.Anything).Return(nil).Maybe()
+
+	err := Pipe(producer, consumer, maxItems, WithCommitMode(CommitAtEnd))
+	require.ErrorIs(t, err, ErrNextFailed)
+
+	producer.AssertNotCalled(t, "Commit", mock.Anything)
+}
+
+func TestPipe_InlineCommit(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 2
+
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"item4"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"item3", "item4"}).Return(nil).Once()
+
+	var commits []int
+	producer.On("Commit", mock.Anything).Return(nil).Times(3).Run(func(args mock.Arguments) {
+		commits = append(commits, args.Int(0))
+	})
+
+	opts := []Option{WithInlineCommit()}
+
+	// Стадии Commit нет — только Next и Process, и канала к ней тоже
+	pp := newPipe(producer, consumer, maxItems, opts)
+	require.Len(t, pp.pipeline().stages, 2)
+	require.Nil(t, pp.cookiesCh)
+
+	err := Pipe(producer, consumer, maxItems, opts...)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, commits)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_InlineCommitError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 2
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+
+	commitErr := errors.New("commit error")
+	producer.On("Commit", 1).Return(commitErr).Once()
+
+	err := Pipe(producer, consumer, maxItems, WithInlineCommit())
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.ErrorIs(t, err, commitErr)
+
+	producer.AssertNotCalled(t, "Commit", 2)
+}
+
+func TestPipe_OffsetCommitMaxCookie(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"a"}, 3, nil).Once()
+	producer.On("Next").Return([]any{"b"}, 4, nil).Once()
+	producer.On("Next").Return([]any{"c"}, 5, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"a", "b", "c"}).Return(nil).Once()
+	// Commit(5) подтверждает и 3, и 4
+	producer.On("Commit", 5).Return(nil).Once()
+
+	stats, err := PipeWithStats(producer, consumer, 10, WithOffsetCommitMode())
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 4, 5}, stats.CommittedCookies)
+	require.Empty(t, stats.UncommittedCookies)
+
+	producer.AssertExpectations(t)
+	producer.AssertNumberOfCalls(t, "Commit", 1)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_OffsetCommitRunningMax(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"a"}, 7, nil).Once()
+	producer.On("Next").Return([]any{"b"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"c"}, 9, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(nil)
+	// Батч с cookie 2 уже подтверждён смещением 7 и повторно не фиксируется
+	producer.On("Commit", 7).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 1, WithOffsetCommitMode())
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	producer.AssertNumberOfCalls(t, "Commit", 2)
+}
+
+func TestPipe_OffsetCommitAtEnd(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"a"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"b"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(nil)
+	producer.On("Commit", 2).Return(nil).Once()
+
+	stats, err := PipeWithStats(producer, consumer, 1, WithOffsetCommitMode(), WithCommitMode(CommitAtEnd))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, stats.CommittedCookies)
+
+	producer.AssertExpectations(t)
+	producer.AssertNumberOfCalls(t, "Commit", 1)
+}
+
+func TestPipe_CommitDrainOnCancel(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	processed := make(chan struct{})
+	release := make(chan struct{})
+	for i := 1; i <= 4; i++ {
+		producer.On("Next").Return([]any{i}, i, nil).Once()
+	}
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{1}).Return(nil).Once()
+	consumer.On("Process", []any{2}).Return(nil).Once()
+	consumer.On("Process", []any{3}).Return(nil).Once()
+	// К обработке четвёртого батча cookie 2 и 3 уже лежат в канале
+	consumer.On("Process", []any{4}).Return(nil).Once().Run(func(mock.Arguments) { close(processed) })
+	// Commit(1) висит, пока не отменён контекст
+	producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) { <-release })
+	producer.On("Commit", 2).Return(nil).Once()
+	producer.On("Commit", 3).Return(nil).Once()
+	producer.On("Commit", 4).Return(nil).Maybe()
+
+	go func() {
+		<-processed
+		cancel()
+		close(release)
+	}()
+
+	stats, err := PipeContext(ctx, producer, consumer, 1, WithCommitDrain())
+	if err != nil {
+		require.ErrorIs(t, err, context.Canceled)
+	}
+	require.GreaterOrEqual(t, len(stats.CommittedCookies), 3)
+	require.Equal(t, []int{1, 2, 3}, stats.CommittedCookies[:3])
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_CommitDrainAfterProcessFailure(t *testing.T) {
+	for _, drain := range []bool{false, true} {
+		t.Run(fmt.Sprintf("drain=%v", drain), func(t *testing.T) {
+			producer := &MockProducer{}
+			consumer := &MockConsumer{}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			failing := make(chan struct{})
+			producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+			producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+			producer.On("Next").Return([]any{"item3"}, 3, nil).Once()
+			producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+			consumer.On("Process", []any{"item1"}).Return(nil).Once()
+			consumer.On("Process", []any{"item2"}).Return(nil).Once()
+			// падение третьего батча отменяет запуск вместе со стадией Commit
+			consumer.On("Process", []any{"item3"}).Return(errors.New("consumer error")).Once().
+				Run(func(mock.Arguments) {
+					cancel()
+					close(failing)
+				})
+			// Фиксация первого батча завершается уже после отмены, когда
+			// cookie 2 ждёт в очереди
+			producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) {
+				<-failing
+				time.Sleep(20 * time.Millisecond)
+			})
+			var opts []Option
+			if drain {
+				producer.On("Commit", 2).Return(nil).Once()
+				opts = append(opts, WithCommitDrain())
+			}
+
+			stats, err := PipeContext(ctx, producer, consumer, 1, opts...)
+			require.ErrorIs(t, err, ErrProcessFailed)
+			require.Equal(t, []int{3}, stats.UnprocessedCookies)
+			if drain {
+				require.Equal(t, []int{1, 2}, stats.CommittedCookies)
+				require.Empty(t, stats.UncommittedCookies)
+			} else {
+				require.Equal(t, []int{1}, stats.CommittedCookies)
+				require.Equal(t, []int{2}, stats.UncommittedCookies)
+			}
+
+			producer.AssertExpectations(t)
+			consumer.AssertExpectations(t)
+		})
+	}
+}
+
+// endlessRecorder — бесконечный источник, записывающий фиксации
+type endlessRecorder struct {
+	endlessProducer
+	pipetest.RecordingCommitter
+}
+
+func (p *endlessRecorder) Commit(cookie int) error {
+	return p.RecordingCommitter.Commit(cookie)
+}
+
+func TestPipe_CommitAtEndNothingOnCancel(t *testing.T) {
+	producer := &endlessRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var processed atomic.Int32
+	// поток прерывается отменой без ошибок стадий
+	consumer := ConsumerFunc(func([]any) error {
+		if processed.Add(1) == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	_, err := PipeContext(ctx, producer, consumer, 1, WithCommitMode(CommitAtEnd))
+	if err != nil {
+		require.ErrorIs(t, err, context.Canceled)
+	}
+	require.GreaterOrEqual(t, processed.Load(), int32(3))
+	require.Empty(t, producer.Committed())
+}
@@ -0,0 +1,94 @@
+package main
+
+import "sync"
+
+// commitLatch отслеживает зафиксированные cookie для Controller.WaitCommit.
+// Запоминать их нужно, только если WaitCommit доступен, то есть при
+// PipeControlled: иначе множество росло бы с каждым cookie запуска.
+type commitLatch struct {
+	mu         sync.Mutex
+	track      bool
+	committed  map[int]struct{}
+	through    int
+	throughSet bool
+	waiters    map[int]chan struct{}
+	ended      bool
+}
+
+// WaitCommit возвращает канал, который закрывается, когда cookie
+// зафиксирован, а если этого так и не произошло — по завершении pipeline.
+// Чтобы отличить одно от другого, после завершения стоит проверить
+// CommittedCookies в статистике Wait. В режиме смещений cookie считается
+// зафиксированным вместе с любым большим. Безопасен для вызова из любой
+// горутины, в том числе до и после фиксации.
+func (ctrl *Controller) WaitCommit(cookie int) <-chan struct{} {
+	l := &ctrl.commits
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ch, ok := l.waiters[cookie]; ok {
+		return ch
+	}
+	ch := make(chan struct{})
+	if l.ended || l.isCommittedLocked(cookie) {
+		close(ch)
+		return ch
+	}
+	if l.waiters == nil {
+		l.waiters = make(map[int]chan struct{})
+	}
+	l.waiters[cookie] = ch
+	return ch
+}
+
+func (l *commitLatch) isCommittedLocked(cookie int) bool {
+	if l.throughSet && cookie <= l.through {
+		return true
+	}
+	_, ok := l.committed[cookie]
+	return ok
+}
+
+// commit отмечает cookie зафиксированным
+func (l *commitLatch) commit(cookie int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.track {
+		if l.committed == nil {
+			l.committed = make(map[int]struct{})
+		}
+		l.committed[cookie] = struct{}{}
+	}
+	l.releaseLocked(cookie)
+}
+
+// commitThrough отмечает зафиксированными cookie до cookie включительно
+func (l *commitLatch) commitThrough(cookie int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.throughSet && cookie <= l.through {
+		return
+	}
+	l.through, l.throughSet = cookie, true
+	for waiting := range l.waiters {
+		if waiting <= cookie {
+			l.releaseLocked(waiting)
+		}
+	}
+}
+
+// end будит всех ожидающих по завершении pipeline
+func (l *commitLatch) end() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ended = true
+	for cookie := range l.waiters {
+		l.releaseLocked(cookie)
+	}
+}
+
+func (l *commitLatch) releaseLocked(cookie int) {
+	if ch, ok := l.waiters[cookie]; ok {
+		close(ch)
+		delete(l.waiters, cookie)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// CompressingConsumer сжимает каждый батч функцией compress и передаёт
+// результат в BytesConsumer одним элементом. Так сжатие остаётся вне
+// потребителя, который принимает готовую полезную нагрузку, например
+// тело запроса к сетевому приёмнику. Cookie батча фиксируются после того,
+// как потребитель принял сжатые данные.
+type CompressingConsumer struct {
+	compress func(items []any) ([]byte, error)
+	c        BytesConsumer
+}
+
+// NewCompressingConsumer создаёт потребителя, сжимающего батчи для c.
+// Подходящая функция сжатия — GzipJSON.
+func NewCompressingConsumer(compress func(items []any) ([]byte, error), c BytesConsumer) *CompressingConsumer {
+	return &CompressingConsumer{compress: compress, c: c}
+}
+
+func (cc *CompressingConsumer) Process(items []any) error {
+	data, err := cc.compress(items)
+	if err != nil {
+		return fmt.Errorf("compress %d items: %w", len(items), err)
+	}
+	return cc.c.Process([][]byte{data})
+}
+
+// gzipWriters переиспользует gzip.Writer между батчами: его внутренние
+// буферы занимают сотни килобайт
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// GzipJSON кодирует батч JSON-массивом и сжимает его gzip
+func GzipJSON(items []any) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+	zw.Reset(&buf)
+	if err := json.NewEncoder(zw).Encode(items); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadSink запоминает полученные сжатые батчи
+type payloadSink struct {
+	payloads [][]byte
+	err      error
+}
+
+func (s *payloadSink) Process(items [][]byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.payloads = append(s.payloads, items...)
+	return nil
+}
+
+func gunzipJSON(t *testing.T, data []byte) []any {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	var items []any
+	require.NoError(t, json.Unmarshal(raw, &items))
+	return items
+}
+
+func TestCompressingConsumer_GzipRoundTrip(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a", "b", "c", "d", "e"}, 2, 2, 1)
+	sink := &payloadSink{}
+
+	err := Pipe(source, NewCompressingConsumer(GzipJSON, sink), 2)
+	require.NoError(t, err)
+	require.Len(t, sink.payloads, 3)
+	var items []any
+	for _, payload := range sink.payloads {
+		items = append(items, gunzipJSON(t, payload)...)
+	}
+	require.Equal(t, []any{"a", "b", "c", "d", "e"}, items)
+	require.Equal(t, []int{1, 2, 3}, source.Committed())
+}
+
+func TestCompressingConsumer_Errors(t *testing.T) {
+	t.Run("compress", func(t *testing.T) {
+		source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{func() {}})
+		err := Pipe(source, NewCompressingConsumer(GzipJSON, &payloadSink{}), 1)
+		require.ErrorIs(t, err, ErrProcessFailed)
+		require.ErrorContains(t, err, "compress 1 items")
+		require.Empty(t, source.Committed())
+	})
+
+	t.Run("sink rejects payload", func(t *testing.T) {
+		rejected := errors.New("payload rejected")
+		source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1})
+		err := Pipe(source, NewCompressingConsumer(GzipJSON, &payloadSink{err: rejected}), 1)
+		require.ErrorIs(t, err, rejected)
+		require.Empty(t, source.Committed())
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ConcurrentMultiProducer объединяет источники, как MultiProducer, но
+// опрашивает каждый в своей горутине: медленный источник, зависший в Next,
+// не задерживает остальные. Результаты идут в порядке готовности, порядок
+// внутри одного источника сохраняется. Cookie кодируются так же, как в
+// MultiProducer.
+type ConcurrentMultiProducer struct {
+	ctx       context.Context
+	producers []Producer
+	buffer    int
+
+	start   sync.Once
+	results chan multiResult
+}
+
+// multiResult — результат Next одного из источников
+type multiResult struct {
+	idx    int
+	items  []any
+	cookie int
+	err    error
+}
+
+// NewConcurrentMultiProducer создаёт источник поверх producers. buffer —
+// сколько готовых результатов может ждать Next сверх одного на источник.
+// Горутины опроса запускаются первым вызовом Next и завершаются, когда
+// исчерпан их источник, когда он вернул ошибку или когда отменён ctx.
+func NewConcurrentMultiProducer(ctx context.Context, buffer int, producers ...Producer) *ConcurrentMultiProducer {
+	return &ConcurrentMultiProducer{ctx: ctx, producers: producers, buffer: buffer}
+}
+
+// Next возвращает очередной готовый результат любого источника.
+// ErrEofCommitCookie возвращается, только когда исчерпаны все источники.
+func (m *ConcurrentMultiProducer) Next() ([]any, int, error) {
+	m.start.Do(m.poll)
+	select {
+	case r, ok := <-m.results:
+		if !ok {
+			return nil, 0, ErrEofCommitCookie
+		}
+		if r.err != nil {
+			return nil, 0, fmt.Errorf("producer %d: %w", r.idx, r.err)
+		}
+		return r.items, encodeCookie(len(m.producers), r.idx, r.cookie), nil
+	case <-m.ctx.Done():
+		return nil, 0, m.ctx.Err()
+	}
+}
+
+// Commit фиксирует cookie в том источнике, который его выдал
+func (m *ConcurrentMultiProducer) Commit(cookie int) error {
+	idx, inner := decodeCookie(len(m.producers), cookie)
+	if idx >= len(m.producers) {
+		return fmt.Errorf("unknown producer %d for cookie %d", idx, cookie)
+	}
+	return m.producers[idx].Commit(inner)
+}
+
+// poll запускает по горутине на источник
+func (m *ConcurrentMultiProducer) poll() {
+	m.results = make(chan multiResult, max(m.buffer, 0))
+	var wg sync.WaitGroup
+	for idx, p := range m.producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.pollProducer(idx, p)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(m.results)
+	}()
+}
+
+func (m *ConcurrentMultiProducer) pollProducer(idx int, p Producer) {
+	for {
+		items, cookie, err := p.Next()
+		eof := isEOF(err)
+		if eof && len(items) == 0 {
+			return
+		}
+		if eof {
+			// последние элементы пришли вместе с EOF
+			err = nil
+		}
+		select {
+		case m.results <- multiResult{idx: idx, items: items, cookie: cookie, err: err}:
+		case <-m.ctx.Done():
+			return
+		}
+		if eof || err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// slowProducer отдаёт один элемент, только когда открыт gate
+type slowProducer struct {
+	pipetest.RecordingCommitter
+	gate chan struct{}
+	done bool
+}
+
+func (p *slowProducer) Next() ([]any, int, error) {
+	if p.done {
+		return nil, 0, ErrEofCommitCookie
+	}
+	<-p.gate
+	p.done = true
+	return []any{"slow"}, 1, nil
+}
+
+func TestConcurrentMultiProducer_SlowProducerDoesNotBlockOthers(t *testing.T) {
+	slow := &slowProducer{gate: make(chan struct{})}
+	fast := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"f1", "f2", "f3"}, 1, 1, 1)
+
+	var mu sync.Mutex
+	var processed []any
+	fastDone := make(chan struct{})
+	consumer := ConsumerFunc(func(items []any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, items...)
+		if len(processed) == 3 {
+			close(fastDone)
+		}
+		return nil
+	})
+
+	producer := NewConcurrentMultiProducer(context.Background(), 0, slow, fast)
+	errCh := make(chan error, 1)
+	go func() { errCh <- Pipe(producer, consumer, 0) }()
+
+	// Быстрый источник обработан целиком, пока медленный висит в Next
+	select {
+	case <-fastDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast producer was blocked by the slow one")
+	}
+	mu.Lock()
+	require.Equal(t, []any{"f1", "f2", "f3"}, processed)
+	mu.Unlock()
+
+	close(slow.gate)
+	require.NoError(t, <-errCh)
+	require.Equal(t, []any{"f1", "f2", "f3", "slow"}, processed)
+	require.Equal(t, []int{1, 2, 3}, fast.Committed())
+	require.Equal(t, []int{1}, slow.Committed())
+}
+
+func TestConcurrentMultiProducer_Error(t *testing.T) {
+	failing := pipetest.NewScriptedProducer(ErrEofCommitCookie, pipetest.Step{Err: errors.New("source down")})
+	ok := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1}, 1)
+
+	producer := NewConcurrentMultiProducer(context.Background(), 1, failing, ok)
+	err := Pipe(producer, pipetest.NullConsumer{}, 1)
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.ErrorContains(t, err, "producer 0: source down")
+}
+
+func TestConcurrentMultiProducer_ContextCancel(t *testing.T) {
+	slow := &slowProducer{gate: make(chan struct{})}
+	defer close(slow.gate)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	producer := NewConcurrentMultiProducer(ctx, 0, slow)
+	cancel()
+	_, _, err := producer.Next()
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type traceKey struct{}
+
+// ctxConsumer запоминает значение trace из контекста каждого батча
+type ctxConsumer struct {
+	traces []any
+}
+
+func (c *ctxConsumer) Process(items []any) error {
+	panic("ProcessCtx must be preferred")
+}
+
+func (c *ctxConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	c.traces = append(c.traces, ctx.Value(traceKey{}))
+	return nil
+}
+
+func TestPipeContext_ValueVisibleInProcessCtx(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &ctxConsumer{}
+	maxItems := 1
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-42")
+	_, err := PipeContext(ctx, producer, consumer, maxItems)
+	require.NoError(t, err)
+	require.Equal(t, []any{"trace-42", "trace-42"}, consumer.traces)
+
+	producer.AssertExpectations(t)
+}
+
+func TestPipeContext_Cancel(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once().Run(func(mock.Arguments) { cancel() })
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Maybe()
+	consumer.On("Process", mock.Anything).Return(nil).Maybe()
+	producer.On("Commit", mock.Anything).Return(nil).Maybe()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := PipeContext(ctx, producer, consumer, maxItems)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("pipeline did not stop on context cancel")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Controller управляет pipeline, запущенным через PipeControlled
+type Controller struct {
+	mu   sync.Mutex
+	gate chan struct{} // закрыт, пока pipeline не на паузе
+
+	done  chan struct{}
+	stats PipeStats
+	err   error
+
+	buffered atomic.Int64 // элементов в буфере runNext
+	flushNow atomic.Bool  // запрошен FlushNow
+	// будит runNext, ждущего Next; есть только у PipeControlled
+	flushWake chan struct{}
+	health    pipeHealth
+
+	current *currentBatch // батч в стадии Process, защищён mu
+	commits commitLatch
+
+	abortOnce sync.Once
+	aborted   chan struct{}
+	abortErr  error
+}
+
+func newController() *Controller {
+	gate := make(chan struct{})
+	close(gate)
+	return &Controller{gate: gate, done: make(chan struct{}), aborted: make(chan struct{})}
+}
+
+// PipeControlled запускает Pipe в фоне и возвращает Controller для
+// управления им. Результат запуска возвращает Wait.
+func PipeControlled(p Producer, c Consumer, maxItems int, opts ...Option) *Controller {
+	ctrl := newController()
+	ctrl.flushWake = make(chan struct{}, 1)
+	ctrl.commits.track = true
+	if err := validateArgs(p, c); err != nil {
+		ctrl.finish(PipeStats{}, err)
+		return ctrl
+	}
+
+	pp := newPipe(p, c, maxItems, opts)
+	pp.ctrl = ctrl
+	go func() {
+		err := pp.run(context.Background())
+		ctrl.finish(pp.stats.snapshot(), err)
+	}()
+	return ctrl
+}
+
+// Pause останавливает чтение из источника: runNext сбрасывает текущий буфер
+// в обработку и перестаёт вызывать Next. Уже отправленные батчи
+// обрабатываются и фиксируются как обычно.
+func (ctrl *Controller) Pause() {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	if ctrl.isPausedLocked() {
+		return
+	}
+	ctrl.gate = make(chan struct{})
+}
+
+// Resume продолжает чтение из источника после Pause
+func (ctrl *Controller) Resume() {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	if !ctrl.isPausedLocked() {
+		return
+	}
+	close(ctrl.gate)
+}
+
+// BufferedItems возвращает число элементов, накопленных в буфере runNext и
+// ещё не отправленных в обработку; после завершения pipeline — 0. Безопасен
+// для вызова из любой горутины.
+func (ctrl *Controller) BufferedItems() int {
+	return int(ctrl.buffered.Load())
+}
+
+// Done закрывается по завершении pipeline
+func (ctrl *Controller) Done() <-chan struct{} {
+	return ctrl.done
+}
+
+// Wait ждёт завершения pipeline и возвращает его статистику и ошибку
+func (ctrl *Controller) Wait() (PipeStats, error) {
+	<-ctrl.done
+	return ctrl.stats, ctrl.err
+}
+
+func (ctrl *Controller) finish(stats PipeStats, err error) {
+	ctrl.stats = stats
+	ctrl.err = err
+	ctrl.commits.end()
+	close(ctrl.done)
+}
+
+// paused возвращает канал паузы, если pipeline на паузе
+func (ctrl *Controller) paused() (<-chan struct{}, bool) {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	return ctrl.gate, ctrl.isPausedLocked()
+}
+
+func (ctrl *Controller) isPausedLocked() bool {
+	select {
+	case <-ctrl.gate:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedProducer отдаёт total пакетов по одному элементу и на вызове
+// номер blockAt ждёт, пока тест не откроет proceed
+type gatedProducer struct {
+	total   int
+	blockAt int
+	entered chan struct{}
+	proceed chan struct{}
+
+	calls   atomic.Int64
+	commits atomic.Int64
+}
+
+func newGatedProducer(total, blockAt int) *gatedProducer {
+	return &gatedProducer{
+		total:   total,
+		blockAt: blockAt,
+		entered: make(chan struct{}),
+		proceed: make(chan struct{}),
+	}
+}
+
+func (p *gatedProducer) Next() ([]any, int, error) {
+	n := int(p.calls.Add(1))
+	if n == p.blockAt {
+		close(p.entered)
+		<-p.proceed
+	}
+	if n > p.total {
+		return nil, 0, ErrEofCommitCookie
+	}
+	return []any{n}, n, nil
+}
+
+func (p *gatedProducer) Commit(cookie int) error {
+	p.commits.Add(1)
+	return nil
+}
+
+func TestController_PauseResume(t *testing.T) {
+	producer := newGatedProducer(5, 3)
+	consumer := &MockConsumer{}
+	maxItems := 10
+
+	// На паузе накопленный буфер сбрасывается в обработку
+	flushed := make(chan struct{})
+	consumer.On("Process", []any{1, 2, 3}).Return(nil).Once().
+		Run(func(mock.Arguments) { close(flushed) })
+	consumer.On("Process", []any{4, 5}).Return(nil).Once()
+
+	ctrl := PipeControlled(producer, consumer, maxItems)
+
+	<-producer.entered
+	ctrl.Pause()
+	close(producer.proceed)
+
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("buffer was not flushed on pause")
+	}
+
+	// Пока pipeline на паузе, Next больше не вызывается
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 3, producer.calls.Load())
+	require.Eventually(t, func() bool { return producer.commits.Load() == 3 }, time.Second, time.Millisecond)
+
+	ctrl.Resume()
+	stats, err := ctrl.Wait()
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Batches)
+	require.EqualValues(t, 5, producer.commits.Load())
+
+	consumer.AssertExpectations(t)
+}
+
+func TestController_InvalidArguments(t *testing.T) {
+	ctrl := PipeControlled(nil, &MockConsumer{}, 1)
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestController_BufferedItems(t *testing.T) {
+	producer := newGatedProducer(6, 4)
+	consumer := &MockConsumer{}
+	consumer.On("Process", mock.Anything).Return(nil)
+
+	ctrl := PipeControlled(producer, consumer, 100)
+
+	// Next №4 завис: в буфере три элемента
+	<-producer.entered
+	require.Equal(t, 3, ctrl.BufferedItems())
+
+	// На паузе буфер сбрасывается в обработку
+	ctrl.Pause()
+	close(producer.proceed)
+	require.Eventually(t, func() bool { return ctrl.BufferedItems() == 0 }, time.Second, time.Millisecond)
+
+	ctrl.Resume()
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+	require.Equal(t, 0, ctrl.BufferedItems())
+}
+
+func TestController_BufferedItemsResetOnNextError(t *testing.T) {
+	nextErr := errors.New("source unavailable")
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1}, Cookie: 1},
+		pipetest.Step{Items: []any{2}, Cookie: 2},
+		pipetest.Step{Err: nextErr},
+	)
+	var events []string
+
+	// Next падает, когда в буфере два элемента: буфер отбрасывается
+	ctrl := PipeControlled(producer, pipetest.NullConsumer{}, 10,
+		WithOnBufferStart(func() { events = append(events, "start") }),
+		WithOnBufferEmpty(func() { events = append(events, "empty") }),
+	)
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, nextErr)
+	require.Equal(t, 0, ctrl.BufferedItems())
+	require.Equal(t, []string{"start", "empty"}, events)
+}
+
+func TestController_HealthAfterEOF(t *testing.T) {
+	p := newGatedProducer(3, 0)
+	ctrl := PipeControlled(p, ConsumerFunc(func([]any) error { return nil }), 1)
+
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+
+	health := ctrl.Health()
+	for name, stage := range map[string]StageHealth{
+		StageNext:    health.Next,
+		StageProcess: health.Process,
+		StageCommit:  health.Commit,
+	} {
+		require.False(t, stage.Running, name)
+		require.False(t, stage.LastProgress.IsZero(), name)
+	}
+}
+
+func TestController_HealthWhileRunning(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	c := ConsumerFunc(func([]any) error {
+		close(entered)
+		<-release
+		return nil
+	})
+	ctrl := PipeControlled(newGatedProducer(1, 0), c, 1)
+
+	<-entered
+	health := ctrl.Health()
+	require.True(t, health.Process.Running)
+	require.True(t, health.Next.LastProgress.After(time.Time{}))
+	require.True(t, health.Process.LastProgress.IsZero())
+
+	close(release)
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+	require.False(t, ctrl.Health().Process.Running)
+}
+
+func TestController_WaitCommit(t *testing.T) {
+	scripted := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1}, Cookie: 1},
+		pipetest.Step{Items: []any{2}, Cookie: 2},
+		pipetest.Step{Items: []any{3}, Cookie: 3},
+	)
+	producer := &gatedCommitter{ScriptedProducer: scripted, release: make(chan struct{})}
+
+	ctrl := PipeControlled(producer, &pipetest.RecordingConsumer{}, 0)
+	committed := ctrl.WaitCommit(2)
+
+	// Commit ждёт release, поэтому cookie 2 ещё не зафиксирован
+	select {
+	case <-committed:
+		t.Fatal("WaitCommit unblocked before Commit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.Empty(t, scripted.Committed())
+
+	close(producer.release)
+	<-committed
+	require.Contains(t, scripted.Committed(), 2)
+
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+	// уже зафиксированный cookie не ждёт, а незафиксированный отпускается
+	// завершением pipeline
+	<-ctrl.WaitCommit(1)
+	<-ctrl.WaitCommit(42)
+}
+
+func TestPipe_CommittedCookiesNotTrackedWithoutController(t *testing.T) {
+	steps := make([]int, 100)
+	for i := range steps {
+		steps[i] = 1
+	}
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 100), steps...)
+	pp := newPipe(source, pipetest.NullConsumer{}, 10, nil)
+
+	require.NoError(t, pp.run(context.Background()))
+	require.Len(t, source.Committed(), 100)
+	// WaitCommit недоступен: запоминать фиксации незачем
+	require.Empty(t, pp.ctrl.commits.committed)
+}
+
+func TestController_WaitCommitOffsetMode(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4}, 1, 1, 1, 1)
+	first, second := make(chan struct{}), make(chan struct{})
+	consumer := ConsumerFunc(func(items []any) error {
+		if items[0] == 1 {
+			<-first
+		} else {
+			<-second
+		}
+		return nil
+	})
+
+	ctrl := PipeControlled(source, consumer, 2, WithOffsetCommitMode())
+	// батчи [1 2] и [3 4] фиксируются смещениями 2 и 4: cookie 1 и 3
+	// отдельно не фиксируются, но подтверждаются ими
+	waitFirst, waitThird := ctrl.WaitCommit(1), ctrl.WaitCommit(3)
+	close(first)
+	select {
+	case <-waitFirst:
+	case <-ctrl.Done():
+		t.Fatal("pipeline ended before cookie 1 was committed")
+	}
+	require.Equal(t, []int{2}, source.Committed())
+
+	close(second)
+	<-waitThird
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 4}, source.Committed())
+}
+
+// chanProducer отдаёт элементы из канала feed по одному; закрытие feed —
+// конец данных
+type chanProducer struct {
+	pipetest.RecordingCommitter
+	feed chan int
+}
+
+func (p *chanProducer) Next() ([]any, int, error) {
+	n, ok := <-p.feed
+	if !ok {
+		return nil, 0, ErrEofCommitCookie
+	}
+	return []any{n}, n, nil
+}
+
+func TestController_FlushNow(t *testing.T) {
+	producer := &chanProducer{feed: make(chan int)}
+	batches := make(chan []any, 10)
+	consumer := ConsumerFunc(func(items []any) error {
+		batches <- append([]any(nil), items...)
+		return nil
+	})
+
+	ctrl := PipeControlled(producer, consumer, 10)
+	// пустой буфер не сбрасывается
+	ctrl.FlushNow()
+	producer.feed <- 1
+	producer.feed <- 2
+	require.Eventually(t, func() bool { return ctrl.BufferedItems() == 2 }, time.Second, time.Millisecond)
+	// runNext ждёт в Next: буфер сбрасывается, не дожидаясь его возврата
+	ctrl.FlushNow()
+
+	select {
+	case batch := <-batches:
+		require.Equal(t, []any{1, 2}, batch)
+	case <-time.After(time.Second):
+		t.Fatal("FlushNow did not flush the partial buffer")
+	}
+	require.Equal(t, []int{1, 2}, waitCommitted(t, producer, 2))
+
+	producer.feed <- 3
+	producer.feed <- 4
+	close(producer.feed)
+	_, err := ctrl.Wait()
+	require.NoError(t, err)
+	require.Equal(t, []any{3, 4}, <-batches)
+}
+
+// waitCommitted ждёт, пока источник зафиксирует n cookie
+func waitCommitted(t *testing.T, p interface{ Committed() []int }, n int) []int {
+	t.Helper()
+	require.Eventually(t, func() bool { return len(p.Committed()) >= n }, time.Second, time.Millisecond)
+	return p.Committed()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// consumeWithDeadline обрабатывает батч не дольше perBatchTimeout по часам
+// WithClock. Потребитель без контекста нельзя прервать, поэтому по истечении
+// времени Pipe просто перестаёт его ждать: вызов Process доработает в фоне,
+// а его результат будет отброшен.
+func (pp *pipe) consumeWithDeadline(b batch) error {
+	if cc, ok := pp.c.(ContextConsumer); ok {
+		ctx, cancel := withClockTimeout(pp.batchContext(b), pp.opts.clock, pp.opts.perBatchTimeout)
+		defer cancel()
+		return cc.ProcessCtx(ctx, b.buf)
+	}
+
+	return pp.awaitDeadline(len(b.buf), func() error {
+		if ic, ok := pp.c.(ItemConsumer); ok {
+			return pp.processItems(ic, b)
+		}
+		return pp.c.Process(b.buf)
+	})
+}
+
+// awaitDeadline ждёт вызов call над n элементами не дольше perBatchTimeout;
+// без таймаута просто выполняет его. Просроченный call дорабатывает в фоне.
+func (pp *pipe) awaitDeadline(n int, call func() error) error {
+	if pp.opts.perBatchTimeout <= 0 {
+		return call()
+	}
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+
+	timer := pp.opts.clock.NewTimer(pp.opts.perBatchTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C():
+		return fmt.Errorf("batch of %d items: %w", n, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// sleepyCtxConsumer ждёт delay или отмены контекста батча
+type sleepyCtxConsumer struct {
+	delay time.Duration
+}
+
+func (c *sleepyCtxConsumer) Process(items []any) error {
+	panic("ProcessCtx must be preferred")
+}
+
+func (c *sleepyCtxConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	select {
+	case <-time.After(c.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestPipe_PerBatchTimeoutContextConsumer(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	consumer := &sleepyCtxConsumer{delay: time.Second}
+
+	start := time.Now()
+	err := Pipe(source, consumer, 1, WithPerBatchTimeout(20*time.Millisecond))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	require.Empty(t, source.Committed())
+}
+
+func TestPipe_PerBatchTimeoutPlainConsumer(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	release := make(chan struct{})
+	defer close(release)
+	consumer := &blockingConsumer{release: release}
+
+	err := Pipe(source, consumer, 1, WithPerBatchTimeout(20*time.Millisecond))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, source.Committed())
+}
+
+func TestPipe_PerBatchTimeoutFastConsumer(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	sink := &pipetest.MemorySink{}
+
+	err := Pipe(source, sink, 2, WithPerBatchTimeout(time.Second))
+	require.NoError(t, err)
+	pipetest.AssertRoundTrip(t, source, sink, 2)
+}
+
+func TestPipe_PerBatchTimeoutUsesClock(t *testing.T) {
+	clock := newFakeClock()
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1}, 1)
+	// без продвижения фиктивных часов батч ждал бы час реального времени
+	consumer := &sleepyCtxConsumer{delay: time.Hour}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(source, consumer, 1, WithClock(clock), WithPerBatchTimeout(time.Minute))
+	}()
+
+	var err error
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Minute)
+		select {
+		case err = <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, source.Committed())
+}
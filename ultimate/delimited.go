@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// defaultMaxFrameSize — наибольший размер кадра DelimitedProducer по умолчанию
+const defaultMaxFrameSize = 64 << 20
+
+// DelimitedProducer читает поток кадров с префиксом длины в формате varint,
+// как при записи protobuf-сообщений через writeDelimitedTo. Каждый кадр —
+// отдельный элемент []byte, cookie — номер кадра, начиная с 1. Чистый конец
+// потока на границе кадра означает конец данных, а оборванный кадр — ошибку.
+type DelimitedProducer struct {
+	// MaxFrameSize ограничивает длину кадра, чтобы испорченный префикс не
+	// привёл к огромному выделению памяти; по умолчанию 64 МиБ
+	MaxFrameSize int
+
+	reader    *bufio.Reader
+	frame     int
+	committed atomic.Int64
+}
+
+// NewDelimitedProducer создаёт источник поверх r
+func NewDelimitedProducer(r io.Reader) *DelimitedProducer {
+	return &DelimitedProducer{MaxFrameSize: defaultMaxFrameSize, reader: bufio.NewReader(r)}
+}
+
+func (p *DelimitedProducer) Next() ([]any, int, error) {
+	size, err := binary.ReadUvarint(p.reader)
+	if errors.Is(err, io.EOF) {
+		return nil, 0, ErrEofCommitCookie
+	}
+	frame := p.frame + 1
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, 0, fmt.Errorf("frame %d: truncated length prefix", frame)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("frame %d: %w", frame, err)
+	}
+	if size > uint64(p.MaxFrameSize) {
+		return nil, 0, fmt.Errorf("frame %d: size %d exceeds limit %d", frame, size, p.MaxFrameSize)
+	}
+	data := make([]byte, size)
+	if n, err := io.ReadFull(p.reader, data); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("frame %d: truncated: %d of %d bytes", frame, n, size)
+		}
+		return nil, 0, fmt.Errorf("frame %d: %w", frame, err)
+	}
+	p.frame = frame
+	return []any{data}, frame, nil
+}
+
+// Commit запоминает номер последнего подтверждённого кадра
+func (p *DelimitedProducer) Commit(cookie int) error {
+	p.committed.Store(int64(cookie))
+	return nil
+}
+
+// Committed возвращает номер последнего подтверждённого кадра
+func (p *DelimitedProducer) Committed() int {
+	return int(p.committed.Load())
+}
+
+// DelimitedConsumer записывает каждый элемент батча кадром с префиксом длины
+// в формате varint. Элементы должны быть []byte, например результатом
+// proto.Marshal.
+type DelimitedConsumer struct {
+	w io.Writer
+}
+
+// NewDelimitedConsumer создаёт потребителя поверх w
+func NewDelimitedConsumer(w io.Writer) *DelimitedConsumer {
+	return &DelimitedConsumer{w: w}
+}
+
+// Process записывает батч одним вызовом Write
+func (c *DelimitedConsumer) Process(items []any) error {
+	var buf []byte
+	for i, item := range items {
+		data, ok := item.([]byte)
+		if !ok {
+			return fmt.Errorf("item %d: expected []byte, got %T", i, item)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		buf = append(buf, data...)
+	}
+	_, err := c.w.Write(buf)
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// delimitedFrames кодирует frames в поток с префиксами длины
+func delimitedFrames(frames ...[]byte) []byte {
+	var buf []byte
+	for _, frame := range frames {
+		buf = binary.AppendUvarint(buf, uint64(len(frame)))
+		buf = append(buf, frame...)
+	}
+	return buf
+}
+
+func TestDelimited_RoundTrip(t *testing.T) {
+	frames := [][]byte{
+		[]byte("first"),
+		{},
+		bytes.Repeat([]byte{0xAB}, 300), // префикс длины из двух байт
+		[]byte("fourth"),
+		[]byte("fifth"),
+	}
+	for _, maxItems := range []int{0, 2, 10} {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			input := delimitedFrames(frames...)
+			producer := NewDelimitedProducer(bytes.NewReader(input))
+			var out bytes.Buffer
+			var sizes []int
+			consumer := NewDelimitedConsumer(&out)
+
+			err := Pipe(producer, ConsumerFunc(func(items []any) error {
+				sizes = append(sizes, len(items))
+				return consumer.Process(items)
+			}), maxItems)
+			require.NoError(t, err)
+			require.Equal(t, input, out.Bytes())
+			require.Equal(t, len(frames), producer.Committed())
+			for _, n := range sizes {
+				require.LessOrEqual(t, n, max(maxItems, 1))
+			}
+		})
+	}
+}
+
+func TestDelimited_TruncatedFrame(t *testing.T) {
+	tests := map[string][]byte{
+		"payload":       delimitedFrames([]byte("ok"), []byte("cut"))[:6],
+		"length prefix": append(delimitedFrames([]byte("ok")), 0x80),
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Pipe(NewDelimitedProducer(bytes.NewReader(input)), NewDelimitedConsumer(&out), 10)
+			require.ErrorIs(t, err, ErrNextFailed)
+			require.ErrorContains(t, err, "frame 2: truncated")
+		})
+	}
+}
+
+func TestDelimited_FrameTooLarge(t *testing.T) {
+	producer := NewDelimitedProducer(bytes.NewReader(delimitedFrames(make([]byte, 100))))
+	producer.MaxFrameSize = 10
+
+	err := Pipe(producer, NewDelimitedConsumer(&bytes.Buffer{}), 10)
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.ErrorContains(t, err, "size 100 exceeds limit 10")
+}
+
+func TestDelimitedConsumer_RejectsNonBytes(t *testing.T) {
+	err := NewDelimitedConsumer(&bytes.Buffer{}).Process([]any{"text"})
+	require.ErrorContains(t, err, "expected []byte, got string")
+}
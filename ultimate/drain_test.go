@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_DrainTimeoutOnStuckConsumer(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &blockingConsumer{release: make(chan struct{})}
+	t.Cleanup(func() { close(consumer.release) })
+	maxItems := 1
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	// Process уже завис на первом батче, когда источник падает
+	producer.On("Next").Return([]any{}, 0, errors.New("producer error")).Once()
+	// Отпущенный при очистке Process успеет зафиксировать свой батч
+	producer.On("Commit", mock.Anything).Return(nil).Maybe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(producer, consumer, maxItems, WithDrainTimeout(20*time.Millisecond))
+	}()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, ErrNextFailed)
+		require.ErrorIs(t, err, ErrDrainTimeout)
+	case <-time.After(time.Second):
+		t.Fatal("Pipe did not return after drain timeout")
+	}
+}
+
+func TestPipe_DrainTimeoutNotTriggeredOnCleanShutdown(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, errors.New("producer error")).Once()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+
+	err := Pipe(producer, consumer, maxItems, WithDrainTimeout(time.Second))
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.NotErrorIs(t, err, ErrDrainTimeout)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
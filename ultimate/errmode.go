@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorMode определяет, какие ошибки стадий возвращает pipeline
+type ErrorMode int
+
+const (
+	// JoinAll объединяет ошибки всех стадий через errors.Join
+	JoinAll ErrorMode = iota
+	// FirstCause возвращает только самую раннюю ошибку, не являющуюся
+	// отменой контекста, то есть первопричину, а не её каскадные последствия
+	FirstCause
+)
+
+// combine сводит ошибки стадий в порядке их поступления к одной
+func (m ErrorMode) combine(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	if m == FirstCause {
+		for _, err := range errs {
+			if !isCancellation(err) {
+				return err
+			}
+		}
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_ErrorModes(t *testing.T) {
+	processErr := errors.New("process stage failed")
+	for _, mode := range []ErrorMode{JoinAll, FirstCause} {
+		producer, consumer := pipetest.NewCascade(processErr)
+
+		err := Pipe(producer, consumer, 1, WithErrorMode(mode))
+		require.ErrorIs(t, err, processErr)
+		require.ErrorIs(t, err, ErrProcessFailed)
+		if mode == FirstCause {
+			// Каскадная отмена не попадает в результат
+			require.NotErrorIs(t, err, context.Canceled)
+			require.NotErrorIs(t, err, ErrNextFailed)
+		} else {
+			require.ErrorIs(t, err, context.Canceled)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultRecordsPerNext — сколько записей FileProducer читает за один Next
+const defaultRecordsPerNext = 64
+
+// FileProducer читает файл записями фиксированной длины. Каждая запись —
+// отдельный элемент []byte, cookie — смещение в байтах сразу за последней
+// записью результата, то есть позиция, с которой продолжится чтение.
+//
+// Commit сохраняет смещение в соседний файл path + ".offset", а
+// NewFileProducer при наличии такого файла продолжает чтение с
+// сохранённой позиции. Так повторный запуск после сбоя не перечитывает уже
+// зафиксированные записи.
+type FileProducer struct {
+	// RecordsPerNext — число записей в одном результате Next, по умолчанию 64
+	RecordsPerNext int
+
+	file       *os.File
+	reader     *bufio.Reader
+	recordSize int
+	offset     int64
+
+	mu        sync.Mutex
+	sidecar   string
+	committed int64
+}
+
+// NewFileProducer открывает path для чтения записей по recordSize байт и
+// встаёт на смещение из соседнего файла, если он есть
+func NewFileProducer(path string, recordSize int) (*FileProducer, error) {
+	if recordSize <= 0 {
+		return nil, fmt.Errorf("%w: recordSize must be positive (%d)", ErrInvalidArgument, recordSize)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &FileProducer{
+		RecordsPerNext: defaultRecordsPerNext,
+		file:           file,
+		reader:         bufio.NewReader(file),
+		recordSize:     recordSize,
+		sidecar:        path + ".offset",
+	}
+	offset, err := readOffset(p.sidecar)
+	if err == nil {
+		err = p.seek(offset)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	p.committed = offset
+	return p, nil
+}
+
+func (p *FileProducer) Next() ([]any, int, error) {
+	n := max(p.RecordsPerNext, 1)
+	items := make([]any, 0, n)
+	for len(items) < n {
+		record := make([]byte, p.recordSize)
+		read, err := io.ReadFull(p.reader, record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("truncated record at offset %d: %d of %d bytes", p.offset, read, p.recordSize)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, record)
+		p.offset += int64(p.recordSize)
+	}
+	if len(items) == 0 {
+		return nil, 0, ErrEofCommitCookie
+	}
+	return items, int(p.offset), nil
+}
+
+// Commit сохраняет смещение в соседний файл. Смещение меньше уже
+// сохранённого игнорируется.
+func (p *FileProducer) Commit(cookie int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if int64(cookie) <= p.committed {
+		return nil
+	}
+	if err := writeOffset(p.sidecar, int64(cookie)); err != nil {
+		return err
+	}
+	p.committed = int64(cookie)
+	return nil
+}
+
+// SeekTo продолжает чтение со смещения cookie. Вместе с WithStartAfterCookie
+// позволяет возобновить чтение с позиции, сохранённой вне соседнего файла.
+func (p *FileProducer) SeekTo(cookie int) error {
+	return p.seek(int64(cookie))
+}
+
+// Close закрывает файл
+func (p *FileProducer) Close() error {
+	return p.file.Close()
+}
+
+func (p *FileProducer) seek(offset int64) error {
+	if offset%int64(p.recordSize) != 0 {
+		return fmt.Errorf("offset %d is not aligned to record size %d", offset, p.recordSize)
+	}
+	if _, err := p.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	p.reader.Reset(p.file)
+	p.offset = offset
+	return nil
+}
+
+// readOffset читает сохранённое смещение; отсутствие файла — смещение 0
+func readOffset(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("offset file %s: %w", path, err)
+	}
+	return offset, nil
+}
+
+// writeOffset атомарно заменяет файл смещения: пишет во временный файл,
+// сбрасывает его на диск и переименовывает
+func writeOffset(path string, offset int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strconv.FormatInt(offset, 10)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRecords пишет во временный файл n записей по 4 байта: "r000", "r001", ...
+func writeRecords(t *testing.T, n int) string {
+	t.Helper()
+	var data []byte
+	for i := 0; i < n; i++ {
+		data = append(data, []byte{'r', byte('0' + i/100), byte('0' + i/10%10), byte('0' + i%10)}...)
+	}
+	path := filepath.Join(t.TempDir(), "records.bin")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func records(from, to int) []any {
+	var items []any
+	for i := from; i < to; i++ {
+		items = append(items, []byte{'r', byte('0' + i/100), byte('0' + i/10%10), byte('0' + i%10)})
+	}
+	return items
+}
+
+func TestFileProducer_OffsetCookies(t *testing.T) {
+	p, err := NewFileProducer(writeRecords(t, 10), 4)
+	require.NoError(t, err)
+	defer p.Close()
+	p.RecordsPerNext = 3
+
+	var items []any
+	var cookies []int
+	for {
+		batch, cookie, err := p.Next()
+		if isEOF(err) {
+			break
+		}
+		require.NoError(t, err)
+		items = append(items, batch...)
+		cookies = append(cookies, cookie)
+	}
+	require.Equal(t, records(0, 10), items)
+	require.Equal(t, []int{12, 24, 36, 40}, cookies)
+}
+
+func TestFileProducer_ResumeFromCommittedOffset(t *testing.T) {
+	path := writeRecords(t, 10)
+
+	first, err := NewFileProducer(path, 4)
+	require.NoError(t, err)
+	first.RecordsPerNext = 3
+	_, _, err = first.Next()
+	require.NoError(t, err)
+	_, cookie, err := first.Next()
+	require.NoError(t, err)
+	// фиксируем только первые шесть записей и «падаем»
+	require.NoError(t, first.Commit(cookie))
+	require.NoError(t, first.Close())
+
+	offset, err := os.ReadFile(path + ".offset")
+	require.NoError(t, err)
+	require.Equal(t, "24", string(offset))
+
+	resumed, err := NewFileProducer(path, 4)
+	require.NoError(t, err)
+	defer resumed.Close()
+	sink := &pipetest.RecordingConsumer{}
+	require.NoError(t, Pipe(resumed, sink, 5))
+	require.Equal(t, records(6, 10), sink.Items())
+
+	offset, err = os.ReadFile(path + ".offset")
+	require.NoError(t, err)
+	require.Equal(t, "40", string(offset))
+}
+
+func TestFileProducer_TruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.bin")
+	require.NoError(t, os.WriteFile(path, []byte("r000r0"), 0o600))
+	p, err := NewFileProducer(path, 4)
+	require.NoError(t, err)
+	defer p.Close()
+
+	err = Pipe(p, &pipetest.RecordingConsumer{}, 5)
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.ErrorContains(t, err, "truncated record at offset 4")
+}
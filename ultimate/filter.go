@@ -0,0 +1,23 @@
+package main
+
+import "errors"
+
+// errFiltered — transform отфильтровал все элементы батча, и потребитель
+// его не получил
+var errFiltered = errors.New("batch filtered")
+
+// filteredCookies решает судьбу cookie полностью отфильтрованного батча:
+// передаёт их обработчику WithOnFilteredCookies и возвращает cookie для
+// фиксации — все или ни одного
+func (pp *pipe) filteredCookies(b batch) []int {
+	if pp.opts.onFilteredCookies == nil {
+		return pp.commitCookies(b.cookies)
+	}
+	pp.opts.onFilteredCookies(b.cookies)
+	if pp.opts.commitFiltered {
+		return pp.commitCookies(b.cookies)
+	}
+	// фиксации не будет: span батча завершается сразу
+	pp.tracing.fail(b.span, nil)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// FlushableConsumer — потребитель со своим буфером: Process только
+// накапливает элементы, а надёжно сохраняет их Flush. С WithCommitOnFlush
+// cookie обработанных батчей фиксируются лишь после успешного Flush.
+type FlushableConsumer interface {
+	Flush() error
+}
+
+// flushGate придерживает cookie обработанных батчей до успешного Flush
+// потребителя
+type flushGate struct {
+	c        FlushableConsumer
+	interval time.Duration
+	timer    Timer
+	held     []int
+}
+
+// newFlushGate возвращает nil, если WithCommitOnFlush не задан или
+// потребитель не реализует FlushableConsumer
+func (pp *pipe) newFlushGate() *flushGate {
+	fc, ok := pp.c.(FlushableConsumer)
+	if !pp.opts.commitOnFlush || !ok {
+		return nil
+	}
+	g := &flushGate{c: fc, interval: pp.opts.commitFlushInterval}
+	if g.interval > 0 {
+		g.timer = pp.opts.clock.NewTimer(g.interval)
+	}
+	return g
+}
+
+func (g *flushGate) stop() {
+	if g != nil && g.timer != nil {
+		g.timer.Stop()
+	}
+}
+
+// hold придерживает cookie. Если подошёл срок периодического Flush,
+// вызывает его и возвращает все придержанные cookie для фиксации.
+func (g *flushGate) hold(cookies []int) ([]int, error) {
+	g.held = append(g.held, cookies...)
+	if g.timer == nil || !timerFired(g.timer) {
+		return nil, nil
+	}
+	g.timer.Reset(g.interval)
+	return g.flush()
+}
+
+// flush сбрасывает буфер потребителя и отдаёт придержанные cookie. При
+// ошибке Flush cookie не отдаются и зафиксированы не будут.
+func (g *flushGate) flush() ([]int, error) {
+	if len(g.held) == 0 {
+		return nil, nil
+	}
+	if err := g.c.Flush(); err != nil {
+		return nil, fmt.Errorf("%w: flush: %w", ErrProcessFailed, err)
+	}
+	cookies := g.held
+	g.held = nil
+	return cookies, nil
+}
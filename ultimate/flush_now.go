@@ -0,0 +1,48 @@
+package main
+
+// FlushNow просит runNext немедленно отправить в обработку всё, что
+// накоплено в буфере, независимо от его размера и таймеров; pipeline при
+// этом продолжает работу. Если runNext ждёт Next, буфер сбрасывается, не
+// дожидаясь его возврата. Пустой буфер не сбрасывается. Безопасен для
+// вызова из любой горутины.
+func (ctrl *Controller) FlushNow() {
+	ctrl.flushNow.Store(true)
+	select {
+	case ctrl.flushWake <- struct{}{}:
+	default:
+	}
+}
+
+// flushRequested забирает запрос FlushNow
+func (ctrl *Controller) flushRequested() bool {
+	return ctrl.flushNow.CompareAndSwap(true, false)
+}
+
+// callNext вызывает Next источника. Под Controller при непустом буфере Next
+// выполняется в отдельной горутине, а runNext тем временем отвечает на
+// FlushNow вызовом flush; после неудачного flush запросы больше не
+// обслуживаются. Сам Next не прерывается: callNext всегда дожидается его.
+func (pp *pipe) callNext(pending bool, flush func() bool) (items []any, cookie int, err error) {
+	call := func() error {
+		return pp.withRetry(func() (err error) {
+			items, cookie, err = pp.p.Next()
+			return err
+		})
+	}
+	wake := pp.ctrl.flushWake
+	if wake == nil || !pending {
+		return items, cookie, call()
+	}
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+	for {
+		select {
+		case err := <-done:
+			return items, cookie, err
+		case <-wake:
+			if pp.ctrl.flushRequested() && !flush() {
+				wake = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// bufferedSink копит элементы в Process и сохраняет их только во Flush.
+// На каждом Flush запоминает, сколько cookie источника уже зафиксировано.
+type bufferedSink struct {
+	source  *pipetest.MemorySource
+	fail    error
+	onBatch func(n int)
+
+	mu        sync.Mutex
+	batches   int
+	pending   []any
+	stored    []any
+	committed []int
+}
+
+func (s *bufferedSink) Process(items []any) error {
+	s.mu.Lock()
+	s.batches++
+	n := s.batches
+	s.pending = append(s.pending, items...)
+	s.mu.Unlock()
+	if s.onBatch != nil {
+		s.onBatch(n)
+	}
+	return nil
+}
+
+func (s *bufferedSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = append(s.committed, len(s.source.Committed()))
+	if s.fail != nil {
+		return s.fail
+	}
+	s.stored = append(s.stored, s.pending...)
+	s.pending = nil
+	return nil
+}
+
+func newFlushSource() *pipetest.MemorySource {
+	return pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6}, 1, 1, 1, 1, 1, 1)
+}
+
+func TestPipe_CommitOnFlushAtEOF(t *testing.T) {
+	source := newFlushSource()
+	sink := &bufferedSink{source: source}
+
+	require.NoError(t, Pipe(source, sink, 2, WithCommitOnFlush(0)))
+
+	// единственный Flush — в конце потока, и до него ничего не фиксировалось
+	require.Equal(t, []int{0}, sink.committed)
+	require.Equal(t, []any{1, 2, 3, 4, 5, 6}, sink.stored)
+	require.Equal(t, source.Cookies(), source.Committed())
+}
+
+func TestPipe_CommitOnFlushFailureWithholdsCookies(t *testing.T) {
+	source := newFlushSource()
+	sink := &bufferedSink{source: source, fail: errors.New("disk full")}
+
+	err := Pipe(source, sink, 2, WithCommitOnFlush(0))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorContains(t, err, "flush: disk full")
+	require.Empty(t, source.Committed())
+}
+
+func TestPipe_CommitOnFlushInterval(t *testing.T) {
+	clock := newFakeClock()
+	source := newFlushSource()
+	sink := &bufferedSink{source: source}
+	// срок периодического Flush наступает во время второго батча
+	sink.onBatch = func(n int) {
+		if n == 2 {
+			clock.Advance(time.Second)
+		}
+	}
+
+	require.NoError(t, Pipe(source, sink, 2, WithClock(clock), WithCommitOnFlush(time.Second)))
+
+	require.Len(t, sink.committed, 2)
+	require.Equal(t, 0, sink.committed[0])
+	require.Equal(t, []any{1, 2, 3, 4, 5, 6}, sink.stored)
+	require.Equal(t, source.Cookies(), source.Committed())
+}
+
+func TestPipe_NoCommitOnFlushByDefault(t *testing.T) {
+	source := newFlushSource()
+	sink := &bufferedSink{source: source}
+
+	require.NoError(t, Pipe(source, sink, 2))
+
+	require.Empty(t, sink.committed)
+	require.Equal(t, source.Cookies(), source.Committed())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+var errFuzzNext = errors.New("fuzz next error")
+
+// fuzzSteps строит сценарий источника из байтов: каждые три байта —
+// (число элементов, cookie, флаг ошибки). Флаг 1 завершает поток EOF,
+// флаг 2 — ошибкой Next, остальные значения дают обычный результат.
+// Подряд идущие результаты с одним cookie — одна транзакция: txns — cookie
+// транзакций по порядку, ends — число элементов потока к концу каждой из них.
+func fuzzSteps(script []byte) (steps []pipetest.Step, items []any, txns, ends []int, failed bool) {
+	items, txns = []any{}, []int{}
+	next := 0
+	for i := 0; i+2 < len(script); i += 3 {
+		count, cookie, flag := int(script[i]), int(script[i+1]), script[i+2]%8
+		switch flag {
+		case 1:
+			steps = append(steps, pipetest.Step{Err: ErrEofCommitCookie})
+			return steps, items, txns, ends, false
+		case 2:
+			steps = append(steps, pipetest.Step{Err: errFuzzNext})
+			return steps, items, txns, ends, true
+		}
+		step := pipetest.Step{Items: make([]any, count), Cookie: cookie}
+		for j := range step.Items {
+			step.Items[j] = next
+			next++
+		}
+		steps = append(steps, step)
+		items = append(items, step.Items...)
+		if n := len(txns); n > 0 && txns[n-1] == cookie {
+			ends[n-1] = len(items)
+			continue
+		}
+		txns = append(txns, cookie)
+		ends = append(ends, len(items))
+	}
+	return steps, items, txns, ends, false
+}
+
+// txnProducer при каждом Commit проверяет, что все элементы транзакции уже
+// обработаны
+type txnProducer struct {
+	*pipetest.ScriptedProducer
+	consumer *pipetest.RecordingConsumer
+	ends     []int
+	early    atomic.Int32
+}
+
+func (p *txnProducer) Commit(cookie int) error {
+	if k := len(p.Committed()); k < len(p.ends) && len(p.consumer.Items()) < p.ends[k] {
+		p.early.Add(1)
+	}
+	return p.ScriptedProducer.Commit(cookie)
+}
+
+func FuzzPipe(f *testing.F) {
+	f.Add(uint8(2), []byte{1, 1, 0, 1, 2, 0, 1, 3, 0})
+	f.Add(uint8(1), []byte{0, 1, 0, 0, 2, 0, 3, 3, 0})
+	f.Add(uint8(0), []byte{2, 0, 0, 0, 0, 0, 5, 0, 0})
+	f.Add(uint8(3), []byte{200, 7, 0, 1, 8, 0})
+	f.Add(uint8(4), []byte{1, 5, 0, 1, 5, 0, 2, 6, 0})
+	f.Add(uint8(2), []byte{3, 1, 0, 0, 0, 1, 4, 2, 0})
+	f.Add(uint8(2), []byte{3, 1, 0, 1, 2, 2})
+	// транзакция 5 разрезана границей батча
+	f.Add(uint8(2), []byte{1, 4, 0, 1, 5, 0, 1, 5, 0, 1, 6, 0})
+
+	f.Fuzz(func(t *testing.T, maxItems uint8, script []byte) {
+		steps, items, txns, ends, failed := fuzzSteps(script)
+		consumer := &pipetest.RecordingConsumer{}
+		producer := &txnProducer{
+			ScriptedProducer: pipetest.NewScriptedProducer(ErrEofCommitCookie, steps...),
+			consumer:         consumer,
+			ends:             ends,
+		}
+
+		err := Pipe(producer, consumer, int(maxItems%16))
+
+		processed := append([]any{}, consumer.Items()...)
+		committed := append([]int{}, producer.Committed()...)
+		if maxItems%16 > 0 {
+			// без буферизации следующий результат Next ещё неизвестен, и
+			// cookie транзакции фиксируется с её первым батчем
+			require.Zero(t, producer.early.Load(), "cookie committed before its transaction was processed")
+		}
+		if failed {
+			require.ErrorIs(t, err, ErrNextFailed)
+			// после ошибки Next обработана и зафиксирована только часть потока
+			require.LessOrEqual(t, len(processed), len(items))
+			require.Equal(t, items[:len(processed)], processed)
+			require.LessOrEqual(t, len(committed), len(txns))
+			require.Equal(t, txns[:len(committed)], committed)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, items, processed)
+		// каждая транзакция зафиксирована ровно один раз
+		require.Equal(t, txns, committed)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PipeOf — обобщённый Pipe для произвольных элементов T и cookie C. Батчи
+// собирает и фиксирует тот же pipeline, что у Pipe, с теми же опциями.
+// Опции, работающие с int cookie, видят вместо C его номер: cookie
+// нумеруются с 1 в порядке выдачи, подряд идущие одинаковые cookie получают
+// один номер. Для Producer и Consumer PipeOf равносилен Pipe.
+func PipeOf[T any, C comparable](p ProducerOf[T, C], c ConsumerOf[T], maxItems int, opts ...Option) error {
+	switch {
+	case p == nil:
+		return fmt.Errorf("%w: producer is nil", ErrInvalidArgument)
+	case c == nil:
+		return fmt.Errorf("%w: consumer is nil", ErrInvalidArgument)
+	}
+	if pp, ok := any(p).(Producer); ok {
+		if cc, ok := any(c).(Consumer); ok {
+			return Pipe(pp, cc, maxItems, opts...)
+		}
+	}
+	return Pipe(&producerOf[T, C]{p: p, cookies: make(map[int]C)}, consumerOf[T]{c: c}, maxItems, opts...)
+}
+
+// producerOf приводит ProducerOf к Producer, заменяя cookie номерами
+type producerOf[T any, C comparable] struct {
+	p ProducerOf[T, C]
+
+	mu      sync.Mutex
+	cookies map[int]C
+	last    C
+	seq     int
+}
+
+func (a *producerOf[T, C]) Next() ([]any, int, error) {
+	items, cookie, err := a.p.Next()
+	buf := make([]any, len(items))
+	for i, item := range items {
+		buf[i] = item
+	}
+	if err != nil && !(isEOF(err) && len(items) > 0) {
+		return buf, 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.seq == 0 || cookie != a.last {
+		a.seq++
+		a.last = cookie
+		a.cookies[a.seq] = cookie
+	}
+	// элементы, отданные вместе с EOF, Pipe обработает и зафиксирует
+	return buf, a.seq, err
+}
+
+func (a *producerOf[T, C]) Commit(seq int) error {
+	a.mu.Lock()
+	cookie, ok := a.cookies[seq]
+	a.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown cookie number %d", seq)
+	}
+	if err := a.p.Commit(cookie); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	delete(a.cookies, seq)
+	a.mu.Unlock()
+	return nil
+}
+
+// consumerOf приводит ConsumerOf к Consumer
+type consumerOf[T any] struct {
+	c ConsumerOf[T]
+}
+
+func (a consumerOf[T]) Process(items []any) error {
+	buf := make([]T, len(items))
+	for i, item := range items {
+		v, ok := item.(T)
+		if !ok {
+			return fmt.Errorf("item %d: %T is not %T", i, item, v)
+		}
+		buf[i] = v
+	}
+	return a.c.Process(buf)
+}
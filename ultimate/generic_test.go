@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// offsetProducer отдаёт строки с непрозрачными строковыми cookie
+type offsetProducer struct {
+	lines     []string
+	pos       int
+	committed []string
+	failOn    string
+}
+
+func (p *offsetProducer) Next() ([]string, string, error) {
+	if p.pos >= len(p.lines) {
+		return nil, "", ErrEofCommitCookie
+	}
+	p.pos++
+	return []string{p.lines[p.pos-1]}, fmt.Sprintf("partition-0/offset-%d", p.pos), nil
+}
+
+func (p *offsetProducer) Commit(cookie string) error {
+	if cookie == p.failOn {
+		return errors.New("commit rejected")
+	}
+	p.committed = append(p.committed, cookie)
+	return nil
+}
+
+// stringSink копит обработанные строки
+type stringSink struct {
+	batches [][]string
+}
+
+func (s *stringSink) Process(items []string) error {
+	s.batches = append(s.batches, append([]string(nil), items...))
+	return nil
+}
+
+func TestPipeOf_StringCookies(t *testing.T) {
+	producer := &offsetProducer{lines: []string{"a", "b", "c"}}
+	consumer := &stringSink{}
+
+	err := PipeOf[string, string](producer, consumer, 2)
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"a", "b"}, {"c"}}, consumer.batches)
+	require.Equal(t, []string{"partition-0/offset-1", "partition-0/offset-2", "partition-0/offset-3"}, producer.committed)
+}
+
+func TestPipeOf_CommitError(t *testing.T) {
+	producer := &offsetProducer{lines: []string{"a", "b"}, failOn: "partition-0/offset-1"}
+
+	err := PipeOf[string, string](producer, &stringSink{}, 0)
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.Empty(t, producer.committed)
+}
+
+func TestPipeOf_IntAliasMatchesPipe(t *testing.T) {
+	// Producer — это ProducerOf[any, int], поэтому обычные источники подходят PipeOf
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	producer.On("Next").Return([]any{1}, 7, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{1}).Return(nil).Once()
+	producer.On("Commit", 7).Return(nil).Once()
+
+	var p Producer = producer
+	err := PipeOf[any, int](p, consumer, 1)
+	require.NoError(t, err)
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+// tailProducer отдаёт последние элементы вместе с EOF и результат без
+// элементов перед ними
+type tailProducer struct {
+	offsetProducer
+}
+
+func (p *tailProducer) Next() ([]string, string, error) {
+	switch p.pos++; p.pos {
+	case 1:
+		return []string{"a"}, "o1", nil
+	case 2:
+		return nil, "o2", nil
+	case 3:
+		return []string{"b", "c"}, "o3", ErrEofCommitCookie
+	}
+	return nil, "", ErrEofCommitCookie
+}
+
+func TestPipeOf_SharesPipeSemantics(t *testing.T) {
+	producer := &tailProducer{}
+	consumer := &stringSink{}
+	var starts int
+
+	err := PipeOf[string, string](producer, consumer, 10, WithOnBufferStart(func() { starts++ }))
+	require.NoError(t, err)
+	// результат без элементов не доходит до Process, элементы вместе с EOF
+	// обработаны, опции действуют
+	require.Equal(t, [][]string{{"a", "b", "c"}}, consumer.batches)
+	require.Equal(t, []string{"o1", "o2", "o3"}, producer.committed)
+	require.Equal(t, 1, starts)
+}
+
+func TestPipeOf_DuplicateCookiesCommittedOnce(t *testing.T) {
+	producer := &offsetProducer{lines: []string{"a", "b", "c"}}
+	consumer := &stringSink{}
+	same := &sameCookieProducer{offsetProducer: producer}
+
+	err := PipeOf[string, string](same, consumer, 1)
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"a"}, {"b"}, {"c"}}, consumer.batches)
+	require.Equal(t, []string{"txn"}, producer.committed)
+}
+
+// sameCookieProducer отдаёт все строки одной транзакцией
+type sameCookieProducer struct {
+	*offsetProducer
+}
+
+func (p *sameCookieProducer) Next() ([]string, string, error) {
+	items, _, err := p.offsetProducer.Next()
+	return items, "txn", err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// GroupedConsumer — потребитель, принимающий батч, уже разбитый по ключу
+// WithGroupKey, одним вызовом
+type GroupedConsumer interface {
+	ProcessGrouped(groups map[any][]any) error
+}
+
+// itemGroup — элементы батча с общим ключом
+type itemGroup struct {
+	key   any
+	items []any
+}
+
+// groupItems делит элементы по ключу. Группы идут в порядке первого
+// появления ключа, элементы внутри группы сохраняют исходный порядок.
+// Несравнимый ключ — ошибка: он не может быть ключом map.
+func groupItems(items []any, key func(item any) any) ([]itemGroup, error) {
+	var groups []itemGroup
+	index := map[any]int{}
+	for n, item := range items {
+		k := key(item)
+		if k != nil && !reflect.ValueOf(k).Comparable() {
+			return nil, fmt.Errorf("group key of item %d: %T is not comparable", n, k)
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, itemGroup{key: k})
+		}
+		groups[i].items = append(groups[i].items, item)
+	}
+	return groups, nil
+}
+
+// processGroups передаёт батч потребителю по группам: GroupedConsumer
+// получает все группы сразу, остальные потребители — по вызову Process на
+// группу. Повторы WithStageRetry и WithPerBatchTimeout действуют в обоих
+// случаях. Cookie батча фиксируются, только если обработаны все группы;
+// пропуск одной группы через ErrSkip не мешает обработке остальных.
+func (pp *pipe) processGroups(b batch) error {
+	groups, err := groupItems(b.buf, pp.opts.groupKey)
+	if err != nil {
+		return err
+	}
+	if gc, ok := pp.c.(GroupedConsumer); ok {
+		byKey := make(map[any][]any, len(groups))
+		for _, g := range groups {
+			byKey[g.key] = g.items
+		}
+		return pp.withRetry(func() error {
+			return pp.awaitDeadline(len(b.buf), func() error { return gc.ProcessGrouped(byKey) })
+		})
+	}
+	return consumeParts(len(groups), func(i int) error {
+		return pp.consumeSplitting(batchPart(b, i, groups[i].items))
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// partition — ключ группировки: префикс до двоеточия
+func partition(item any) any {
+	key, _, _ := strings.Cut(item.(string), ":")
+	return key
+}
+
+func TestPipe_GroupKeyProcessPerGroup(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"a:1", "b:1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"a:2", "b:2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"a:1", "a:2"}).Return(nil).Once()
+	consumer.On("Process", []any{"b:1", "b:2"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10, WithGroupKey(partition))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_GroupKeyFailedGroupKeepsBatchUncommitted(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"a:1", "b:1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{"a:1"}).Return(nil).Once()
+	consumer.On("Process", []any{"b:1"}).Return(errors.New("partition b down")).Once()
+
+	err := Pipe(producer, consumer, 10, WithGroupKey(partition))
+	require.ErrorIs(t, err, ErrProcessFailed)
+
+	producer.AssertNotCalled(t, "Commit", 1)
+	consumer.AssertExpectations(t)
+}
+
+// groupedConsumer записывает группы, полученные через ProcessGrouped;
+// fail, если задан, решает исход каждого вызова
+type groupedConsumer struct {
+	pipetest.RecordingConsumer
+	groups []map[any][]any
+	fail   func(call int) error
+}
+
+func (c *groupedConsumer) ProcessGrouped(groups map[any][]any) error {
+	c.groups = append(c.groups, groups)
+	if c.fail != nil {
+		return c.fail(len(c.groups))
+	}
+	return nil
+}
+
+func TestPipe_GroupKeyGroupedConsumer(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a:1", "b:1", "a:2"}, 2, 1)
+	consumer := &groupedConsumer{}
+
+	err := Pipe(producer, consumer, 10, WithGroupKey(partition))
+	require.NoError(t, err)
+
+	require.Equal(t, []map[any][]any{{"a": {"a:1", "a:2"}, "b": {"b:1"}}}, consumer.groups)
+	require.Empty(t, consumer.Batches())
+	require.Equal(t, []int{1, 2}, producer.Committed())
+}
+
+func TestPipe_GroupKeyNotComparable(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a:1"}, 1)
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 10, WithGroupKey(func(item any) any { return []string{item.(string)} }))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorContains(t, err, "not comparable")
+	require.Empty(t, consumer.Batches())
+	require.Empty(t, producer.Committed())
+}
+
+func TestPipe_GroupKeyGroupedConsumerRetried(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a:1", "b:1"}, 2)
+	consumer := &groupedConsumer{fail: func(call int) error {
+		if call == 1 {
+			return Retryable(errors.New("partition moved"))
+		}
+		return nil
+	}}
+
+	err := Pipe(producer, consumer, 10, WithGroupKey(partition), WithStageRetry(2, Backoff{}))
+	require.NoError(t, err)
+	require.Len(t, consumer.groups, 2)
+	require.Equal(t, []int{1}, producer.Committed())
+}
+
+func TestPipe_GroupKeyGroupedConsumerDeadline(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	defer close(release)
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a:1"}, 1)
+	consumer := &groupedConsumer{fail: func(int) error {
+		<-release
+		return nil
+	}}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(producer, consumer, 10, WithGroupKey(partition), WithClock(clock), WithPerBatchTimeout(time.Minute))
+	}()
+
+	var err error
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Minute)
+		select {
+		case err = <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, producer.Committed())
+}
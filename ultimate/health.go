@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StageHealth — состояние одной стадии pipeline
+type StageHealth struct {
+	// Running — горутина стадии запущена и ещё не завершилась
+	Running bool
+	// LastProgress — время последнего завершённого вызова Next, Process или
+	// Commit в стадии; нулевое, если вызовов ещё не было
+	LastProgress time.Time
+}
+
+// PipeHealth — снимок живости стадий pipeline
+type PipeHealth struct {
+	Next    StageHealth
+	Process StageHealth
+	Commit  StageHealth
+}
+
+// stageLiveness хранит состояние стадии в атомиках, чтобы Health не
+// блокировал горячий путь
+type stageLiveness struct {
+	running      atomic.Bool
+	lastProgress atomic.Int64 // UnixNano, 0 — прогресса не было
+}
+
+func (s *stageLiveness) snapshot() StageHealth {
+	h := StageHealth{Running: s.running.Load()}
+	if ns := s.lastProgress.Load(); ns != 0 {
+		h.LastProgress = time.Unix(0, ns)
+	}
+	return h
+}
+
+// pipeHealth — состояние всех стадий pipeline
+type pipeHealth struct {
+	next, process, commit stageLiveness
+}
+
+func (h *pipeHealth) stage(name string) *stageLiveness {
+	switch name {
+	case StageNext:
+		return &h.next
+	case StageProcess:
+		return &h.process
+	default:
+		return &h.commit
+	}
+}
+
+// Health возвращает время последнего прогресса каждой стадии и признак того,
+// что её горутина ещё работает. Не берёт блокировок и безопасен для вызова из
+// любой горутины. При синхронной фиксации отдельной стадии Commit нет, и
+// Commit.Running всегда false, а LastProgress обновляет стадия Process.
+func (ctrl *Controller) Health() PipeHealth {
+	return PipeHealth{
+		Next:    ctrl.health.next.snapshot(),
+		Process: ctrl.health.process.snapshot(),
+		Commit:  ctrl.health.commit.snapshot(),
+	}
+}
+
+// trackStage отмечает стадию работающей на время выполнения run и
+// помечает её горутину pprof-метками
+func (pp *pipe) trackStage(name string, run StageFunc) StageFunc {
+	s := pp.ctrl.health.stage(name)
+	return func(cancelCh <-chan struct{}) error {
+		s.running.Store(true)
+		defer s.running.Store(false)
+		return pp.labeled(name, func() error {
+			return run(cancelCh)
+		})
+	}
+}
+
+// enterStage отмечает начало вызова источника или потребителя в стадии
+func (pp *pipe) enterStage(name string) {
+	pp.stall.enter(name)
+}
+
+// leaveStage отмечает завершение вызова в стадии как её прогресс
+func (pp *pipe) leaveStage(name string) {
+	pp.stall.leave(name)
+	pp.ctrl.health.stage(name).lastProgress.Store(pp.opts.clock.Now().UnixNano())
+}
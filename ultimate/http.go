@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultHTTPAttempts — число попыток запроса HTTPBatchConsumer по умолчанию
+const defaultHTTPAttempts = 3
+
+// HTTPDoer — часть *http.Client, нужная HTTPBatchConsumer
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HTTPBatchConsumer отправляет батч POST-запросами в JSON-массиве. Батч
+// делится на запросы так, чтобы в каждом было не больше MaxItems элементов
+// и не больше MaxBytes байт тела. Ответ 2xx — успех; 5xx и ошибки
+// транспорта повторяются с паузой, удваивающейся с каждой попыткой; прочие
+// статусы и исчерпание попыток завершают Process ошибкой ErrProcessFailed.
+//
+// При ошибке батч будет повторён целиком, в том числе уже принятые API
+// запросы, поэтому получатель должен быть идемпотентным.
+type HTTPBatchConsumer struct {
+	// MaxItems — наибольшее число элементов в запросе; 0 — без ограничения
+	MaxItems int
+	// MaxBytes — наибольший размер тела запроса; 0 — без ограничения.
+	// Элемент, не помещающийся в запрос даже один, даёт ErrBatchTooLarge.
+	MaxBytes int
+	// Attempts — число попыток одного запроса, по умолчанию 3
+	Attempts int
+	// Backoff — пауза перед второй попыткой; дальше она удваивается
+	Backoff Backoff
+	// Header — заголовки, добавляемые к каждому запросу
+	Header http.Header
+
+	client HTTPDoer
+	url    string
+	encode func(item any) ([]byte, error)
+}
+
+// NewHTTPBatchConsumer создаёт потребителя, отправляющего элементы на url
+// через client. encode кодирует элемент в JSON; nil — json.Marshal.
+func NewHTTPBatchConsumer(client HTTPDoer, url string, encode func(item any) ([]byte, error)) *HTTPBatchConsumer {
+	if encode == nil {
+		encode = json.Marshal
+	}
+	return &HTTPBatchConsumer{client: client, url: url, encode: encode}
+}
+
+func (c *HTTPBatchConsumer) Process(items []any) error {
+	return c.ProcessCtx(context.Background(), items)
+}
+
+// ProcessCtx отправляет батч; отмена ctx прерывает запрос и паузу перед
+// повтором
+func (c *HTTPBatchConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	encoded := make([][]byte, len(items))
+	for i, item := range items {
+		data, err := c.encode(item)
+		if err != nil {
+			return fmt.Errorf("%w: encode item %d: %w", ErrProcessFailed, i, err)
+		}
+		if c.MaxBytes > 0 && len(data)+2 > c.MaxBytes {
+			return fmt.Errorf("%w: %w: item %d is %d bytes, limit %d", ErrProcessFailed, ErrBatchTooLarge, i, len(data), c.MaxBytes)
+		}
+		encoded[i] = data
+	}
+
+	for start := 0; start < len(encoded); {
+		end := c.chunkEnd(encoded, start)
+		if err := c.send(ctx, encoded[start:end]); err != nil {
+			return fmt.Errorf("%w: items %d-%d: %w", ErrProcessFailed, start, end-1, err)
+		}
+		start = end
+	}
+	return nil
+}
+
+// chunkEnd возвращает конец наибольшего запроса, начинающегося с start
+func (c *HTTPBatchConsumer) chunkEnd(encoded [][]byte, start int) int {
+	size := 2 // скобки массива
+	end := start
+	for end < len(encoded) {
+		if c.MaxItems > 0 && end-start >= c.MaxItems {
+			break
+		}
+		next := size + len(encoded[end])
+		if end > start {
+			next++ // запятая
+		}
+		if c.MaxBytes > 0 && next > c.MaxBytes {
+			break
+		}
+		size = next
+		end++
+	}
+	return end
+}
+
+// send выполняет запрос с повторами
+func (c *HTTPBatchConsumer) send(ctx context.Context, chunk [][]byte) error {
+	body := append([]byte{'['}, bytes.Join(chunk, []byte{','})...)
+	body = append(body, ']')
+
+	attempts := c.Attempts
+	if attempts <= 0 {
+		attempts = defaultHTTPAttempts
+	}
+	clock := c.Backoff.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	delay := c.Backoff.delays()
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if d := delay() << (i - 1); d > 0 {
+				select {
+				case <-clock.After(d):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		var retry bool
+		if retry, err = c.post(ctx, body); !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("%d attempts: %w", attempts, err)
+}
+
+// post выполняет одну попытку и сообщает, стоит ли её повторить
+func (c *HTTPBatchConsumer) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	// тело читается до конца, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("POST %s: %s", c.url, resp.Status)
+	default:
+		return false, fmt.Errorf("POST %s: %s", c.url, resp.Status)
+	}
+}
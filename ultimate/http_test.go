@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransport отвечает статусами из statuses по очереди, а после их
+// окончания — 200, и записывает тела запросов
+type fakeTransport struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bodies = append(t.bodies, string(body))
+	status := http.StatusOK
+	if len(t.statuses) > 0 {
+		status, t.statuses = t.statuses[0], t.statuses[1:]
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func (t *fakeTransport) requests() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bodies
+}
+
+func newHTTPTestConsumer(transport *fakeTransport) *HTTPBatchConsumer {
+	return NewHTTPBatchConsumer(&http.Client{Transport: transport}, "http://api.test/items", nil)
+}
+
+func TestHTTPBatchConsumer_ChunksByItemCount(t *testing.T) {
+	transport := &fakeTransport{}
+	c := newHTTPTestConsumer(transport)
+	c.MaxItems = 2
+
+	require.NoError(t, c.Process([]any{1, 2, 3, 4, 5}))
+	require.Equal(t, []string{"[1,2]", "[3,4]", "[5]"}, transport.requests())
+}
+
+func TestHTTPBatchConsumer_ChunksByBytes(t *testing.T) {
+	transport := &fakeTransport{}
+	c := newHTTPTestConsumer(transport)
+	// `["aaaa","bbbb"]` — ровно 15 байт, третий элемент уже не помещается
+	c.MaxBytes = 15
+
+	require.NoError(t, c.Process([]any{"aaaa", "bbbb", "cccc"}))
+	require.Equal(t, []string{`["aaaa","bbbb"]`, `["cccc"]`}, transport.requests())
+	for _, body := range transport.requests() {
+		require.LessOrEqual(t, len(body), c.MaxBytes)
+		require.True(t, json.Valid([]byte(body)))
+	}
+}
+
+func TestHTTPBatchConsumer_ItemTooLarge(t *testing.T) {
+	transport := &fakeTransport{}
+	c := newHTTPTestConsumer(transport)
+	c.MaxBytes = 5
+
+	err := c.Process([]any{"too long"})
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, ErrBatchTooLarge)
+	require.Empty(t, transport.requests())
+}
+
+func TestHTTPBatchConsumer_RetriesServerErrors(t *testing.T) {
+	transport := &fakeTransport{statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway}}
+	clock := &sleepRecorder{}
+	c := newHTTPTestConsumer(transport)
+	c.Backoff = Backoff{Base: 100 * time.Millisecond, Clock: clock}
+
+	require.NoError(t, c.Process([]any{1}))
+	require.Equal(t, []string{"[1]", "[1]", "[1]"}, transport.requests())
+	require.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, clock.sleeps)
+}
+
+func TestHTTPBatchConsumer_PermanentFailure(t *testing.T) {
+	t.Run("client error is not retried", func(t *testing.T) {
+		transport := &fakeTransport{statuses: []int{http.StatusBadRequest}}
+		c := newHTTPTestConsumer(transport)
+
+		err := c.Process([]any{1})
+		require.ErrorIs(t, err, ErrProcessFailed)
+		require.ErrorContains(t, err, "400 Bad Request")
+		require.Len(t, transport.requests(), 1)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		transport := &fakeTransport{statuses: []int{500, 500, 500}}
+		c := newHTTPTestConsumer(transport)
+		c.Attempts = 2
+
+		err := c.Process([]any{1})
+		require.ErrorIs(t, err, ErrProcessFailed)
+		require.ErrorContains(t, err, "2 attempts")
+		require.Len(t, transport.requests(), 2)
+	})
+}
+
+func TestPipe_HTTPBatchConsumer(t *testing.T) {
+	transport := &fakeTransport{statuses: []int{http.StatusInternalServerError}}
+	c := newHTTPTestConsumer(transport)
+	c.MaxItems = 3
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6, 7}, 2)
+
+	require.NoError(t, Pipe(source, c, 10))
+	require.Equal(t, []string{"[1,2,3]", "[1,2,3]", "[4,5,6]", "[7]"}, transport.requests())
+	require.NotEmpty(t, source.Committed())
+}
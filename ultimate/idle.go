@@ -0,0 +1,37 @@
+package main
+
+// idleSignal — обратный сигнал от стадии обработки к runNext: обработка
+// ждёт батч, а ожидающих батчей в канале нет
+type idleSignal chan struct{}
+
+func newIdleSignal(enabled bool) idleSignal {
+	if !enabled {
+		return nil
+	}
+	return make(idleSignal, 1)
+}
+
+// notify сообщает, что стадия обработки простаивает. Повторные сигналы
+// схлопываются в один.
+func (s idleSignal) notify() {
+	if s == nil {
+		return
+	}
+	select {
+	case s <- struct{}{}:
+	default:
+	}
+}
+
+// consume забирает сигнал, если он есть
+func (s idleSignal) consume() bool {
+	if s == nil {
+		return false
+	}
+	select {
+	case <-s:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// pacedProducer отдаёт total элементов по одному с паузой delay перед
+// каждым Next
+type pacedProducer struct {
+	total int
+	delay time.Duration
+	calls int
+}
+
+func (p *pacedProducer) Next() ([]any, int, error) {
+	time.Sleep(p.delay)
+	p.calls++
+	if p.calls > p.total {
+		return nil, 0, ErrEofCommitCookie
+	}
+	return []any{p.calls}, p.calls, nil
+}
+
+func (p *pacedProducer) Commit(int) error { return nil }
+
+func runPaced(t *testing.T, opts ...Option) [][]any {
+	t.Helper()
+	var mu sync.Mutex
+	var batches [][]any
+	c := ConsumerFunc(func(items []any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, append([]any(nil), items...))
+		return nil
+	})
+	require.NoError(t, Pipe(&pacedProducer{total: 5, delay: 5 * time.Millisecond}, c, 10, opts...))
+	return batches
+}
+
+func TestPipe_EagerFlushWhenIdle(t *testing.T) {
+	batches := runPaced(t, WithEagerFlushWhenIdle())
+
+	// обработка простаивает с самого начала: первый элемент уходит сразу,
+	// не дожидаясь остальных
+	require.Greater(t, len(batches), 1)
+	require.Equal(t, []any{1}, batches[0])
+	var items []any
+	for _, b := range batches {
+		items = append(items, b...)
+	}
+	require.Equal(t, []any{1, 2, 3, 4, 5}, items)
+}
+
+func TestPipe_NoEagerFlushByDefault(t *testing.T) {
+	batches := runPaced(t)
+
+	require.Equal(t, [][]any{{1, 2, 3, 4, 5}}, batches)
+}
+
+// agingProducer перед выдачей каждого элемента переводит часы на gaps[i]
+type agingProducer struct {
+	clock *fakeClock
+	gaps  []time.Duration
+	calls int
+}
+
+func (p *agingProducer) Next() ([]any, int, error) {
+	if p.calls >= len(p.gaps) {
+		return nil, 0, ErrEofCommitCookie
+	}
+	p.clock.Advance(p.gaps[p.calls])
+	p.calls++
+	return []any{p.calls}, p.calls, nil
+}
+
+func (p *agingProducer) Commit(int) error { return nil }
+
+func TestPipe_PartialFlushAfter(t *testing.T) {
+	clock := newFakeClock()
+	producer := &agingProducer{clock: clock, gaps: []time.Duration{
+		0, 3 * time.Second, 3 * time.Second, // элементу 1 шесть секунд
+		5 * time.Second,  // элементу 1 одиннадцать секунд: сброс [1 2 3 4]
+		time.Second,      // элемент 5 начинает новый буфер
+		20 * time.Second, // элементу 5 двадцать секунд: сброс [5 6]
+		time.Second,      // элемент 7 молод и уходит только по концу данных
+	}}
+	var batches [][]any
+	consumer := ConsumerFunc(func(items []any) error {
+		batches = append(batches, append([]any(nil), items...))
+		return nil
+	})
+
+	err := Pipe(producer, consumer, 10, WithClock(clock), WithPartialFlushAfter(10*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, [][]any{{1, 2, 3, 4}, {5, 6}, {7}}, batches)
+}
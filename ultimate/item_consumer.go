@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ItemConsumer — потребитель, обрабатывающий элементы независимо друг от
+// друга. Если Consumer реализует этот интерфейс, runProcess вызывает
+// ProcessItem для каждого элемента вместо Process для всего батча.
+type ItemConsumer interface {
+	ProcessItem(item any) error
+}
+
+// ItemError — ошибка обработки одного элемента батча
+type ItemError struct {
+	Index int
+	Item  any
+	Err   error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchResult — итог обработки одного батча
+type BatchResult struct {
+	// Size — число элементов в батче
+	Size int
+	// Cookies — cookie батча в порядке выдачи источником
+	Cookies []int
+	// ItemErrors — ошибки отдельных элементов при поэлементной обработке
+	ItemErrors []ItemError
+
+	// Поля ниже заполняются только в результатах PipeStream
+
+	// ProcessErr — ошибка, из-за которой батч не был обработан
+	ProcessErr error
+	// CommitErr — ошибка фиксации cookie батча
+	CommitErr error
+	// Started — момент отправки батча в обработку
+	Started time.Time
+	// Finished — момент фиксации последнего cookie батча или его сбоя
+	Finished time.Time
+}
+
+// Err объединяет ошибки элементов в одну
+func (r BatchResult) Err() error {
+	errs := make([]error, len(r.ItemErrors))
+	for i, e := range r.ItemErrors {
+		errs[i] = e
+	}
+	return errors.Join(errs...)
+}
+
+// processItems обрабатывает батч поэлементно. Ошибки элементов передаются
+// в обработчик WithItemErrorHandler, и батч считается обработанным; без
+// обработчика они, как и раньше, валят весь батч.
+func (pp *pipe) processItems(ic ItemConsumer, b batch) error {
+	result := BatchResult{Size: len(b.buf), Cookies: b.cookies}
+	for i, item := range b.buf {
+		if err := ic.ProcessItem(item); err != nil {
+			result.ItemErrors = append(result.ItemErrors, ItemError{Index: i, Item: item, Err: err})
+		}
+	}
+	if len(result.ItemErrors) == 0 {
+		return nil
+	}
+	if pp.opts.onItemErrors == nil {
+		return result.Err()
+	}
+	pp.opts.onItemErrors(result)
+	return nil
+}
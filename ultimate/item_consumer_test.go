@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// itemConsumer обрабатывает элементы по одному и падает на заданном
+type itemConsumer struct {
+	failOn any
+
+	mu        sync.Mutex
+	processed []any
+}
+
+func (c *itemConsumer) Process(items []any) error {
+	return errors.New("batch mode must not be used")
+}
+
+func (c *itemConsumer) ProcessItem(item any) error {
+	if item == c.failOn {
+		return errors.New("bad item")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processed = append(c.processed, item)
+	return nil
+}
+
+func TestPipe_ItemConsumerReportsPerItemErrors(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &itemConsumer{failOn: "item2"}
+	maxItems := 10
+
+	producer.On("Next").Return([]any{"item1", "item2", "item3"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	// Батч фиксируется несмотря на ошибку одного элемента
+	producer.On("Commit", 1).Return(nil).Once()
+
+	var results []BatchResult
+	err := Pipe(producer, consumer, maxItems, WithItemErrorHandler(func(r BatchResult) {
+		results = append(results, r)
+	}))
+	require.NoError(t, err)
+
+	require.Equal(t, []any{"item1", "item3"}, consumer.processed)
+	require.Len(t, results, 1)
+	require.Equal(t, 3, results[0].Size)
+	require.Equal(t, []int{1}, results[0].Cookies)
+	require.Len(t, results[0].ItemErrors, 1)
+	require.Equal(t, 1, results[0].ItemErrors[0].Index)
+	require.ErrorContains(t, results[0].Err(), "item 1: bad item")
+
+	producer.AssertExpectations(t)
+}
+
+func TestPipe_ItemConsumerWithoutHandlerFails(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &itemConsumer{failOn: "item2"}
+	maxItems := 10
+
+	producer.On("Next").Return([]any{"item1", "item2", "item3"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	err := Pipe(producer, consumer, maxItems)
+	require.ErrorIs(t, err, ErrProcessFailed)
+
+	producer.AssertNotCalled(t, "Commit", 1)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// JSONLinesProducer читает newline-delimited JSON: каждая строка — один
+// элемент map[string]any, cookie — номер строки, начиная с 1. Числа
+// декодируются в json.Number, чтобы большие целые не теряли точность.
+type JSONLinesProducer struct {
+	// SkipMalformed пропускает строки с некорректным JSON вместо ошибки
+	SkipMalformed bool
+
+	scanner   *bufio.Scanner
+	line      int
+	committed atomic.Int64
+}
+
+// NewJSONLinesProducer создаёт источник поверх r
+func NewJSONLinesProducer(r io.Reader) *JSONLinesProducer {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &JSONLinesProducer{scanner: scanner}
+}
+
+func (p *JSONLinesProducer) Next() ([]any, int, error) {
+	for p.scanner.Scan() {
+		p.line++
+		raw := p.scanner.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		item, err := decodeJSONLine(raw)
+		if err != nil {
+			if p.SkipMalformed {
+				continue
+			}
+			return nil, 0, fmt.Errorf("line %d: %w", p.line, err)
+		}
+		return []any{item}, p.line, nil
+	}
+	if err := p.scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return nil, 0, ErrEofCommitCookie
+}
+
+// decodeJSONLine декодирует строку в объект, сохраняя числа как json.Number
+func decodeJSONLine(raw []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var item map[string]any
+	if err := dec.Decode(&item); err != nil {
+		return nil, err
+	}
+	// как и json.Unmarshal, не допускаем ничего после объекта
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	return item, nil
+}
+
+// Commit запоминает номер последней подтверждённой строки
+func (p *JSONLinesProducer) Commit(cookie int) error {
+	p.committed.Store(int64(cookie))
+	return nil
+}
+
+// Committed возвращает номер последней подтверждённой строки
+func (p *JSONLinesProducer) Committed() int {
+	return int(p.committed.Load())
+}
+
+// JSONLinesConsumer записывает каждый элемент батча отдельной строкой JSON
+type JSONLinesConsumer struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesConsumer создаёт потребителя поверх w
+func NewJSONLinesConsumer(w io.Writer) *JSONLinesConsumer {
+	return &JSONLinesConsumer{enc: json.NewEncoder(w)}
+}
+
+func (c *JSONLinesConsumer) Process(items []any) error {
+	for _, item := range items {
+		if err := c.enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
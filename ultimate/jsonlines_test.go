@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLines_RoundTrip(t *testing.T) {
+	input := `{"id":1,"name":"a"}
+{"id":2,"name":"b"}
+
+{"id":3,"name":"c"}
+`
+	producer := NewJSONLinesProducer(strings.NewReader(input))
+	var out bytes.Buffer
+
+	err := Pipe(producer, NewJSONLinesConsumer(&out), 2)
+	require.NoError(t, err)
+
+	// Пустая строка пропущена, порядок сохранён
+	require.Equal(t, strings.Replace(input, "\n\n", "\n", 1), out.String())
+	require.Equal(t, 4, producer.Committed())
+}
+
+func TestJSONLines_LargeNumbers(t *testing.T) {
+	// 2^53 + 1 не представимо в float64
+	input := "{\"id\":9007199254740993,\"price\":0.1}\n"
+	producer := NewJSONLinesProducer(strings.NewReader(input))
+	var out bytes.Buffer
+
+	err := Pipe(producer, NewJSONLinesConsumer(&out), 10)
+	require.NoError(t, err)
+	require.Equal(t, input, out.String())
+}
+
+func TestJSONLines_Malformed(t *testing.T) {
+	input := "{\"id\":1}\nnot json\n{\"id\":2}\n{\"id\":3} {}\n"
+
+	var out bytes.Buffer
+	err := Pipe(NewJSONLinesProducer(strings.NewReader(input)), NewJSONLinesConsumer(&out), 10)
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.Contains(t, err.Error(), "line 2")
+
+	out.Reset()
+	producer := NewJSONLinesProducer(strings.NewReader(input))
+	producer.SkipMalformed = true
+	err = Pipe(producer, NewJSONLinesConsumer(&out), 10)
+	require.NoError(t, err)
+	// хвост после объекта — тоже некорректная строка
+	require.Equal(t, "{\"id\":1}\n{\"id\":2}\n", out.String())
+}
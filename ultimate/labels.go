@@ -0,0 +1,21 @@
+package main
+
+import "github.com/EmirShimshir/buffered-reader-writer/internal/stagelabel"
+
+// pprof-метки горутин стадий. По ним стадии и pipeline различимы в
+// профилях и дампах горутин.
+const (
+	// LabelStage — стадия: next, process или commit
+	LabelStage = stagelabel.Stage
+	// LabelName — имя pipeline из WithName, если оно задано
+	LabelName = stagelabel.Name
+)
+
+// labeled выполняет стадию с pprof-метками; горутины, запущенные внутри,
+// наследуют их
+func (pp *pipe) labeled(stage string, run func() error) error {
+	if pp.opts.name != "" {
+		return stagelabel.Do(pp.ctx, stage, run, LabelName, pp.opts.name)
+	}
+	return stagelabel.Do(pp.ctx, stage, run)
+}
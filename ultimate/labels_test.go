@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_StageGoroutineLabels(t *testing.T) {
+	release := make(chan struct{})
+	consumer := ConsumerFunc(func([]any) error {
+		<-release
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(pipetest.NewCountingProducer(ErrEofCommitCookie, 100, 1), consumer, 1, WithName("orders"))
+	}()
+
+	// кроме стадий горутины несут имя pipeline
+	pipetest.AwaitGoroutineLabels(t,
+		LabelStage, StageNext, LabelStage, StageProcess, LabelStage, StageCommit,
+		LabelName, "orders")
+	close(release)
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConsumerFunc позволяет использовать обычную функцию как Consumer
+type ConsumerFunc func(items []any) error
+
+func (f ConsumerFunc) Process(items []any) error {
+	return f(items)
+}
+
+// ConsumerMiddleware оборачивает Consumer дополнительным поведением
+type ConsumerMiddleware func(Consumer) Consumer
+
+// Chain оборачивает c в цепочку middleware. Первая middleware — самая
+// внешняя: Chain(c, a, b) эквивалентно a(b(c)).
+func Chain(c Consumer, mws ...ConsumerMiddleware) Consumer {
+	for i := len(mws) - 1; i >= 0; i-- {
+		c = mws[i](c)
+	}
+	return c
+}
+
+// RetryMiddleware повторяет Process до attempts раз с паузой backoff между
+// попытками и возвращает ошибку последней попытки. ErrCircuitOpen и ошибки,
+// помеченные неповторяемыми через RetryableError, не повторяются.
+// attempts меньше 1 считается 1: Process вызывается хотя бы раз.
+// Паузы выдерживаются по clock; nil — реальное время.
+func RetryMiddleware(attempts int, backoff time.Duration, clock Clock) ConsumerMiddleware {
+	return RetryWithBackoff(attempts, Backoff{Base: backoff, Clock: clock})
+}
+
+// Backoff описывает паузу между повторами
+type Backoff struct {
+	// Base — пауза без разброса
+	Base time.Duration
+	// Jitter — доля случайного разброса от 0 до 1: пауза выбирается
+	// равномерно из [Base*(1-Jitter), Base]. 1 — full jitter, пауза от 0 до
+	// Base. Разброс не даёт многим pipeline повторять запросы к общему
+	// бэкенду одновременно.
+	Jitter float64
+	// Rand — источник случайности для разброса; фиксированный seed делает
+	// паузы воспроизводимыми. nil — общий источник math/rand.
+	Rand *rand.Rand
+	// Clock — часы, по которым выдерживается пауза; nil — реальное время
+	Clock Clock
+}
+
+// delays возвращает генератор пауз. Rand не потокобезопасен, поэтому
+// генератор защищён мьютексом.
+func (b Backoff) delays() func() time.Duration {
+	jitter := min(max(b.Jitter, 0), 1)
+	var mu sync.Mutex
+	return func() time.Duration {
+		if jitter == 0 || b.Base <= 0 {
+			return b.Base
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		var r float64
+		if b.Rand != nil {
+			r = b.Rand.Float64()
+		} else {
+			r = rand.Float64()
+		}
+		return b.Base - time.Duration(jitter*r*float64(b.Base))
+	}
+}
+
+// RetryWithBackoff работает как RetryMiddleware, но паузы между попытками
+// задаёт backoff, в том числе со случайным разбросом
+func RetryWithBackoff(attempts int, backoff Backoff) ConsumerMiddleware {
+	// без единой попытки батч считался бы обработанным и его cookie
+	// зафиксировались бы
+	attempts = max(attempts, 1)
+	clock := backoff.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	delay := backoff.delays()
+	return func(next Consumer) Consumer {
+		return ConsumerFunc(func(items []any) error {
+			var err error
+			for i := 0; i < attempts; i++ {
+				if i > 0 {
+					if d := delay(); d > 0 {
+						<-clock.After(d)
+					}
+				}
+				if err = next.Process(items); err == nil || errors.Is(err, ErrCircuitOpen) || isFatal(err) {
+					return err
+				}
+			}
+			return err
+		})
+	}
+}
+
+// TimingMiddleware сообщает в observe размер батча, длительность Process и его
+// результат. Длительность меряется по clock; nil — реальное время.
+func TimingMiddleware(observe func(items int, elapsed time.Duration, err error), clock Clock) ConsumerMiddleware {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return func(next Consumer) Consumer {
+		return ConsumerFunc(func(items []any) error {
+			start := clock.Now()
+			err := next.Process(items)
+			observe(len(items), clock.Now().Sub(start), err)
+			return err
+		})
+	}
+}
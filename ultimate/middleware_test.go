@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain_RetryOverFlakyConsumer(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 10
+
+	data := []any{"item1", "item2"}
+	producer.On("Next").Return(data, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+
+	// Потребитель падает дважды, затем успешно обрабатывает батч
+	flakyErr := errors.New("flaky")
+	consumer.On("Process", data).Return(flakyErr).Twice()
+	consumer.On("Process", data).Return(nil).Once()
+
+	var timings []int
+	chained := Chain(consumer,
+		TimingMiddleware(func(items int, _ time.Duration, err error) {
+			require.NoError(t, err)
+			timings = append(timings, items)
+		}, nil),
+		RetryMiddleware(3, 0, nil),
+	)
+
+	err := Pipe(producer, chained, maxItems)
+	require.NoError(t, err)
+
+	consumer.AssertNumberOfCalls(t, "Process", 3)
+	// Timing — внешняя middleware и видит один вызов на весь retry
+	require.Equal(t, []int{2}, timings)
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestChain_RetryExhausted(t *testing.T) {
+	flakyErr := errors.New("flaky")
+	calls := 0
+	consumer := Chain(ConsumerFunc(func(items []any) error {
+		calls++
+		return flakyErr
+	}), RetryMiddleware(2, time.Millisecond, nil))
+
+	err := consumer.Process([]any{"item1"})
+	require.ErrorIs(t, err, flakyErr)
+	require.Equal(t, 2, calls)
+}
+
+func TestChain_RetryZeroAttemptsCallsOnce(t *testing.T) {
+	flakyErr := errors.New("flaky")
+	for _, attempts := range []int{0, -1} {
+		calls := 0
+		consumer := Chain(ConsumerFunc(func(items []any) error {
+			calls++
+			return flakyErr
+		}), RetryMiddleware(attempts, time.Millisecond, nil))
+
+		err := consumer.Process([]any{"item1"})
+		require.ErrorIs(t, err, flakyErr)
+		require.Equal(t, 1, calls)
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	mw := func(name string) ConsumerMiddleware {
+		return func(next Consumer) Consumer {
+			return ConsumerFunc(func(items []any) error {
+				order = append(order, name)
+				return next.Process(items)
+			})
+		}
+	}
+	consumer := Chain(ConsumerFunc(func([]any) error {
+		order = append(order, "consumer")
+		return nil
+	}), mw("first"), mw("second"))
+
+	require.NoError(t, consumer.Process(nil))
+	require.Equal(t, []string{"first", "second", "consumer"}, order)
+}
+
+// sleepRecorder — Clock, который не ждёт, а записывает запрошенные паузы
+type sleepRecorder struct {
+	realClock
+	sleeps []time.Duration
+}
+
+func (c *sleepRecorder) After(d time.Duration) <-chan time.Time {
+	c.sleeps = append(c.sleeps, d)
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+func retrySleeps(seed int64, jitter float64) []time.Duration {
+	clock := &sleepRecorder{}
+	failing := ConsumerFunc(func([]any) error { return errors.New("backend down") })
+	retry := RetryWithBackoff(11, Backoff{
+		Base:   100 * time.Millisecond,
+		Jitter: jitter,
+		Rand:   rand.New(rand.NewSource(seed)),
+		Clock:  clock,
+	})
+	_ = retry(failing).Process([]any{1})
+	return clock.sleeps
+}
+
+func TestRetryWithBackoff_Jitter(t *testing.T) {
+	sleeps := retrySleeps(42, 0.5)
+
+	require.Len(t, sleeps, 10)
+	for _, d := range sleeps {
+		require.GreaterOrEqual(t, d, 50*time.Millisecond)
+		require.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+	require.NotEqual(t, sleeps[0], sleeps[1], "jitter must vary pauses")
+	// с тем же seed паузы воспроизводятся
+	require.Equal(t, sleeps, retrySleeps(42, 0.5))
+}
+
+func TestRetryWithBackoff_FullJitterAndNone(t *testing.T) {
+	for _, d := range retrySleeps(7, 1) {
+		require.GreaterOrEqual(t, d, time.Duration(0))
+		require.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+	for _, d := range retrySleeps(7, 0) {
+		require.Equal(t, 100*time.Millisecond, d)
+	}
+}
+
+func TestTimingMiddleware_UsesClock(t *testing.T) {
+	clock := newFakeClock()
+	var elapsed time.Duration
+	consumer := Chain(ConsumerFunc(func(items []any) error {
+		clock.Advance(5 * time.Second)
+		return nil
+	}), TimingMiddleware(func(_ int, d time.Duration, _ error) { elapsed = d }, clock))
+
+	require.NoError(t, consumer.Process([]any{1}))
+	require.Equal(t, 5*time.Second, elapsed)
+}
+
+func TestRetryMiddleware_UsesClock(t *testing.T) {
+	clock := newFakeClock()
+	flakyErr := errors.New("flaky")
+	var calls atomic.Int32
+	consumer := Chain(ConsumerFunc(func(items []any) error {
+		if calls.Add(1) == 1 {
+			return flakyErr
+		}
+		return nil
+	}), RetryMiddleware(2, time.Hour, clock))
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.Process([]any{1}) }()
+
+	// пауза в час проходит только по фиктивным часам
+	var err error
+	require.Eventually(t, func() bool {
+		clock.Advance(time.Hour)
+		select {
+		case err = <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, calls.Load())
+}
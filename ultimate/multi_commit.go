@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Committer — получатель подтверждений cookie, например Commit источника
+type Committer interface {
+	Commit(cookie int) error
+}
+
+// RollbackCommitter — Committer, умеющий отменить уже выполненную фиксацию
+type RollbackCommitter interface {
+	Committer
+	Rollback(cookie int) error
+}
+
+// MultiCommitter фиксирует cookie сразу в нескольких получателях по принципу
+// «всё или ничего». Commit вызывает получателей по порядку; если один из них
+// вернул ошибку, уже успешные откатываются в обратном порядке через Rollback
+// (получатели без RollbackCommitter пропускаются), а ошибка возвращается
+// вызывающему. Источник, делегирующий свой Commit в MultiCommitter, так
+// останавливает pipeline с ErrCommitFailed.
+type MultiCommitter struct {
+	committers []Committer
+}
+
+// NewMultiCommitter создаёт MultiCommitter поверх committers
+func NewMultiCommitter(committers ...Committer) *MultiCommitter {
+	return &MultiCommitter{committers: committers}
+}
+
+// Commit фиксирует cookie во всех получателях или ни в одном. Ошибки отката
+// добавляются к возвращаемой ошибке.
+func (m *MultiCommitter) Commit(cookie int) error {
+	for i, c := range m.committers {
+		err := c.Commit(cookie)
+		if err == nil {
+			continue
+		}
+		errs := []error{fmt.Errorf("committer %d: %w", i, err)}
+		for j := i - 1; j >= 0; j-- {
+			rc, ok := m.committers[j].(RollbackCommitter)
+			if !ok {
+				continue
+			}
+			if err := rc.Rollback(cookie); err != nil {
+				errs = append(errs, fmt.Errorf("rollback committer %d: %w", j, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
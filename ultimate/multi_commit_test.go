@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// rollbackSink записывает фиксации и их откаты
+type rollbackSink struct {
+	pipetest.RecordingCommitter
+
+	mu          sync.Mutex
+	rolledBack  []int
+	rollbackErr error
+}
+
+func (s *rollbackSink) Rollback(cookie int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rolledBack = append(s.rolledBack, cookie)
+	return s.rollbackErr
+}
+
+func (s *rollbackSink) RolledBack() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.rolledBack...)
+}
+
+// multiSinkProducer делегирует Commit источника в MultiCommitter
+type multiSinkProducer struct {
+	*pipetest.ScriptedProducer
+	sinks *MultiCommitter
+}
+
+func (p *multiSinkProducer) Commit(cookie int) error {
+	return p.sinks.Commit(cookie)
+}
+
+func TestMultiCommitter_RollsBackOnFailure(t *testing.T) {
+	errSink := errors.New("sink unavailable")
+	first := &rollbackSink{}
+	second := &pipetest.RecordingCommitter{FailOn: map[int]error{2: errSink}}
+	producer := &multiSinkProducer{
+		ScriptedProducer: pipetest.NewScriptedProducer(ErrEofCommitCookie,
+			pipetest.Step{Items: []any{1}, Cookie: 1},
+			pipetest.Step{Items: []any{2}, Cookie: 2},
+			pipetest.Step{Items: []any{3}, Cookie: 3},
+		),
+		sinks: NewMultiCommitter(first, second),
+	}
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 1)
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.ErrorIs(t, err, errSink)
+
+	// cookie 2 зафиксирован в первом получателе и откатан
+	require.Equal(t, []int{1, 2}, first.Committed())
+	require.Equal(t, []int{2}, first.RolledBack())
+	require.Equal(t, []int{1}, second.Committed())
+}
+
+func TestMultiCommitter_RollbackErrorJoined(t *testing.T) {
+	errSink := errors.New("sink unavailable")
+	errRollback := errors.New("rollback failed")
+	first := &rollbackSink{rollbackErr: errRollback}
+	plain := &pipetest.RecordingCommitter{}
+	failing := &pipetest.RecordingCommitter{FailOn: map[int]error{7: errSink}}
+
+	err := NewMultiCommitter(first, plain, failing).Commit(7)
+	require.ErrorIs(t, err, errSink)
+	require.ErrorIs(t, err, errRollback)
+	// получатель без Rollback пропускается, остальные откатываются
+	require.Equal(t, []int{7}, first.RolledBack())
+	require.Equal(t, []int{7}, plain.Committed())
+
+	require.NoError(t, NewMultiCommitter(first, plain).Commit(8))
+	require.Equal(t, []int{7, 8}, first.Committed())
+}
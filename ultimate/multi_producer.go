@@ -0,0 +1,114 @@
+package main
+
+import "fmt"
+
+// MultiProducer объединяет несколько источников в один: Next опрашивает
+// их по кругу, а cookie отображаются в общее пространство так, чтобы Commit
+// можно было вернуть исходному источнику.
+//
+// Cookie источника i кодируется как cookie*len(producers) + i, поэтому
+// исходные cookie должны помещаться в int после умножения.
+type MultiProducer struct {
+	producers []Producer
+	weights   []int
+	active    []int // индексы ещё не исчерпанных источников
+	current   []int // текущие веса планировщика по индексу источника
+}
+
+// NewMultiProducer создаёт MultiProducer поверх переданных источников с
+// равными весами
+func NewMultiProducer(producers ...Producer) *MultiProducer {
+	return NewWeightedMultiProducer(nil, producers...)
+}
+
+// NewWeightedMultiProducer создаёт MultiProducer, в котором источник i
+// опрашивается пропорционально weights[i]: при весах 3 и 1 на каждые три
+// вызова Next первого источника приходится один вызов второго. Опросы
+// распределяются равномерно (smooth weighted round-robin), а не сериями.
+// Недостающие и неположительные веса считаются равными 1. Когда источник
+// исчерпан, остальные делят его долю пропорционально своим весам.
+func NewWeightedMultiProducer(weights []int, producers ...Producer) *MultiProducer {
+	m := &MultiProducer{
+		producers: producers,
+		weights:   make([]int, len(producers)),
+		active:    make([]int, len(producers)),
+		current:   make([]int, len(producers)),
+	}
+	for i := range producers {
+		m.active[i] = i
+		m.weights[i] = 1
+		if i < len(weights) && weights[i] > 0 {
+			m.weights[i] = weights[i]
+		}
+	}
+	return m
+}
+
+// Next возвращает данные очередного источника согласно весам.
+// ErrEofCommitCookie возвращается только когда исчерпаны все источники.
+func (m *MultiProducer) Next() ([]any, int, error) {
+	for len(m.active) > 0 {
+		pos := m.pick()
+		idx := m.active[pos]
+
+		items, cookie, err := m.producers[idx].Next()
+		if isEOF(err) {
+			m.active = append(m.active[:pos], m.active[pos+1:]...)
+			if len(items) == 0 {
+				continue
+			}
+			// последние элементы источника пришли вместе с EOF
+			return items, m.EncodeCookie(idx, cookie), nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("producer %d: %w", idx, err)
+		}
+		return items, m.EncodeCookie(idx, cookie), nil
+	}
+	return nil, 0, ErrEofCommitCookie
+}
+
+// pick выбирает позицию в active: каждый активный источник накапливает свой
+// вес, выбирается источник с наибольшим накопленным, и у него вычитается
+// сумма весов. При равных весах это обычный обход по кругу.
+func (m *MultiProducer) pick() int {
+	best, total := 0, 0
+	for pos, idx := range m.active {
+		m.current[idx] += m.weights[idx]
+		total += m.weights[idx]
+		if m.current[idx] > m.current[m.active[best]] {
+			best = pos
+		}
+	}
+	m.current[m.active[best]] -= total
+	return best
+}
+
+// Commit фиксирует cookie в том источнике, который его выдал
+func (m *MultiProducer) Commit(cookie int) error {
+	idx, inner := m.DecodeCookie(cookie)
+	if idx >= len(m.producers) {
+		return fmt.Errorf("unknown producer %d for cookie %d", idx, cookie)
+	}
+	return m.producers[idx].Commit(inner)
+}
+
+// EncodeCookie переводит cookie источника idx в общее пространство
+func (m *MultiProducer) EncodeCookie(idx, cookie int) int {
+	return encodeCookie(len(m.producers), idx, cookie)
+}
+
+// DecodeCookie возвращает индекс источника и его исходный cookie
+func (m *MultiProducer) DecodeCookie(cookie int) (idx, inner int) {
+	return decodeCookie(len(m.producers), cookie)
+}
+
+// encodeCookie кодирует cookie источника idx из n как cookie*n + idx
+func encodeCookie(n, idx, cookie int) int {
+	return cookie*n + idx
+}
+
+func decodeCookie(n, cookie int) (idx, inner int) {
+	idx = ((cookie % n) + n) % n
+	return idx, (cookie - idx) / n
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiProducer_RoundRobin(t *testing.T) {
+	first := &MockProducer{}
+	second := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 10
+
+	first.On("Next").Return([]any{"a1"}, 1, nil).Once()
+	first.On("Next").Return([]any{"a2"}, 2, nil).Once()
+	first.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	second.On("Next").Return([]any{"b1"}, 1, nil).Once()
+	second.On("Next").Return([]any{"b2"}, 2, nil).Once()
+	second.On("Next").Return([]any{"b3"}, 3, nil).Once()
+	second.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Источники чередуются, пока первый не исчерпан
+	consumer.On("Process", []any{"a1", "b1", "a2", "b2", "b3"}).Return(nil).Once()
+
+	// Каждый cookie возвращается своему источнику
+	first.On("Commit", 1).Return(nil).Once()
+	first.On("Commit", 2).Return(nil).Once()
+	second.On("Commit", 1).Return(nil).Once()
+	second.On("Commit", 2).Return(nil).Once()
+	second.On("Commit", 3).Return(nil).Once()
+
+	err := Pipe(NewMultiProducer(first, second), consumer, maxItems)
+	require.NoError(t, err)
+
+	first.AssertExpectations(t)
+	second.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestMultiProducer_CookieRoundTrip(t *testing.T) {
+	m := NewMultiProducer(&MockProducer{}, &MockProducer{}, &MockProducer{})
+
+	for idx := 0; idx < 3; idx++ {
+		for _, cookie := range []int{-7, -1, 0, 1, 42} {
+			gotIdx, gotCookie := m.DecodeCookie(m.EncodeCookie(idx, cookie))
+			require.Equal(t, idx, gotIdx)
+			require.Equal(t, cookie, gotCookie)
+		}
+	}
+}
+
+func TestMultiProducer_NextError(t *testing.T) {
+	first := &MockProducer{}
+	second := &MockProducer{}
+
+	nextErr := errors.New("partition down")
+	first.On("Next").Return([]any{}, 0, nextErr).Once()
+
+	m := NewMultiProducer(first, second)
+	_, _, err := m.Next()
+	require.ErrorIs(t, err, nextErr)
+	second.AssertNotCalled(t, "Next")
+}
+
+func TestWeightedMultiProducer_ProportionalShare(t *testing.T) {
+	m := NewWeightedMultiProducer([]int{3, 1},
+		pipetest.NewCountingProducer(ErrEofCommitCookie, 1000, 1),
+		pipetest.NewCountingProducer(ErrEofCommitCookie, 1000, 1),
+	)
+
+	counts := make([]int, 2)
+	for i := 0; i < 400; i++ {
+		_, cookie, err := m.Next()
+		require.NoError(t, err)
+		idx, _ := m.DecodeCookie(cookie)
+		counts[idx]++
+	}
+	require.InDelta(t, 300, counts[0], 3)
+	require.InDelta(t, 100, counts[1], 3)
+}
+
+func TestWeightedMultiProducer_DrainsAllSources(t *testing.T) {
+	heavy := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"h1", "h2", "h3", "h4"}, 1, 1, 1, 1)
+	light := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"l1", "l2", "l3"}, 1, 1, 1)
+	sink := &pipetest.RecordingConsumer{}
+
+	err := Pipe(NewWeightedMultiProducer([]int{3, 1}, heavy, light), sink, 100)
+	require.NoError(t, err)
+
+	// пока тяжёлый источник не исчерпан, он получает три опроса из четырёх
+	require.Equal(t, []any{"h1", "h2", "l1", "h3", "h4", "l2", "l3"}, sink.Items())
+	require.Equal(t, heavy.Cookies(), heavy.Committed())
+	require.Equal(t, light.Cookies(), light.Committed())
+}
@@ -0,0 +1,11 @@
+package main
+
+// NoCommitCookie — принятое значение cookie «фиксировать не нужно» для
+// WithNoCommitCookie: источник может отдавать его с элементами, которые не
+// требуют подтверждения
+const NoCommitCookie = -1
+
+// needsCommit сообщает, нужно ли фиксировать cookie
+func (pp *pipe) needsCommit(cookie int) bool {
+	return !pp.opts.noCommitSet || cookie != pp.opts.noCommit
+}
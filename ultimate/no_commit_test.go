@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_NoCommitCookie(t *testing.T) {
+	for _, maxItems := range []int{0, 2, 10} {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+				pipetest.Step{Items: []any{"a"}, Cookie: 1},
+				pipetest.Step{Items: []any{"heartbeat"}, Cookie: NoCommitCookie},
+				pipetest.Step{Items: []any{"b"}, Cookie: 2},
+				pipetest.Step{Items: []any{"metrics"}, Cookie: NoCommitCookie},
+				pipetest.Step{Items: []any{"c"}, Cookie: 3},
+			)
+			consumer := &pipetest.RecordingConsumer{}
+
+			stats, err := PipeWithStats(producer, consumer, maxItems, WithNoCommitCookie(NoCommitCookie))
+			require.NoError(t, err)
+			require.Equal(t, []any{"a", "heartbeat", "b", "metrics", "c"}, consumer.Items())
+			require.Equal(t, []int{1, 2, 3}, producer.Committed())
+			require.Equal(t, []int{1, 2, 3}, stats.CommittedCookies)
+			require.Empty(t, stats.UncommittedCookies)
+		})
+	}
+}
+
+func TestPipe_NoCommitCookieCustomValue(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"a"}, Cookie: 0},
+		pipetest.Step{Items: []any{"b"}, Cookie: NoCommitCookie},
+		pipetest.Step{Items: []any{"c"}, Cookie: 1},
+	)
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 0, WithNoCommitCookie(0))
+	require.NoError(t, err)
+	// нефиксируемым объявлен 0, поэтому -1 фиксируется как обычный cookie
+	require.Equal(t, []int{NoCommitCookie, 1}, producer.Committed())
+}
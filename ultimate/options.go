@@ -0,0 +1,693 @@
+package main
+
+import "time"
+
+// CommitMode определяет, когда фиксируются cookie
+type CommitMode int
+
+const (
+	// CommitPerBatch фиксирует cookie после обработки каждого батча
+	CommitPerBatch CommitMode = iota
+	// CommitAtEnd фиксирует все cookie одним проходом после успешной
+	// обработки всего потока и не фиксирует ничего, если какая-либо стадия
+	// упала или запуск отменён (кроме FlushFirst и WithCommitDrain). Все
+	// cookie запуска хранятся в памяти до конца потока.
+	CommitAtEnd
+)
+
+// Option настраивает поведение Pipe
+type Option func(*options)
+
+// options — итоговая конфигурация запуска Pipe
+type options struct {
+	name  string
+	clock Clock
+
+	maxBufferedItems    int
+	backpressureTimeout time.Duration
+
+	adaptive       bool
+	adaptiveMin    int
+	adaptiveMax    int
+	adaptiveTarget time.Duration
+
+	coalesce func(buf []any, incoming []any) []any
+
+	flushInterval time.Duration
+
+	onItemErrors func(BatchResult)
+
+	commitMode CommitMode
+
+	transform func(items []any) ([]any, error)
+
+	boundary func(buf []any, incoming []any) bool
+
+	copyBatch bool
+
+	errorMode ErrorMode
+
+	inlineCommit bool
+
+	drainTimeout time.Duration
+
+	tracer Tracer
+
+	offsetCommit bool
+
+	commitDrain bool
+
+	bufferStrategy BufferStrategy
+
+	commitConcurrency int
+
+	maxInflightBatches int
+
+	perBatchTimeout time.Duration
+
+	onBufferStart func()
+	onBufferEmpty func()
+
+	startAfter    int
+	startAfterSet bool
+
+	shutdown        ShutdownPreference
+	shutdownTimeout time.Duration
+
+	groupKey func(item any) any
+
+	stallTimeout time.Duration
+	onStall      func(stage string)
+	abortOnStall bool
+
+	commitLog CommitLog
+
+	commitDebounce time.Duration
+
+	onOversizedNext func(itemCount, maxItems int)
+
+	batchOrder BatchOrder
+
+	eagerFlushWhenIdle bool
+
+	endOnEmptyRun int
+
+	commitOnFlush       bool
+	commitFlushInterval time.Duration
+
+	dryRun bool
+
+	onFilteredCookies func(cookies []int)
+	commitFiltered    bool
+
+	statsTickInterval time.Duration
+	onStatsTick       func(PipeStats)
+
+	orderedCommit     bool
+	orderedFirst      int
+	orderedBufferSize int
+	orderedTimeout    time.Duration
+
+	headroomItems int
+
+	strictProducer bool
+
+	timeBudget    time.Duration
+	timeBudgetErr bool
+
+	batchKey func(cookies []int) string
+
+	atLeastOnce bool
+
+	strictMaxItems bool
+
+	noCommit    int
+	noCommitSet bool
+
+	partialFlushAfter time.Duration
+
+	stageRetry stageRetry
+
+	seed    int64
+	seedSet bool
+
+	maxUncommitted int
+}
+
+func defaultOptions() options {
+	return options{clock: realClock{}}
+}
+
+// WithName задаёт имя pipeline, чтобы различать несколько pipeline в одном
+// процессе: оно попадает в текст и JSON PipeError и в span трейсера,
+// реализующего NamedTracer
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithClock подменяет источник времени для всех таймеров и замеров pipeline
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithMaxBufferedItems ограничивает суммарное число элементов во всех батчах,
+// отданных в обработку, но ещё не обработанных. При превышении runNext ждёт
+// освобождения места, а если ожидание длится дольше timeout — завершается
+// с ErrBackpressureTimeout. timeout <= 0 означает ожидание без ограничения.
+func WithMaxBufferedItems(limit int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.maxBufferedItems = limit
+		o.backpressureTimeout = timeout
+	}
+}
+
+// WithAdaptiveBatching (экспериментально) включает подстройку порога сброса
+// буфера под задержку Process: быстрая обработка увеличивает батч, медленная —
+// уменьшает. Порог остаётся в [minBatch, maxBatch] и никогда не превышает maxItems.
+func WithAdaptiveBatching(minBatch, maxBatch int, target time.Duration) Option {
+	return func(o *options) {
+		o.adaptive = true
+		o.adaptiveMin = minBatch
+		o.adaptiveMax = maxBatch
+		o.adaptiveTarget = target
+	}
+}
+
+// WithCoalesce заменяет простое добавление элементов в буфер функцией
+// слияния, например для схлопывания дубликатов по ключу. Решение о сбросе
+// буфера по-прежнему принимается по сумме длин до слияния, cookie
+// накапливаются как обычно.
+func WithCoalesce(coalesce func(buf []any, incoming []any) []any) Option {
+	return func(o *options) {
+		o.coalesce = coalesce
+	}
+}
+
+// WithFlushInterval периодически сбрасывает неполный буфер. Next вызывается
+// синхронно, поэтому срабатывание таймера проверяется после каждого Next:
+// сброс происходит не раньше, чем вернётся очередной вызов источника.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.flushInterval = interval
+	}
+}
+
+// WithItemErrorHandler передаёт ошибки отдельных элементов ItemConsumer в
+// handler вместо аварийного завершения: батч при этом фиксируется целиком
+func WithItemErrorHandler(handler func(BatchResult)) Option {
+	return func(o *options) {
+		o.onItemErrors = handler
+	}
+}
+
+// WithCommitMode задаёт режим фиксации cookie, по умолчанию CommitPerBatch
+func WithCommitMode(mode CommitMode) Option {
+	return func(o *options) {
+		o.commitMode = mode
+	}
+}
+
+// WithTransform применяет transform к батчу перед Process. Возврат меньшего
+// числа элементов работает как фильтр, ошибка завершает стадию обработки с
+// ErrProcessFailed. Cookie отфильтрованных элементов всё равно фиксируются:
+// источник их уже выдал. Как обойтись с cookie батча, отфильтрованного
+// целиком, задаёт WithOnFilteredCookies.
+func WithTransform(transform func(items []any) ([]any, error)) Option {
+	return func(o *options) {
+		o.transform = transform
+	}
+}
+
+// WithBoundary задаёт логические границы батчей: если boundary возвращает
+// true, текущий буфер сбрасывается до добавления incoming, даже когда он
+// меньше maxItems. Ограничение по размеру при этом продолжает действовать.
+func WithBoundary(boundary func(buf []any, incoming []any) (flushBefore bool)) Option {
+	return func(o *options) {
+		o.boundary = boundary
+	}
+}
+
+// WithCopyBatch передаёт в Process собственную копию батча, снятую в момент
+// его формирования. Нужна потребителям, которые сохраняют полученный срез:
+// без копии он может разделять память с данными источника (например, при
+// maxItems == 0 батч — это срез, возвращённый Next, а WithCoalesce может
+// оставить его в буфере).
+func WithCopyBatch() Option {
+	return func(o *options) {
+		o.copyBatch = true
+	}
+}
+
+// WithErrorMode задаёт, как сводятся ошибки стадий, по умолчанию JoinAll
+func WithErrorMode(mode ErrorMode) Option {
+	return func(o *options) {
+		o.errorMode = mode
+	}
+}
+
+// WithInlineCommit фиксирует cookie прямо в стадии обработки после успешного
+// Process, без отдельной горутины Commit и канала cookie. Подходит для
+// небольших потоков, где лишняя стадия только добавляет задержку. Действует
+// только в режиме CommitPerBatch.
+func WithInlineCommit() Option {
+	return func(o *options) {
+		o.inlineCommit = true
+	}
+}
+
+// WithDrainTimeout ограничивает время корректного завершения после ошибки
+// или отмены контекста. Если стадии не успели завершиться, Pipe возвращает
+// ErrDrainTimeout, оставляя зависшие вызовы Process или Commit работать в фоне.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.drainTimeout = timeout
+	}
+}
+
+// WithTracer открывает span на каждый батч: от отправки в обработку до
+// фиксации его cookie, с размером батча и итоговой ошибкой
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithOffsetCommitMode включает фиксацию по смещениям: для источников с
+// монотонными cookie, где Commit(n) подтверждает и все меньшие cookie.
+// Фиксируется только максимальный cookie батча, если он больше уже
+// зафиксированного, а в режиме CommitAtEnd — только максимальный за запуск.
+func WithOffsetCommitMode() Option {
+	return func(o *options) {
+		o.offsetCommit = true
+	}
+}
+
+// WithCommitDrain заставляет стадию Commit при отмене сначала зафиксировать
+// cookie уже обработанных батчей, ожидающие в канале, и только потом
+// завершиться. Если падает сама фиксация, оставшиеся cookie не трогаются.
+func WithCommitDrain() Option {
+	return func(o *options) {
+		o.commitDrain = true
+	}
+}
+
+// WithBufferStrategy выбирает способ накопления элементов между сбросами,
+// по умолчанию SliceAppend
+func WithBufferStrategy(strategy BufferStrategy) Option {
+	return func(o *options) {
+		o.bufferStrategy = strategy
+	}
+}
+
+// WithCommitConcurrency фиксирует cookie параллельно в n воркерах. Порядок
+// вызовов Commit при этом не гарантируется, поэтому опция подходит только
+// для независимых cookie, где фиксация одного не подразумевает другие.
+// Первая ошибка Commit останавливает pipeline. Действует в режиме
+// CommitPerBatch без inline-фиксации и без фиксации по смещениям;
+// n <= 1 — последовательная фиксация. Для источника, реализующего
+// AsyncCommitter, n задаёт число одновременно ожидаемых подтверждений.
+func WithCommitConcurrency(n int) Option {
+	return func(o *options) {
+		o.commitConcurrency = n
+	}
+}
+
+// WithMaxInflightBatches задаёт, сколько готовых батчей может ждать обработки
+// между стадиями Next и Process, по умолчанию 1. Больший запас сглаживает
+// неравномерного потребителя, но каждый ожидающий батч держит в памяти до
+// maxItems элементов: в худшем случае это n*maxItems элементов сверх
+// обрабатываемого батча и буфера runNext.
+func WithMaxInflightBatches(n int) Option {
+	return func(o *options) {
+		o.maxInflightBatches = n
+	}
+}
+
+// WithPerBatchTimeout ограничивает время обработки одного батча.
+// ContextConsumer получает контекст с этим дедлайном; для остальных
+// потребителей Pipe перестаёт ждать Process по истечении времени. В обоих
+// случаях просроченный батч завершает pipeline с ErrProcessFailed,
+// оборачивающей context.DeadlineExceeded.
+func WithPerBatchTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.perBatchTimeout = timeout
+	}
+}
+
+// WithOnBufferStart задаёт хук, вызываемый, когда в пустом буфере runNext
+// появляются первые элементы
+func WithOnBufferStart(hook func()) Option {
+	return func(o *options) {
+		o.onBufferStart = hook
+	}
+}
+
+// WithOnBufferEmpty задаёт хук, вызываемый, когда непустой буфер runNext
+// сбрасывается в батч, в том числе при финальном сбросе на EOF, или
+// отбрасывается при ошибке и отмене. Вместе с
+// WithOnBufferStart хуки чередуются строго по одному на переход.
+func WithOnBufferEmpty(hook func()) Option {
+	return func(o *options) {
+		o.onBufferEmpty = hook
+	}
+}
+
+// WithStartAfterCookie продолжает поток после cookie, зафиксированного в
+// прошлом запуске. Cookie считаются монотонно возрастающими, как в
+// WithOffsetCommitMode. SeekableProducer позиционируется сам через SeekTo,
+// для остальных источников результаты Next с cookie <= cookie отбрасываются
+// без обработки и фиксации.
+func WithStartAfterCookie(cookie int) Option {
+	return func(o *options) {
+		o.startAfter = cookie
+		o.startAfterSet = true
+	}
+}
+
+// WithShutdownPreference задаёт поведение при отмене, по умолчанию FastStop.
+// При FlushFirst накопленный буфер и батчи в пути доводятся до фиксации не
+// дольше timeout с момента отмены (timeout <= 0 — без ограничения); фиксация
+// при этом дорабатывает как с WithCommitDrain. WithDrainTimeout по-прежнему
+// ограничивает общее ожидание стадий.
+func WithShutdownPreference(pref ShutdownPreference, timeout time.Duration) Option {
+	return func(o *options) {
+		o.shutdown = pref
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithGroupKey делит каждый батч по ключу key и передаёт потребителю группы
+// по отдельности: вызов Process на группу или один ProcessGrouped, если
+// потребитель реализует GroupedConsumer. Несравнимый ключ, например срез,
+// завершает обработку батча ошибкой.
+// Cookie батча фиксируются один раз, после обработки всех его групп.
+func WithGroupKey(key func(item any) any) Option {
+	return func(o *options) {
+		o.groupKey = key
+	}
+}
+
+// WithStallTimeout включает детектор зависаний: если дольше timeout не
+// завершился ни один вызов Next, Process или Commit, onStall получает
+// название стадии, чей вызов висит дольше всех (StageNext, StageProcess,
+// StageCommit или StagePipeline). Об одном зависании onStall узнаёт один раз.
+// Пауза через Controller зависанием не считается.
+func WithStallTimeout(timeout time.Duration, onStall func(stage string)) Option {
+	return func(o *options) {
+		o.stallTimeout = timeout
+		o.onStall = onStall
+	}
+}
+
+// WithAbortOnStall останавливает pipeline при первом зависании, обнаруженном
+// WithStallTimeout: Pipe возвращает ErrStalled с названием стадии. Зависший
+// вызов без контекста прервать нельзя, поэтому вместе с ней обычно задают
+// WithDrainTimeout.
+func WithAbortOnStall() Option {
+	return func(o *options) {
+		o.abortOnStall = true
+	}
+}
+
+// WithCommitLog записывает намерения фиксации в log до вызова Commit и при
+// старте дофиксирует то, что не успел прошлый запуск
+func WithCommitLog(log CommitLog) Option {
+	return func(o *options) {
+		o.commitLog = log
+	}
+}
+
+// WithCommitDebounce копит cookie в стадии Commit и фиксирует их пачкой не
+// чаще раза в window: окно отсчитывается от первого cookie пачки, остаток
+// фиксируется при закрытии канала cookie. Источник, реализующий
+// BatchCommitter, получает пачку одним CommitBatch, иначе Commit вызывается
+// для каждого cookie; в режиме смещений фиксируется только максимальный.
+// Опция сокращает число вызовов фиксации ценой её задержки; не действует
+// вместе с CommitAtEnd и inline-фиксацией и заменяет WithCommitConcurrency.
+func WithCommitDebounce(window time.Duration) Option {
+	return func(o *options) {
+		o.commitDebounce = window
+	}
+}
+
+// WithOnOversizedNext задаёт диагностический хук, вызываемый, когда один
+// результат Next содержит больше maxItems элементов. Такой результат всё
+// равно уходит в обработку целиком; хук помогает заметить, что источник
+// регулярно отдаёт слишком крупные куски и maxItems стоит пересмотреть.
+func WithOnOversizedNext(hook func(itemCount, maxItems int)) Option {
+	return func(o *options) {
+		o.onOversizedNext = hook
+	}
+}
+
+// WithBatchOrder задаёт порядок обработки готовых батчей, по умолчанию FIFO.
+// При LIFO глубину очереди, в которой батчи переупорядочиваются, задаёт
+// WithMaxInflightBatches.
+func WithBatchOrder(order BatchOrder) Option {
+	return func(o *options) {
+		o.batchOrder = order
+	}
+}
+
+// WithEagerFlushWhenIdle включает досрочный сброс буфера: когда стадия
+// обработки простаивает в ожидании батча, runNext отдаёт ей частично
+// заполненный буфер сразу после очередного Next, не дожидаясь переполнения.
+// Это сокращает задержку хвоста потока ценой более мелких батчей.
+func WithEagerFlushWhenIdle() Option {
+	return func(o *options) {
+		o.eagerFlushWhenIdle = true
+	}
+}
+
+// WithEndOnEmptyRun завершает поток, как при ErrEofCommitCookie, после n
+// подряд идущих результатов Next без элементов и без ошибки — для
+// источников, которые сообщают о конце данных пустыми ответами, а не
+// ошибкой. Cookie n-го пустого результата не фиксируется, предыдущих —
+// фиксируются как обычно. n <= 0 (по умолчанию) отключает проверку.
+func WithEndOnEmptyRun(n int) Option {
+	return func(o *options) {
+		o.endOnEmptyRun = n
+	}
+}
+
+// WithCommitOnFlush откладывает фиксацию до сброса буфера потребителя,
+// реализующего FlushableConsumer: cookie обработанных батчей придерживаются,
+// пока не выполнится успешный Flush. Flush вызывается в конце потока и,
+// если interval > 0, не чаще раза в interval — проверка срока выполняется
+// после обработки очередного батча. Ошибка Flush останавливает pipeline с
+// ErrProcessFailed, а придержанные cookie так и не фиксируются. Для
+// потребителя без Flush опция не действует; middleware из Chain скрывает
+// Flush обёрнутого потребителя.
+func WithCommitOnFlush(interval time.Duration) Option {
+	return func(o *options) {
+		o.commitOnFlush = true
+		o.commitFlushInterval = interval
+	}
+}
+
+// WithDryRun включает пробный запуск: источник читается и потребитель
+// обрабатывает данные как обычно, но Commit источника (как и CommitBatch,
+// CommitAsync и журнал WithCommitLog) не вызывается. Cookie, которые были
+// бы зафиксированы, считаются зафиксированными в статистике: её
+// CommittedCookies показывают, что зафиксировал бы настоящий запуск.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithOnFilteredCookies передаёт handler cookie батчей, которые transform из
+// WithTransform отфильтровал целиком, — например чтобы отметить их смещения
+// как пропущенные, а не обработанные. При commit == true cookie после
+// handler фиксируются как обычно, при false — только передаются handler и
+// не фиксируются. Батч, из которого осталась хотя бы часть элементов,
+// считается обработанным: cookie относятся к батчу, а не к элементам.
+// В режиме смещений более поздняя фиксация всё равно подтвердит и
+// незафиксированные cookie отфильтрованных батчей.
+func WithOnFilteredCookies(handler func(cookies []int), commit bool) Option {
+	return func(o *options) {
+		o.onFilteredCookies = handler
+		o.commitFiltered = commit
+	}
+}
+
+// WithOnStatsTick вызывает hook со снимком статистики раз в interval по
+// часам WithClock, пока pipeline работает, — например чтобы показывать
+// прогресс долгого запуска на дашборде. Снимок согласован: все поля взяты
+// под одной блокировкой. Хук вызывается из отдельной горутины и не должен
+// надолго блокироваться; после возврата из Pipe он больше не вызывается.
+func WithOnStatsTick(interval time.Duration, hook func(PipeStats)) Option {
+	return func(o *options) {
+		o.statsTickInterval = interval
+		o.onStatsTick = hook
+	}
+}
+
+// WithOrderedCommit фиксирует cookie строго по возрастанию без пропусков,
+// даже если они приходят из стадии обработки не по порядку — например, когда
+// источник читает данные параллельно. Cookie считаются последовательными
+// номерами, начиная с first: пришедший раньше времени cookie ждёт в буфере,
+// пока не придут все меньшие, после чего непрерывная серия фиксируется
+// целиком. Cookie меньше ожидаемого фиксируется сразу.
+//
+// Если ожидаемый cookie так и не пришёл за timeout по часам WithClock, в
+// буфере оказалось больше bufferSize cookie или поток закончился, pipeline
+// останавливается с ErrReorderGap, а удержанные cookie не фиксируются.
+// bufferSize <= 0 снимает ограничение буфера, timeout <= 0 — ограничение
+// времени. Пропуски вызывают и батчи, чьи cookie не фиксируются намеренно:
+// отфильтрованные без фиксации и пропущенные через SkipCurrentBatch.
+//
+// Режим заменяет WithCommitDebounce, WithCommitConcurrency и асинхронную
+// фиксацию AsyncCommitter; режим CommitAtEnd имеет приоритет над ним.
+func WithOrderedCommit(first, bufferSize int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.orderedCommit = true
+		o.orderedFirst = first
+		o.orderedBufferSize = bufferSize
+		o.orderedTimeout = timeout
+	}
+}
+
+// WithHeadroomItems резервирует в срезе, который получает Process, не
+// меньше n элементов свободной ёмкости. Потребитель может дописать в батч
+// служебные элементы через append или сдвинуть элементы и вставить их в
+// начало, не выделяя новый массив. Буферы runNext сразу выделяются с
+// запасом, поэтому обычно копирования нет; батч, которому запаса не хватило
+// (например, после WithTransform или деления при ErrBatchTooLarge),
+// копируется в срез нужной ёмкости.
+func WithHeadroomItems(n int) Option {
+	return func(o *options) {
+		o.headroomItems = n
+	}
+}
+
+// WithStrictProducer проверяет каждый результат Next на соблюдение контракта
+// Producer и останавливает pipeline с ErrProtocol при нарушении: если
+// источник вернул элементы вместе с ошибкой, отличной от конца данных, или
+// больше maxItems элементов за раз. Без этого режима элементы при ошибке
+// молча отбрасываются, а слишком большой результат уходит в батч целиком.
+// Режим удобен в тестах и при подключении нового источника.
+func WithStrictProducer() Option {
+	return func(o *options) {
+		o.strictProducer = true
+	}
+}
+
+// WithTimeBudget ограничивает время чтения источника: через budget по часам
+// WithClock pipeline перестаёт вызывать Next и завершается так же, как при
+// конце данных, — накопленный буфер сбрасывается, а все прочитанные батчи
+// обрабатываются и фиксируются. Вызов Next, начатый до истечения бюджета,
+// дожидается. Если fail задан, Pipe в этом случае возвращает
+// ErrTimeBudgetExceeded, иначе nil. Отмена внешнего контекста бюджетом не
+// считается и обрабатывается как обычно.
+func WithTimeBudget(budget time.Duration, fail bool) Option {
+	return func(o *options) {
+		o.timeBudget = budget
+		o.timeBudgetErr = fail
+	}
+}
+
+// WithBatchKey задаёт вычисление ключа идемпотентности батча по его cookie,
+// который потребитель получает через BatchKeyFromContext. Функция должна
+// быть детерминированной, чтобы повторная обработка тех же данных давала тот
+// же ключ. По умолчанию используется DefaultBatchKey. Для частей
+// разделённого батча к ключу добавляется путь части.
+func WithBatchKey(key func(cookies []int) string) Option {
+	return func(o *options) {
+		o.batchKey = key
+	}
+}
+
+// WithAtLeastOnce гарантирует, что к возврату из Pipe с ошибкой все
+// успешно обработанные батчи зафиксированы, и перезапуск продолжит ровно с
+// первого необработанного, ничего не обрабатывая повторно без нужды. После
+// ошибки Process стадия обработки отдаёт ошибку только когда стадия Commit
+// зафиксировала cookie предыдущих батчей; при отмене действует как
+// WithCommitDrain; в режиме CommitAtEnd при ошибке фиксируются cookie
+// обработанных батчей, а не отбрасываются все. Cookie, которые ждут Flush
+// при WithCommitOnFlush, по-прежнему не фиксируются: их данные не сохранены.
+func WithAtLeastOnce() Option {
+	return func(o *options) {
+		o.atLeastOnce = true
+	}
+}
+
+// WithStrictMaxItems останавливает pipeline ошибкой ErrBatchTooLarge вместе
+// с ErrNextFailed, если Next вернул больше maxItems элементов. Без него такой
+// результат уходит в Process отдельным батчем целиком, а при ошибке
+// ErrBatchTooLarge потребителя делится; строгий режим позволяет сразу
+// заметить, что maxItems меньше порции источника. WithStrictProducer
+// включает эту проверку вместе с остальными.
+func WithStrictMaxItems() Option {
+	return func(o *options) {
+		o.strictMaxItems = true
+	}
+}
+
+// WithNoCommitCookie объявляет cookie, который не нужно фиксировать:
+// элементы результатов Next с таким cookie обрабатываются как обычно, но
+// Commit для него не вызывается и в статистике он не учитывается. Обычно
+// это NoCommitCookie. Без опции любое значение cookie фиксируется.
+func WithNoCommitCookie(cookie int) Option {
+	return func(o *options) {
+		o.noCommit = cookie
+		o.noCommitSet = true
+	}
+}
+
+// WithPartialFlushAfter сбрасывает неполный буфер, когда самый старый
+// элемент в нём ждёт по часам WithClock не меньше age. В отличие от
+// WithFlushInterval, отсчёт идёт от поступления первого элемента в пустой
+// буфер, а не по периодическому таймеру, поэтому только что пришедший
+// элемент не уходит отдельным батчем на очередном тике. Как и у
+// WithFlushInterval, возраст проверяется после каждого Next.
+func WithPartialFlushAfter(age time.Duration) Option {
+	return func(o *options) {
+		o.partialFlushAfter = age
+	}
+}
+
+// WithStageRetry повторяет вызовы Next, Process и Commit (в том числе
+// CommitBatch), вернувшие ошибку, помеченную повторяемой через
+// RetryableError, — всего не больше attempts попыток с паузами backoff.
+// Остальные ошибки, как и исчерпание попыток, останавливают pipeline как
+// обычно. Если backoff.Clock не задан, паузы идут по часам WithClock.
+// Фиксация через AsyncCommitter повторяется отправкой cookie заново.
+func WithStageRetry(attempts int, backoff Backoff) Option {
+	return func(o *options) {
+		o.stageRetry = stageRetry{attempts: attempts, backoff: backoff}
+	}
+}
+
+// WithSeed делает случайные решения pipeline воспроизводимыми: вся
+// случайность запуска, например разброс пауз WithStageRetry, берётся из
+// общего генератора с этим seed, а не из глобального источника math/rand.
+// Это нужно в тестах и при разборе инцидентов. Генератор, явно заданный в
+// Backoff.Rand, имеет приоритет. Если повторы идут в нескольких стадиях
+// одновременно, порядок, в котором они берут числа, зависит от
+// планировщика.
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = seed
+		o.seedSet = true
+	}
+}
+
+// WithMaxUncommitted ограничивает число cookie, которые обработаны или
+// обрабатываются, но ещё не зафиксированы: когда стадия Commit отстаёт на n
+// cookie, стадия Process не начинает следующий батч, пока фиксация не
+// догонит её. Батч, в котором cookie больше n, обрабатывается, только когда
+// незафиксированных cookie нет. Так
+// ограничивается объём, повторяемый после сбоя. Не действует при
+// CommitAtEnd и синхронной фиксации в стадии обработки. Вместе с
+// WithOrderedCommit n должен покрывать возможный разрыв в порядке cookie,
+// иначе стадии будут ждать друг друга до таймаута пропуска.
+func WithMaxUncommitted(n int) Option {
+	return func(o *options) {
+		o.maxUncommitted = n
+	}
+}
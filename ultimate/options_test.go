@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_CoalesceDedupes(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 10
+
+	producer.On("Next").Return([]any{"a", "b"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"b", "c"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"a", "c"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Process получает батч без дубликатов
+	consumer.On("Process", []any{"a", "b", "c"}).Return(nil).Once()
+
+	// Все cookie источника фиксируются
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+	producer.On("Commit", 3).Return(nil).Once()
+
+	dedupe := func(buf []any, incoming []any) []any {
+		for _, item := range incoming {
+			seen := false
+			for _, b := range buf {
+				if b.(string) == item.(string) {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				buf = append(buf, item)
+			}
+		}
+		return buf
+	}
+
+	err := Pipe(producer, consumer, maxItems, WithCoalesce(dedupe))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_TransformFiltersOdd(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 4
+
+	producer.On("Next").Return([]any{1, 2}, 1, nil).Once()
+	producer.On("Next").Return([]any{3, 4}, 2, nil).Once()
+	producer.On("Next").Return([]any{5}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Потребитель видит только чётные, батч из одних нечётных не доходит до Process
+	consumer.On("Process", []any{2, 4}).Return(nil).Once()
+
+	// Фиксируются все cookie источника
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+	producer.On("Commit", 3).Return(nil).Once()
+
+	evens := func(items []any) ([]any, error) {
+		var out []any
+		for _, item := range items {
+			if item.(int)%2 == 0 {
+				out = append(out, item)
+			}
+		}
+		return out, nil
+	}
+
+	err := Pipe(producer, consumer, maxItems, WithTransform(evens))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_TransformError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 4
+
+	producer.On("Next").Return([]any{1}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	transformErr := errors.New("bad item")
+	err := Pipe(producer, consumer, maxItems, WithTransform(func([]any) ([]any, error) {
+		return nil, transformErr
+	}))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorContains(t, err, transformErr.Error())
+
+	consumer.AssertNotCalled(t, "Process", mock.Anything)
+	producer.AssertNotCalled(t, "Commit", mock.Anything)
+}
+
+func TestPipe_BoundaryFlushesOnSentinel(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 10
+
+	producer.On("Next").Return([]any{"a1", "a2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"END"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"b1"}, 3, nil).Once()
+	producer.On("Next").Return([]any{"b2", "END"}, 4, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	// Каждая транзакция, закрытая маркером END, уходит отдельным батчем
+	consumer.On("Process", []any{"a1", "a2", "END"}).Return(nil).Once()
+	consumer.On("Process", []any{"b1", "b2", "END"}).Return(nil).Once()
+	for cookie := 1; cookie <= 4; cookie++ {
+		producer.On("Commit", cookie).Return(nil).Once()
+	}
+
+	afterEnd := func(buf []any, _ []any) bool {
+		return buf[len(buf)-1] == "END"
+	}
+
+	err := Pipe(producer, consumer, maxItems, WithBoundary(afterEnd))
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+// reusingProducer отдаёт элементы в одном и том же срезе, перезаписывая его
+type reusingProducer struct {
+	buf []any
+	n   int
+}
+
+func (p *reusingProducer) Next() ([]any, int, error) {
+	if p.n == 3 {
+		return nil, 0, ErrEofCommitCookie
+	}
+	p.n++
+	p.buf[0] = p.n
+	return p.buf, p.n, nil
+}
+
+func (p *reusingProducer) Commit(int) error { return nil }
+
+// retainingConsumer сохраняет полученные срезы без копирования
+type retainingConsumer struct {
+	retained [][]any
+}
+
+func (c *retainingConsumer) Process(items []any) error {
+	c.retained = append(c.retained, items)
+	return nil
+}
+
+// takeIncoming — слияние, которое в пустой буфер кладёт срез источника как есть
+func takeIncoming(buf, incoming []any) []any {
+	if len(buf) == 0 {
+		return incoming
+	}
+	return append(buf, incoming...)
+}
+
+func TestPipe_CopyBatchProtectsRetainedSlices(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		maxItems int
+		opts     []Option
+		want     [][]any
+	}{
+		// Без копии все сохранённые батчи указывают на перезаписанный срез
+		{"unbuffered", 0, nil, [][]any{{3}, {3}, {3}}},
+		{"unbuffered copy", 0, []Option{WithCopyBatch()}, [][]any{{1}, {2}, {3}}},
+		// буфер сам копирует элементы источника, а каждый сброс отдаёт новый срез
+		{"buffered", 1, nil, [][]any{{1}, {2}, {3}}},
+		// слияние может оставить в буфере срез источника
+		{"buffered coalesce", 1, []Option{WithCoalesce(takeIncoming)}, [][]any{{3}, {3}, {3}}},
+		{"buffered coalesce copy", 1, []Option{WithCoalesce(takeIncoming), WithCopyBatch()}, [][]any{{1}, {2}, {3}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			consumer := &retainingConsumer{}
+			err := Pipe(&reusingProducer{buf: make([]any, 1)}, consumer, tc.maxItems, tc.opts...)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, consumer.retained)
+		})
+	}
+}
+
+func TestPipe_BufferTransitionHooks(t *testing.T) {
+	// Пустой результат Next не начинает накопление
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5}, 1, 0, 1, 1, 1, 1)
+	sink := &pipetest.MemorySink{}
+
+	var events []string
+	err := Pipe(source, sink, 2,
+		WithOnBufferStart(func() { events = append(events, "start") }),
+		WithOnBufferEmpty(func() { events = append(events, "empty") }),
+	)
+	require.NoError(t, err)
+	require.Equal(t, [][]any{{1, 2}, {3, 4}, {5}}, sink.Batches())
+	// последний переход — финальный сброс на EOF
+	require.Equal(t, []string{"start", "empty", "start", "empty", "start", "empty"}, events)
+}
+
+func TestPipe_OnOversizedNext(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 10), 2, 5, 3)
+	consumer := &pipetest.RecordingConsumer{}
+
+	type oversized struct{ items, maxItems int }
+	var got []oversized
+	err := Pipe(producer, consumer, 3, WithOnOversizedNext(func(items, maxItems int) {
+		got = append(got, oversized{items, maxItems})
+	}))
+	require.NoError(t, err)
+	// Результат из 3 элементов в лимит укладывается, из 5 — нет
+	require.Equal(t, []oversized{{5, 3}}, got)
+	require.Len(t, consumer.Items(), 10)
+}
+
+// emptyRunSteps — три пустых результата, данные, затем длинная серия пустых
+// и ещё данные, до которых дело дойти не должно
+func emptyRunSteps() []pipetest.Step {
+	steps := []pipetest.Step{{Cookie: 1}, {Cookie: 2}, {Cookie: 3}, {Items: []any{"a", "b"}, Cookie: 4}}
+	for cookie := 5; cookie <= 14; cookie++ {
+		steps = append(steps, pipetest.Step{Cookie: cookie})
+	}
+	return append(steps, pipetest.Step{Items: []any{"late"}, Cookie: 15})
+}
+
+func TestPipe_EndOnEmptyRun(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie, emptyRunSteps()...)
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 10, WithEndOnEmptyRun(4))
+	require.NoError(t, err)
+	// три пустых результата в начале порог не достигают, а после данных
+	// четвёртый пустой подряд завершает поток
+	require.Equal(t, 8, producer.NextCalls())
+	require.Equal(t, []any{"a", "b"}, consumer.Items())
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7}, producer.Committed())
+}
+
+func TestPipe_EndOnEmptyRunDisabledByDefault(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie, emptyRunSteps()...)
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+	require.Equal(t, []any{"a", "b", "late"}, consumer.Items())
+}
+
+func TestPipe_DryRunSkipsCommit(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{1, 2}, 1, nil).Once()
+	producer.On("Next").Return([]any{3}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{1, 2, 3}).Return(nil).Once()
+
+	stats, err := PipeWithStats(producer, consumer, 5, WithDryRun())
+	require.NoError(t, err)
+	producer.AssertNotCalled(t, "Commit", mock.Anything)
+	consumer.AssertExpectations(t)
+	// статистика показывает, что было бы зафиксировано
+	require.Equal(t, []int{1, 2}, stats.CommittedCookies)
+}
+
+func TestPipe_DryRunSkipsAsyncAndBatchCommit(t *testing.T) {
+	async := newAsyncProducer(4, 0)
+	require.NoError(t, Pipe(async, &pipetest.RecordingConsumer{}, 1, WithDryRun()))
+	require.Empty(t, async.acked)
+	require.Empty(t, async.Committed())
+
+	batched := &feedProducer{feed: make(chan int, 3)}
+	batched.feed <- 1
+	batched.feed <- 2
+	batched.feed <- 3
+	close(batched.feed)
+	require.NoError(t, Pipe(batched, &pipetest.RecordingConsumer{}, 1, WithDryRun(), WithCommitDebounce(time.Hour)))
+	require.Empty(t, batched.committedBatches())
+}
+
+// dropOdd оставляет в батче только чётные числа
+func dropOdd(items []any) ([]any, error) {
+	var out []any
+	for _, item := range items {
+		if item.(int)%2 == 0 {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+func TestPipe_OnFilteredCookiesCommit(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1, 3}, Cookie: 1},
+		pipetest.Step{Items: []any{2, 5}, Cookie: 2},
+		pipetest.Step{Items: []any{7}, Cookie: 3},
+	)
+	consumer := &pipetest.RecordingConsumer{}
+
+	var filtered [][]int
+	err := Pipe(producer, consumer, 2, WithTransform(dropOdd),
+		WithOnFilteredCookies(func(cookies []int) { filtered = append(filtered, cookies) }, true))
+	require.NoError(t, err)
+	require.Equal(t, []any{2}, consumer.Items())
+	require.Equal(t, [][]int{{1}, {3}}, filtered)
+	require.Equal(t, []int{1, 2, 3}, producer.Committed())
+}
+
+func TestPipe_OnFilteredCookiesCallbackOnly(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1, 3}, Cookie: 1},
+		pipetest.Step{Items: []any{2, 5}, Cookie: 2},
+		pipetest.Step{Items: []any{7}, Cookie: 3},
+	)
+	consumer := &pipetest.RecordingConsumer{}
+
+	var filtered [][]int
+	stats, err := PipeWithStats(producer, consumer, 2, WithTransform(dropOdd),
+		WithOnFilteredCookies(func(cookies []int) { filtered = append(filtered, cookies) }, false))
+	require.NoError(t, err)
+	require.Equal(t, [][]int{{1}, {3}}, filtered)
+	// фиксируется только батч, от которого что-то осталось
+	require.Equal(t, []int{2}, producer.Committed())
+	require.Equal(t, []int{2}, stats.CommittedCookies)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PipeError — ошибка Pipe с машиночитаемыми подробностями для агрегаторов
+// логов. Unwrap возвращает исходную ошибку, поэтому errors.Is работает как
+// прежде; Error() — её текст с именем pipeline, если оно задано.
+type PipeError struct {
+	// Pipeline — имя pipeline из WithName или пустая строка
+	Pipeline string
+	// Stage — стадия первой ошибки: next, process, commit или pipeline,
+	// если причина не относится к конкретной стадии (например, отмена)
+	Stage string
+	// Sentinel — сигнальная ошибка стадии или nil
+	Sentinel error
+	// Message — текст первопричины без префикса стадии
+	Message string
+	// LastCommitted — последний успешно зафиксированный cookie;
+	// имеет смысл, только если HasCommitted
+	LastCommitted int
+	HasCommitted  bool
+
+	err error
+}
+
+func (e *PipeError) Error() string {
+	if e.Pipeline != "" {
+		return fmt.Sprintf("pipeline %q: %v", e.Pipeline, e.err)
+	}
+	return e.err.Error()
+}
+
+func (e *PipeError) Unwrap() error { return e.err }
+
+// pipeErrorJSON — JSON-представление PipeError
+type pipeErrorJSON struct {
+	Pipeline      string `json:"pipeline,omitempty"`
+	Stage         string `json:"stage"`
+	Sentinel      string `json:"sentinel,omitempty"`
+	Message       string `json:"message"`
+	LastCommitted *int   `json:"last_committed_cookie"`
+	Error         string `json:"error"`
+}
+
+func (e *PipeError) MarshalJSON() ([]byte, error) {
+	out := pipeErrorJSON{Pipeline: e.Pipeline, Stage: e.Stage, Message: e.Message, Error: e.Error()}
+	if e.Sentinel != nil {
+		out.Sentinel = e.Sentinel.Error()
+	}
+	if e.HasCommitted {
+		last := e.LastCommitted
+		out.LastCommitted = &last
+	}
+	return json.Marshal(out)
+}
+
+// stageSentinels — сигнальные ошибки стадий в порядке проверки
+var stageSentinels = []struct {
+	stage string
+	err   error
+}{
+	{"next", ErrNextFailed},
+	{"process", ErrProcessFailed},
+	{"commit", ErrCommitFailed},
+}
+
+// newPipeError оборачивает итоговую ошибку Pipe, описывая первую из
+// объединённых ошибок
+func newPipeError(err error, name string, lastCommitted int, hasCommitted bool) error {
+	if err == nil {
+		return nil
+	}
+	pe := &PipeError{
+		Pipeline:      name,
+		Stage:         "pipeline",
+		LastCommitted: lastCommitted,
+		HasCommitted:  hasCommitted,
+		err:           err,
+	}
+	first := firstError(err)
+	pe.Message = first.Error()
+	for _, s := range stageSentinels {
+		if errors.Is(first, s.err) {
+			pe.Stage, pe.Sentinel = s.stage, s.err
+			pe.Message = strings.TrimPrefix(pe.Message, s.err.Error()+": ")
+			break
+		}
+	}
+	return pe
+}
+
+// firstError спускается по errors.Join к первой ошибке. Ошибка стадии вида
+// "%w: %w" тоже раскрывается в список, но её первый элемент — сигнальная
+// ошибка, и на ней спуск останавливается.
+func firstError(err error) error {
+	for {
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			return err
+		}
+		errs := joined.Unwrap()
+		if len(errs) == 0 || isStageSentinel(errs[0]) {
+			return err
+		}
+		err = errs[0]
+	}
+}
+
+func isStageSentinel(err error) bool {
+	for _, s := range stageSentinels {
+		if err == s.err {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_PipeErrorJSON(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	committed := make(chan struct{})
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) { close(committed) })
+	consumer.On("Process", []any{"item2"}).Return(errors.New("payload rejected")).Once().
+		Run(func(mock.Arguments) { <-committed })
+
+	err := Pipe(producer, consumer, 1)
+	require.ErrorIs(t, err, ErrProcessFailed)
+
+	var pe *PipeError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "process", pe.Stage)
+
+	data, jerr := json.Marshal(err)
+	require.NoError(t, jerr)
+	require.JSONEq(t, `{
+		"stage": "process",
+		"sentinel": "process failed",
+		"message": "payload rejected",
+		"last_committed_cookie": 1,
+		"error": "process failed: payload rejected"
+	}`, string(data))
+}
+
+func TestPipe_PipeErrorNothingCommitted(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{}, 0, errors.New("source down")).Once()
+
+	err := Pipe(producer, consumer, 1)
+	require.ErrorIs(t, err, ErrNextFailed)
+
+	data, jerr := json.Marshal(err)
+	require.NoError(t, jerr)
+	require.JSONEq(t, `{
+		"stage": "next",
+		"sentinel": "next failed",
+		"message": "source down",
+		"last_committed_cookie": null,
+		"error": "next failed: source down"
+	}`, string(data))
+}
+
+func TestPipe_PipeErrorName(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+	consumer.On("Process", []any{"item1"}).Return(errors.New("payload rejected")).Once()
+
+	err := Pipe(producer, consumer, 1, WithName("partition-3"))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.EqualError(t, err, `pipeline "partition-3": process failed: payload rejected`)
+
+	var pe *PipeError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "partition-3", pe.Pipeline)
+
+	data, jerr := json.Marshal(err)
+	require.NoError(t, jerr)
+	require.JSONEq(t, `{
+		"pipeline": "partition-3",
+		"stage": "process",
+		"sentinel": "process failed",
+		"message": "payload rejected",
+		"last_committed_cookie": null,
+		"error": "pipeline \"partition-3\": process failed: payload rejected"
+	}`, string(data))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newCountingPipeline собирает pipeline из двух стадий, передающих n чисел.
+// prepare создаёт канал между стадиями и вызывается перед каждым запуском.
+func newCountingPipeline(n int, sum *int, failAt int) (pl *Pipeline, prepare func()) {
+	var ch chan int
+	pl = NewPipeline()
+	pl.AddStage(func(cancelCh <-chan struct{}) error {
+		defer close(ch)
+		for i := 1; i <= n; i++ {
+			if ok := writeChanWithCancel(cancelCh, ch, i); !ok {
+				return nil
+			}
+		}
+		return nil
+	})
+	pl.AddStage(func(cancelCh <-chan struct{}) error {
+		for {
+			v, ok := readChanWithCancel(cancelCh, ch)
+			if !ok {
+				return nil
+			}
+			if v == failAt {
+				return errors.New("stage failed")
+			}
+			*sum += v
+		}
+	})
+	return pl, func() { ch = make(chan int) }
+}
+
+func TestPipeline_ResetAllowsRerun(t *testing.T) {
+	sum := 0
+	pl, prepare := newCountingPipeline(3, &sum, 0)
+
+	prepare()
+	require.NoError(t, pl.Run())
+	require.Equal(t, 6, sum)
+
+	// без Reset повторный запуск запрещён
+	require.ErrorIs(t, pl.Run(), ErrPipelineUsed)
+
+	require.NoError(t, pl.Reset())
+	prepare()
+	require.NoError(t, pl.Run())
+	require.Equal(t, 12, sum)
+}
+
+func TestPipeline_ResetAfterFailure(t *testing.T) {
+	sum := 0
+	failAt := 2
+	pl, prepare := newCountingPipeline(3, &sum, failAt)
+
+	// после ошибки каналы отмены закрыты каскадом
+	prepare()
+	require.Error(t, pl.Run())
+
+	require.NoError(t, pl.Reset())
+	prepare()
+	require.Error(t, pl.Run())
+	require.Equal(t, 2, sum)
+}
+
+func TestPipeline_ResetWaitsForStagesLeftAfterDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var run atomic.Int32
+	pl := NewPipeline()
+	pl.SetDrainTimeout(10 * time.Millisecond)
+	pl.AddStage(func(cancelCh <-chan struct{}) error {
+		if run.Load() == 0 {
+			// в первом запуске стадия не реагирует на отмену и падает позже
+			<-release
+			return errors.New("late failure")
+		}
+		select {
+		case <-cancelCh:
+			return errors.New("cancelled by previous run")
+		case <-time.After(20 * time.Millisecond):
+			return nil
+		}
+	})
+	pl.AddStage(func(cancelCh <-chan struct{}) error {
+		if run.Load() == 0 {
+			return errors.New("stage failed")
+		}
+		return nil
+	})
+
+	require.ErrorIs(t, pl.Run(), ErrDrainTimeout)
+	// зависшая стадия ещё работает
+	require.ErrorIs(t, pl.Reset(), ErrPipelineUsed)
+
+	close(release)
+	require.Eventually(t, func() bool { return pl.Reset() == nil }, time.Second, time.Millisecond)
+	run.Add(1)
+	require.NoError(t, pl.Run())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_WithPipetestHarness(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxItems int
+		steps    []pipetest.Step
+		batches  [][]any
+	}{
+		{
+			name:     "single batch",
+			maxItems: 10,
+			steps:    []pipetest.Step{{Items: []any{1, 2}, Cookie: 1}, {Items: []any{3}, Cookie: 2}},
+			batches:  [][]any{{1, 2, 3}},
+		},
+		{
+			name:     "overflow",
+			maxItems: 2,
+			steps:    []pipetest.Step{{Items: []any{1, 2}, Cookie: 1}, {Items: []any{3}, Cookie: 2}},
+			batches:  [][]any{{1, 2}, {3}},
+		},
+		{
+			name:     "empty",
+			maxItems: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := pipetest.NewScriptedProducer(ErrEofCommitCookie, tt.steps...)
+			consumer := &pipetest.RecordingConsumer{}
+
+			err := Pipe(producer, consumer, tt.maxItems)
+			require.NoError(t, err)
+			require.Equal(t, tt.batches, consumer.Batches())
+
+			var cookies []int
+			for _, step := range tt.steps {
+				cookies = append(cookies, step.Cookie)
+			}
+			require.Equal(t, cookies, producer.Committed())
+		})
+	}
+}
+
+func BenchmarkPipeThroughput(b *testing.B) {
+	const items = 100000
+	for _, maxItems := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("maxItems=%d", maxItems), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				producer := pipetest.NewCountingProducer(ErrEofCommitCookie, items, 10)
+				if err := Pipe(producer, pipetest.NullConsumer{}, maxItems); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(items*b.N)/b.Elapsed().Seconds(), "items/s")
+		})
+	}
+}
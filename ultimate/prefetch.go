@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// PrefetchProducer вызывает Next источника заранее в фоновой горутине, чтобы
+// задержка источника перекрывалась с работой pipeline. Глубина упреждения
+// подстраивается под скорость потребления: если к очередному Next готовые
+// результаты всё ещё лежат в окне целиком, pipeline не успевает их забирать
+// (обычно потому, что отстают стадии обработки и фиксации), и окно
+// уменьшается вдвое, вплоть до одного результата. Если Next пришлось ждать
+// источник, окно растёт на единицу до depth. Так под медленным потребителем
+// в памяти не копится больше результатов, чем он успевает разобрать.
+type PrefetchProducer struct {
+	ctx      context.Context
+	p        Producer
+	depth    int
+	pressure func() bool
+
+	start sync.Once
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []prefetched
+	// window — текущий допустимый размер queue
+	window int
+	// peak — наибольший размер queue за всё время
+	peak int
+	// final — последний результат источника: ошибка или EOF
+	final *prefetched
+}
+
+// prefetched — заранее полученный результат Next
+type prefetched struct {
+	items  []any
+	cookie int
+	err    error
+}
+
+// NewPrefetchProducer создаёт источник с упреждающим чтением p не более чем
+// на depth результатов. pressure, если задан, — внешний сигнал
+// backpressure: пока он возвращает true, окно уменьшается так же, как при
+// переполнении. Фоновая горутина запускается первым вызовом Next и
+// завершается после ошибки или EOF источника либо при отмене ctx.
+func NewPrefetchProducer(ctx context.Context, p Producer, depth int, pressure func() bool) *PrefetchProducer {
+	depth = max(depth, 1)
+	pf := &PrefetchProducer{ctx: ctx, p: p, depth: depth, pressure: pressure, window: depth}
+	pf.cond = sync.NewCond(&pf.mu)
+	return pf
+}
+
+// Next возвращает очередной заранее полученный результат источника. После
+// ошибки или EOF источника каждый следующий вызов возвращает их снова.
+func (pf *PrefetchProducer) Next() ([]any, int, error) {
+	pf.start.Do(func() {
+		context.AfterFunc(pf.ctx, func() {
+			pf.mu.Lock()
+			defer pf.mu.Unlock()
+			pf.cond.Broadcast()
+		})
+		go pf.fetch()
+	})
+
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pf.adapt()
+	for len(pf.queue) == 0 {
+		if pf.final != nil {
+			return nil, 0, pf.final.err
+		}
+		if err := pf.ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		pf.cond.Wait()
+	}
+	r := pf.queue[0]
+	pf.queue = pf.queue[1:]
+	pf.cond.Broadcast()
+	return r.items, r.cookie, r.err
+}
+
+// Commit фиксирует cookie в исходном источнике
+func (pf *PrefetchProducer) Commit(cookie int) error {
+	return pf.p.Commit(cookie)
+}
+
+// Window возвращает текущую глубину упреждения
+func (pf *PrefetchProducer) Window() int {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.window
+}
+
+// Peak возвращает наибольшее число результатов, одновременно ждавших Next
+func (pf *PrefetchProducer) Peak() int {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.peak
+}
+
+// adapt пересчитывает окно по заполненности очереди в момент вызова Next
+func (pf *PrefetchProducer) adapt() {
+	switch {
+	case len(pf.queue) >= pf.window || (pf.pressure != nil && pf.pressure()):
+		pf.window = max(pf.window/2, 1)
+	case len(pf.queue) == 0:
+		pf.window = min(pf.window+1, pf.depth)
+	}
+}
+
+// fetch читает источник, пока в окне есть место
+func (pf *PrefetchProducer) fetch() {
+	for {
+		pf.mu.Lock()
+		for len(pf.queue) >= pf.window && pf.ctx.Err() == nil {
+			pf.cond.Wait()
+		}
+		pf.mu.Unlock()
+		if pf.ctx.Err() != nil {
+			return
+		}
+
+		items, cookie, err := pf.p.Next()
+
+		pf.mu.Lock()
+		r := prefetched{items: items, cookie: cookie, err: err}
+		pf.queue = append(pf.queue, r)
+		pf.peak = max(pf.peak, len(pf.queue))
+		if err != nil {
+			pf.final = &r
+		}
+		pf.cond.Broadcast()
+		pf.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
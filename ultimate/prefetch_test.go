@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchProducer_RoundTrip(t *testing.T) {
+	source := pipetest.NewRandomMemorySource(ErrEofCommitCookie, rand.New(rand.NewSource(3)), 200, 5)
+	sink := &pipetest.MemorySink{}
+
+	err := Pipe(NewPrefetchProducer(context.Background(), source, 4, nil), sink, 7)
+	require.NoError(t, err)
+	pipetest.AssertRoundTrip(t, source, sink, 7)
+}
+
+func TestPrefetchProducer_ShrinksUnderSlowConsumer(t *testing.T) {
+	source := pipetest.NewCountingProducer(ErrEofCommitCookie, 30, 1)
+	pf := NewPrefetchProducer(context.Background(), source, 8, nil)
+	// наибольшая очередь после того, как окно схлопнулось и старый запас
+	// разобран
+	collapsed, late := false, 0
+	slow := &pipetest.MemorySink{}
+	slow.Fail = func([]any) error {
+		pf.mu.Lock()
+		if pf.window == 1 && len(pf.queue) <= 1 {
+			collapsed = true
+		}
+		if collapsed {
+			late = max(late, len(pf.queue))
+		}
+		pf.mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	}
+
+	require.NoError(t, Pipe(pf, slow, 1))
+
+	require.True(t, collapsed)
+	// окно может вырасти на единицу, если Next опередил источник, но не
+	// возвращается к исходной глубине 8
+	require.LessOrEqual(t, late, 2)
+	require.Equal(t, 1, pf.Window())
+	require.Len(t, slow.Items(), 30)
+}
+
+func TestPrefetchProducer_NextAfterEOF(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1}, 1)
+	pf := NewPrefetchProducer(context.Background(), source, 4, nil)
+
+	items, _, err := pf.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{1}, items)
+	for i := 0; i < 2; i++ {
+		_, _, err = pf.Next()
+		require.ErrorIs(t, err, ErrEofCommitCookie)
+	}
+}
+
+func TestPrefetchProducer_PressureSignal(t *testing.T) {
+	source := pipetest.NewCountingProducer(ErrEofCommitCookie, 10, 1)
+	pf := NewPrefetchProducer(context.Background(), source, 8, func() bool { return true })
+
+	for i := 0; i < 3; i++ {
+		_, _, err := pf.Next()
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, pf.Window())
+}
+
+func TestPrefetchProducer_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gate := &slowProducer{gate: make(chan struct{})}
+	pf := NewPrefetchProducer(ctx, gate, 2, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := pf.Next()
+		done <- err
+	}()
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	close(gate.gate)
+}
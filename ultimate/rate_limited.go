@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// RateUnit определяет, что ограничивает RateLimitedProducer
+type RateUnit int
+
+const (
+	// PerCall — один токен на вызов Next
+	PerCall RateUnit = iota
+	// PerItem — один токен на каждый элемент, возвращённый Next
+	PerItem
+)
+
+// RateLimitedProducer ограничивает частоту обращений к источнику токен-бакетом
+type RateLimitedProducer struct {
+	ctx     context.Context
+	p       Producer
+	limiter *rate.Limiter
+	unit    RateUnit
+	clock   Clock
+}
+
+// NewRateLimitedProducer оборачивает p. В режиме PerCall Next ждёт токен до
+// вызова источника, в режиме PerItem — после, по токену на элемент. Отмена
+// ctx прерывает ожидание: Next возвращает ошибку ctx. Токены выдаются и
+// ожидаются по clock; clock == nil означает реальное время.
+func NewRateLimitedProducer(ctx context.Context, p Producer, limiter *rate.Limiter, unit RateUnit, clock Clock) *RateLimitedProducer {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &RateLimitedProducer{ctx: ctx, p: p, limiter: limiter, unit: unit, clock: clock}
+}
+
+func (r *RateLimitedProducer) Next() ([]any, int, error) {
+	if r.unit == PerCall {
+		if err := r.wait(1); err != nil {
+			return nil, 0, err
+		}
+		return r.p.Next()
+	}
+
+	items, cookie, err := r.p.Next()
+	if err != nil {
+		return items, cookie, err
+	}
+	// wait не принимает больше burst токенов за раз. При нулевом burst
+	// ждём по одному токену: лимитер без ограничения их выдаёт, остальные
+	// сразу возвращают ошибку вместо бесконечного цикла.
+	for rest := len(items); rest > 0; {
+		n := max(min(rest, r.limiter.Burst()), 1)
+		if err := r.wait(n); err != nil {
+			return nil, 0, err
+		}
+		rest -= n
+	}
+	return items, cookie, nil
+}
+
+func (r *RateLimitedProducer) Commit(cookie int) error {
+	return r.p.Commit(cookie)
+}
+
+// wait резервирует n токенов на момент clock.Now и выжидает задержку по
+// clock: Wait лимитера отсчитывал бы её по реальному времени
+func (r *RateLimitedProducer) wait(n int) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	now := r.clock.Now()
+	res := r.limiter.ReserveN(now, n)
+	if !res.OK() {
+		return fmt.Errorf("rate limiter: %d tokens exceed burst %d", n, r.limiter.Burst())
+	}
+	delay := res.DelayFrom(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := r.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-r.ctx.Done():
+		res.CancelAt(r.clock.Now())
+		return r.ctx.Err()
+	}
+}
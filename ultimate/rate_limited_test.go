@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedProducer_PerCall(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6}, 1, 1, 1, 1, 1, 1)
+	// 100 вызовов в секунду без запаса: 6 вызовов занимают не меньше 50ms
+	producer := NewRateLimitedProducer(context.Background(), source, rate.NewLimiter(100, 1), PerCall, nil)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, _, err := producer.Next()
+		require.NoError(t, err)
+	}
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestRateLimitedProducer_PerItem(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, make([]any, 30), 10, 10, 10)
+	// 500 элементов в секунду с запасом 10: первые 10 бесплатно, ещё 20 — 40ms
+	producer := NewRateLimitedProducer(context.Background(), source, rate.NewLimiter(500, 10), PerItem, nil)
+	sink := &pipetest.MemorySink{}
+
+	start := time.Now()
+	err := Pipe(producer, sink, 10)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	pipetest.AssertRoundTrip(t, source, sink, 10)
+}
+
+func TestRateLimitedProducer_ContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	// Один вызов в час: второй Next ждёт токен до отмены контекста
+	producer := NewRateLimitedProducer(ctx, source, rate.NewLimiter(rate.Every(time.Hour), 1), PerCall, nil)
+
+	_, _, err := producer.Next()
+	require.NoError(t, err)
+
+	cancel()
+	_, _, err = producer.Next()
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRateLimitedProducer_ZeroBurst(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 2)
+	// конечная частота без запаса не выдаёт ни одного токена
+	producer := NewRateLimitedProducer(context.Background(), source, rate.NewLimiter(10, 0), PerItem, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := producer.Next()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Next spins on a zero burst")
+	}
+
+	// без ограничения частоты нулевой burst не мешает
+	source = pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 2)
+	producer = NewRateLimitedProducer(context.Background(), source, rate.NewLimiter(rate.Inf, 0), PerItem, nil)
+	items, _, err := producer.Next()
+	require.NoError(t, err)
+	require.Equal(t, []any{1, 2}, items)
+}
+
+func TestRateLimitedProducer_FakeClock(t *testing.T) {
+	clock := newFakeClock()
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	// 1 вызов в секунду: без движения часов второй Next не дождётся токена
+	producer := NewRateLimitedProducer(context.Background(), source, rate.NewLimiter(1, 1), PerCall, clock)
+
+	_, _, err := producer.Next()
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := producer.Next()
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return clock.activeTimers() == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Next got a token before the clock advanced")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Next still waits after the clock advanced")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PipeReduce работает как Pipe, но вместо потребителя принимает функцию
+// process, вычисляющую по батчу промежуточный результат B, и сворачивает
+// эти результаты функцией reduce, начиная с init. Итог возвращается из
+// PipeReduce без общего изменяемого состояния на стороне вызывающего —
+// например, сумма или подсчёт по ключам в задачах map-reduce.
+//
+// reduce вызывается после успешного process для каждого батча по порядку
+// обработки. При ошибке возвращается свёртка уже обработанных батчей, в том
+// числе тех, чьи cookie не успели зафиксироваться: после перезапуска они
+// будут прочитаны снова. С WithPerBatchTimeout Pipe дожидается process, а
+// результат батча, не уложившегося в срок, в свёртку не попадает: такой
+// батч считается упавшим.
+func PipeReduce[B, R any](p Producer, process func(items []any) (B, error), maxItems int, reduce func(acc R, result B) R, init R, opts ...Option) (R, error) {
+	if process == nil || reduce == nil {
+		return init, fmt.Errorf("%w: process and reduce must not be nil", ErrInvalidArgument)
+	}
+	r := &reducer[B, R]{process: process, reduce: reduce, acc: init}
+	err := Pipe(p, r, maxItems, opts...)
+	return r.result(), err
+}
+
+// reducer — потребитель, сворачивающий результаты батчей. Он реализует
+// ContextConsumer, поэтому при WithPerBatchTimeout Pipe вызывает его
+// синхронно и не оставляет просроченный process дорабатывать в фоне.
+type reducer[B, R any] struct {
+	process func(items []any) (B, error)
+	reduce  func(acc R, result B) R
+
+	mu  sync.Mutex
+	acc R
+}
+
+func (r *reducer[B, R]) Process(items []any) error {
+	return r.ProcessCtx(context.Background(), items)
+}
+
+// ProcessCtx сворачивает результат батча, только если его контекст не
+// истёк и не отменён к концу process: иначе Pipe считает батч упавшим, и
+// его результат учитывать нельзя
+func (r *reducer[B, R]) ProcessCtx(ctx context.Context, items []any) error {
+	result, err := r.process(items)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acc = r.reduce(r.acc, result)
+	return nil
+}
+
+func (r *reducer[B, R]) result() R {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.acc
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func sumItems(items []any) (int, error) {
+	sum := 0
+	for _, item := range items {
+		sum += item.(int)
+	}
+	return sum, nil
+}
+
+func addInt(acc, n int) int { return acc + n }
+
+func TestPipeReduce_Sum(t *testing.T) {
+	items := make([]any, 100)
+	for i := range items {
+		items[i] = i + 1
+	}
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, items, 3)
+
+	total, err := PipeReduce(source, sumItems, 10, addInt, 0)
+	require.NoError(t, err)
+	require.Equal(t, 5050, total)
+	require.NotEmpty(t, source.Committed())
+}
+
+func TestPipeReduce_CountByKey(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a", "b", "a", "c", "a", "b"}, 2)
+	count := func(items []any) (map[string]int, error) {
+		counts := make(map[string]int)
+		for _, item := range items {
+			counts[item.(string)]++
+		}
+		return counts, nil
+	}
+	merge := func(acc, counts map[string]int) map[string]int {
+		for key, n := range counts {
+			acc[key] += n
+		}
+		return acc
+	}
+
+	counts, err := PipeReduce(source, count, 0, merge, map[string]int{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"a": 3, "b": 2, "c": 1}, counts)
+}
+
+func TestPipeReduce_ErrorReturnsPartialResult(t *testing.T) {
+	processErr := errors.New("bad batch")
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1, 2}, Cookie: 1},
+		pipetest.Step{Items: []any{-1}, Cookie: 2},
+		pipetest.Step{Items: []any{3}, Cookie: 3},
+	)
+	process := func(items []any) (int, error) {
+		if items[0].(int) < 0 {
+			return 0, processErr
+		}
+		return sumItems(items)
+	}
+
+	total, err := PipeReduce(producer, process, 0, addInt, 0)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, processErr)
+	require.Equal(t, 3, total)
+}
+
+func TestPipeReduce_InvalidArguments(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1})
+
+	_, err := PipeReduce[int, int](source, nil, 1, addInt, 0)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = PipeReduce(source, sumItems, 1, nil, 0)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestPipeReduce_TimedOutBatchNotReduced(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1}, Cookie: 1},
+		pipetest.Step{Items: []any{2}, Cookie: 2},
+	)
+	// второй батч не укладывается в срок
+	process := func(items []any) (int, error) {
+		if items[0] == 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return sumItems(items)
+	}
+
+	total, err := PipeReduce(producer, process, 0, addInt, 0, WithPerBatchTimeout(10*time.Millisecond))
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, total)
+	require.Equal(t, []int{1}, producer.Committed())
+}
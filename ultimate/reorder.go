@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrReorderGap — в режиме WithOrderedCommit ожидаемый cookie не пришёл:
+// истёк таймаут, переполнился буфер или поток закончился
+var ErrReorderGap = errors.New("reorder gap")
+
+// reorderBuffer держит cookie, пришедшие раньше ожидаемого
+type reorderBuffer struct {
+	next int
+	held map[int]struct{}
+}
+
+// add принимает cookie и возвращает непрерывную серию, готовую к фиксации
+func (b *reorderBuffer) add(cookie int) []int {
+	if cookie < b.next {
+		// уже пройденный номер: держать его незачем
+		return []int{cookie}
+	}
+	b.held[cookie] = struct{}{}
+	var run []int
+	for {
+		if _, ok := b.held[b.next]; !ok {
+			return run
+		}
+		delete(b.held, b.next)
+		run = append(run, b.next)
+		b.next++
+	}
+}
+
+func (b *reorderBuffer) gap(reason string) error {
+	return fmt.Errorf("%w: cookie %d missing (%s), %d cookies held", ErrReorderGap, b.next, reason, len(b.held))
+}
+
+// runCommitOrdered — стадия Commit для WithOrderedCommit
+func (pp *pipe) runCommitOrdered(cancelCh <-chan struct{}) error {
+	buf := &reorderBuffer{next: pp.opts.orderedFirst, held: make(map[int]struct{})}
+	var timer Timer
+	var timerC <-chan time.Time
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+	}
+	defer stopTimer()
+
+	commitRun := func(cookie int) error {
+		waiting := buf.next
+		for _, c := range buf.add(cookie) {
+			if err := pp.commit(c); err != nil {
+				return err
+			}
+		}
+		if size := pp.opts.orderedBufferSize; size > 0 && len(buf.held) > size {
+			return buf.gap("buffer full")
+		}
+		// таймаут отсчитывается заново для каждого нового пропуска
+		if len(buf.held) == 0 || buf.next != waiting {
+			stopTimer()
+		}
+		if len(buf.held) > 0 && timer == nil && pp.opts.orderedTimeout > 0 {
+			timer = pp.opts.clock.NewTimer(pp.opts.orderedTimeout)
+			timerC = timer.C()
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case cookie, ok := <-pp.cookiesCh:
+			if !ok {
+				if len(buf.held) > 0 {
+					return buf.gap("end of stream")
+				}
+				return nil
+			}
+			if err := commitRun(cookie); err != nil {
+				return err
+			}
+		case <-timerC:
+			return buf.gap("timeout")
+		case <-cancelCh:
+			if !pp.drainOnCancel() {
+				return nil
+			}
+			// недостающие cookie уже не придут; то, что осталось в буфере,
+			// не фиксируется и будет повторено
+			for {
+				select {
+				case cookie, ok := <-pp.cookiesCh:
+					if ok {
+						if err := commitRun(cookie); err != nil {
+							return err
+						}
+						continue
+					}
+				default:
+				}
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_OrderedCommitReordersCookies(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"a"}, Cookie: 1},
+		pipetest.Step{Items: []any{"c"}, Cookie: 3},
+		pipetest.Step{Items: []any{"b"}, Cookie: 2},
+	)
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 0, WithOrderedCommit(1, 4, 0))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, producer.Committed())
+}
+
+func TestPipe_OrderedCommitGapAtEndOfStream(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"a"}, Cookie: 1},
+		pipetest.Step{Items: []any{"c"}, Cookie: 3},
+	)
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 0, WithOrderedCommit(1, 4, 0))
+	require.ErrorIs(t, err, ErrReorderGap)
+	require.ErrorContains(t, err, "cookie 2 missing")
+	require.Equal(t, []int{1}, producer.Committed())
+}
+
+func TestPipe_OrderedCommitBufferFull(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"c"}, Cookie: 3},
+		pipetest.Step{Items: []any{"d"}, Cookie: 4},
+		pipetest.Step{Items: []any{"a"}, Cookie: 1},
+	)
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 0, WithOrderedCommit(1, 1, 0))
+	require.ErrorIs(t, err, ErrReorderGap)
+	require.ErrorContains(t, err, "buffer full")
+	require.Empty(t, producer.Committed())
+}
+
+func TestPipe_OrderedCommitGapTimeout(t *testing.T) {
+	scripted := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"a"}, Cookie: 1},
+		pipetest.Step{Items: []any{"c"}, Cookie: 3},
+	)
+	// поток не кончается, пока тест не отпустит третий Next
+	producer := &gapProducer{ScriptedProducer: scripted, release: make(chan struct{})}
+	clock := newFakeClock()
+
+	ctrl := PipeControlled(producer, &pipetest.RecordingConsumer{}, 0,
+		WithClock(clock), WithOrderedCommit(1, 4, time.Minute))
+
+	require.Eventually(t, func() bool { return clock.activeTimers() == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, []int{1}, scripted.Committed())
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool { return !ctrl.Health().Commit.Running }, time.Second, time.Millisecond)
+	close(producer.release)
+
+	_, err := ctrl.Wait()
+	require.ErrorIs(t, err, ErrReorderGap)
+	require.ErrorContains(t, err, "timeout")
+	require.Equal(t, []int{1}, scripted.Committed())
+}
+
+// gapProducer задерживает третий вызов Next до закрытия release
+type gapProducer struct {
+	*pipetest.ScriptedProducer
+	release chan struct{}
+}
+
+func (p *gapProducer) Next() ([]any, int, error) {
+	if p.NextCalls() == 2 {
+		<-p.release
+	}
+	return p.ScriptedProducer.Next()
+}
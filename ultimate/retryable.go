@@ -0,0 +1,86 @@
+package main
+
+import "errors"
+
+// RetryableError — ошибка, которая сама сообщает, имеет ли смысл повторить
+// вызов. Next, Process и Commit могут возвращать такие ошибки, в том числе
+// обёрнутыми, вместо того чтобы обработчики сверяли их с сигнальными
+// значениями.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// IsRetryable сообщает, что err или одна из обёрнутых ею ошибок помечена
+// как повторяемая
+func IsRetryable(err error) bool {
+	var re RetryableError
+	return errors.As(err, &re) && re.Retryable()
+}
+
+// isFatal сообщает, что err явно помечена как неповторяемая
+func isFatal(err error) bool {
+	var re RetryableError
+	return errors.As(err, &re) && !re.Retryable()
+}
+
+// Retryable помечает err как повторяемую. nil остаётся nil.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err: err, retryable: true}
+}
+
+// Fatal помечает err как неповторяемую. nil остаётся nil.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err: err}
+}
+
+type retryableError struct {
+	err       error
+	retryable bool
+}
+
+func (e retryableError) Error() string   { return e.err.Error() }
+func (e retryableError) Unwrap() error   { return e.err }
+func (e retryableError) Retryable() bool { return e.retryable }
+
+// stageRetry — политика повторов WithStageRetry
+type stageRetry struct {
+	attempts int
+	backoff  Backoff
+}
+
+// withRetry вызывает call и повторяет его, пока он возвращает повторяемую
+// ошибку, но не больше попыток WithStageRetry. Неповторяемая или
+// неклассифицированная ошибка возвращается сразу.
+func (pp *pipe) withRetry(call func() error) error {
+	err := call()
+	policy := pp.opts.stageRetry
+	if err == nil || policy.attempts <= 1 {
+		return err
+	}
+	backoff := policy.backoff
+	if backoff.Clock == nil {
+		backoff.Clock = pp.opts.clock
+	}
+	if backoff.Rand == nil {
+		backoff.Rand = pp.rng
+	}
+	delay := backoff.delays()
+	for i := 1; i < policy.attempts && IsRetryable(err); i++ {
+		if d := delay(); d > 0 {
+			select {
+			case <-backoff.Clock.After(d):
+			case <-pp.ctx.Done():
+				return err
+			}
+		}
+		err = call()
+	}
+	return err
+}
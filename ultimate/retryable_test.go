@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyProducer возвращает из Next и Commit ошибки из очередей nextErrs и
+// commitErrs, пока они не кончатся
+type flakyProducer struct {
+	*pipetest.ScriptedProducer
+	nextErrs, commitErrs []error
+	nextCalls, commits   int
+}
+
+func (p *flakyProducer) Next() ([]any, int, error) {
+	p.nextCalls++
+	if len(p.nextErrs) > 0 {
+		err := p.nextErrs[0]
+		p.nextErrs = p.nextErrs[1:]
+		return nil, 0, err
+	}
+	return p.ScriptedProducer.Next()
+}
+
+func (p *flakyProducer) Commit(cookie int) error {
+	p.commits++
+	if len(p.commitErrs) > 0 {
+		err := p.commitErrs[0]
+		p.commitErrs = p.commitErrs[1:]
+		return err
+	}
+	return p.ScriptedProducer.Commit(cookie)
+}
+
+func newFlakyProducer() *flakyProducer {
+	return &flakyProducer{ScriptedProducer: pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1}, Cookie: 1},
+	)}
+}
+
+// flakyConsumer возвращает из Process ошибки из очереди errs
+type flakyConsumer struct {
+	pipetest.RecordingConsumer
+	errs  []error
+	calls int
+}
+
+func (c *flakyConsumer) Process(items []any) error {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	return c.RecordingConsumer.Process(items)
+}
+
+func TestPipe_StageRetryRetriesRetryableErrors(t *testing.T) {
+	unavailable := Retryable(errors.New("unavailable"))
+	producer := newFlakyProducer()
+	producer.nextErrs = []error{unavailable, fmt.Errorf("fetch: %w", unavailable)}
+	producer.commitErrs = []error{unavailable}
+	consumer := &flakyConsumer{errs: []error{unavailable, unavailable}}
+	clock := &sleepRecorder{}
+
+	err := Pipe(producer, consumer, 1, WithStageRetry(3, Backoff{Base: time.Second, Clock: clock}))
+	require.NoError(t, err)
+	require.Equal(t, []any{1}, consumer.Items())
+	require.Equal(t, []int{1}, producer.Committed())
+	require.Equal(t, 4, producer.nextCalls) // 2 ошибки, элемент, EOF
+	require.Equal(t, 3, consumer.calls)
+	require.Equal(t, 2, producer.commits)
+	require.Len(t, clock.sleeps, 5)
+}
+
+func TestPipe_StageRetryAbortsOnFatalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "marked fatal", err: Fatal(errors.New("bad request"))},
+		{name: "unclassified", err: errors.New("bad request")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := newFlakyProducer()
+			consumer := &flakyConsumer{errs: []error{tt.err}}
+
+			err := Pipe(producer, consumer, 1, WithStageRetry(3, Backoff{}))
+			require.ErrorIs(t, err, ErrProcessFailed)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, 1, consumer.calls)
+			require.Empty(t, producer.Committed())
+		})
+	}
+}
+
+func TestPipe_StageRetryAttemptsExhausted(t *testing.T) {
+	producer := newFlakyProducer()
+	producer.commitErrs = []error{Retryable(errors.New("a")), Retryable(errors.New("b")), Retryable(errors.New("c"))}
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 1, WithStageRetry(2, Backoff{}))
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.True(t, IsRetryable(err))
+	require.Equal(t, 2, producer.commits)
+}
+
+func TestPipe_NoStageRetryByDefault(t *testing.T) {
+	producer := newFlakyProducer()
+	producer.nextErrs = []error{Retryable(errors.New("unavailable"))}
+
+	err := Pipe(producer, &pipetest.RecordingConsumer{}, 1)
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.Equal(t, 1, producer.nextCalls)
+}
+
+func TestRetryWithBackoff_StopsOnFatal(t *testing.T) {
+	calls := 0
+	failing := ConsumerFunc(func([]any) error {
+		calls++
+		return Fatal(errors.New("schema mismatch"))
+	})
+
+	err := RetryMiddleware(5, 0, nil)(failing).Process([]any{1})
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+	require.Equal(t, 1, calls)
+}
+
+func TestRetryable_Marks(t *testing.T) {
+	base := errors.New("base")
+	require.True(t, IsRetryable(Retryable(base)))
+	require.True(t, IsRetryable(fmt.Errorf("wrapped: %w", Retryable(base))))
+	require.False(t, IsRetryable(Fatal(base)))
+	require.False(t, IsRetryable(base))
+	require.ErrorIs(t, Retryable(base), base)
+	require.NoError(t, Retryable(nil))
+	require.NoError(t, Fatal(nil))
+}
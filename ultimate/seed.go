@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// lockedSource — источник случайных чисел, безопасный для одновременного
+// использования из нескольких стадий
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// newSeededRand создаёт общий для стадий генератор с заданным seed
+func newSeededRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// seededRetrySleeps запускает pipeline, чей источник пять раз подряд
+// возвращает повторяемую ошибку, и возвращает выбранные паузы
+func seededRetrySleeps(t *testing.T, opts ...Option) []time.Duration {
+	t.Helper()
+	producer := newFlakyProducer()
+	for i := 0; i < 5; i++ {
+		producer.nextErrs = append(producer.nextErrs, Retryable(errors.New("unavailable")))
+	}
+	clock := &sleepRecorder{}
+	backoff := Backoff{Base: time.Second, Jitter: 1, Clock: clock}
+
+	opts = append(opts, WithStageRetry(10, backoff))
+	require.NoError(t, Pipe(producer, ConsumerFunc(func([]any) error { return nil }), 1, opts...))
+	require.Len(t, clock.sleeps, 5)
+	return clock.sleeps
+}
+
+func TestPipe_WithSeedIsDeterministic(t *testing.T) {
+	first := seededRetrySleeps(t, WithSeed(42))
+	second := seededRetrySleeps(t, WithSeed(42))
+	require.Equal(t, first, second)
+	require.NotEqual(t, first[0], first[1], "jitter must vary pauses")
+
+	other := seededRetrySleeps(t, WithSeed(43))
+	require.NotEqual(t, first, other)
+}
+
+func TestSeededRand_ConcurrentUse(t *testing.T) {
+	rng := newSeededRand(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				_ = rng.Float64()
+			}
+		}()
+	}
+	wg.Wait()
+}
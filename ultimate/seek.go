@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+// SeekableProducer — источник, умеющий сам встать на позицию после
+// заданного cookie. Если Producer реализует этот интерфейс и задан
+// WithStartAfterCookie, runNext вызывает SeekTo до первого Next вместо
+// отбрасывания уже обработанных результатов.
+type SeekableProducer interface {
+	SeekTo(cookie int) error
+}
+
+// seek позиционирует источник перед чтением. Ошибка SeekTo завершает стадию
+// Next с ErrNextFailed. Возвращает true, если
+// источник встал на позицию сам и отбрасывать результаты Next не нужно.
+func (pp *pipe) seek() (bool, error) {
+	if !pp.opts.startAfterSet {
+		return true, nil
+	}
+	sp, ok := pp.p.(SeekableProducer)
+	if !ok {
+		return false, nil
+	}
+	if err := sp.SeekTo(pp.opts.startAfter); err != nil {
+		return false, fmt.Errorf("%w: seek: %w", ErrNextFailed, err)
+	}
+	return true, nil
+}
+
+// skipped сообщает, что результат Next относится к уже обработанной части
+// потока и должен быть отброшен без обработки и фиксации
+func (pp *pipe) skipped(cookie int) bool {
+	return cookie <= pp.opts.startAfter
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// seekableProducer отдаёт по одному элементу на Next, cookie — номер элемента
+// начиная с 1
+type seekableProducer struct {
+	pipetest.RecordingCommitter
+
+	items   []any
+	pos     int
+	seekErr error
+
+	seekCalls []int
+	fetched   []int
+}
+
+func (p *seekableProducer) Next() ([]any, int, error) {
+	if p.pos >= len(p.items) {
+		return nil, 0, ErrEofCommitCookie
+	}
+	p.pos++
+	p.fetched = append(p.fetched, p.pos)
+	return p.items[p.pos-1 : p.pos], p.pos, nil
+}
+
+func (p *seekableProducer) SeekTo(cookie int) error {
+	p.seekCalls = append(p.seekCalls, cookie)
+	if p.seekErr != nil {
+		return p.seekErr
+	}
+	p.pos = cookie
+	return nil
+}
+
+func TestPipe_StartAfterCookieSeeksProducer(t *testing.T) {
+	producer := &seekableProducer{items: []any{"a", "b", "c", "d", "e"}}
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 10, WithStartAfterCookie(2))
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, producer.seekCalls)
+	// Источник встал на позицию сам: элементы до cookie 2 не запрашивались
+	require.Equal(t, []int{3, 4, 5}, producer.fetched)
+	require.Equal(t, []any{"c", "d", "e"}, consumer.Items())
+	require.Equal(t, []int{3, 4, 5}, producer.Committed())
+}
+
+func TestPipe_StartAfterCookieDiscardsWithoutSeek(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a", "b", "c", "d"}, 1, 1, 1, 1)
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 10, WithStartAfterCookie(2))
+	require.NoError(t, err)
+	require.Equal(t, []any{"c", "d"}, consumer.Items())
+	// Отброшенные результаты уже зафиксированы прошлым запуском
+	require.Equal(t, []int{3, 4}, producer.Committed())
+}
+
+func TestPipe_StartAfterCookieSeekError(t *testing.T) {
+	seekErr := errors.New("offset out of range")
+	producer := &seekableProducer{items: []any{"a"}, seekErr: seekErr}
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 10, WithStartAfterCookie(7))
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.ErrorIs(t, err, seekErr)
+	require.Empty(t, producer.fetched)
+	require.Empty(t, consumer.Batches())
+}
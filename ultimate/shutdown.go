@@ -0,0 +1,90 @@
+package main
+
+import "sync"
+
+// ShutdownPreference определяет, что важнее при отмене: сохранить уже
+// накопленные данные или остановиться как можно быстрее
+type ShutdownPreference int
+
+const (
+	// FastStop — стадии завершаются сразу после отмены, буфер runNext и
+	// ещё не обработанные батчи отбрасываются
+	FastStop ShutdownPreference = iota
+	// FlushFirst — после отмены runNext больше не вызывает Next, но отдаёт
+	// накопленный буфер; стадии обработки и фиксации дорабатывают всё, что
+	// уже в пути. Если какая-либо стадия упала, дорабатывать нечего, и
+	// остановка происходит как при FastStop.
+	FlushFirst
+)
+
+// shutdown хранит общее для всех стадий состояние корректной остановки
+type shutdown struct {
+	once     sync.Once
+	deadline chan struct{}
+
+	failOnce sync.Once
+	failedCh chan struct{}
+
+	done chan struct{}
+}
+
+func newShutdown() *shutdown {
+	return &shutdown{failedCh: make(chan struct{}), done: make(chan struct{})}
+}
+
+// graceCh возвращает канал остановки стадии. При FastStop это сам cancelCh.
+// При FlushFirst канал закрывается позже отмены: когда истёк срок
+// WithShutdownPreference или когда какая-либо стадия упала.
+func (pp *pipe) graceCh(cancelCh <-chan struct{}) <-chan struct{} {
+	if pp.opts.shutdown != FlushFirst {
+		return cancelCh
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		select {
+		case <-cancelCh:
+		case <-pp.shutdown.done:
+			return
+		}
+		select {
+		case <-pp.shutdownDeadline():
+		case <-pp.shutdown.failedCh:
+		case <-pp.shutdown.done:
+		}
+	}()
+	return ch
+}
+
+// shutdownDeadline запускает отсчёт срока корректной остановки при первом
+// вызове. Без срока канал не закрывается никогда.
+func (pp *pipe) shutdownDeadline() <-chan struct{} {
+	s := pp.shutdown
+	s.once.Do(func() {
+		if pp.opts.shutdownTimeout <= 0 {
+			return
+		}
+		s.deadline = make(chan struct{})
+		timer := pp.opts.clock.NewTimer(pp.opts.shutdownTimeout)
+		go func() {
+			defer timer.Stop()
+			select {
+			case <-timer.C():
+				close(s.deadline)
+			case <-s.done:
+			}
+		}()
+	})
+	return s.deadline
+}
+
+// flushOnCancel отдаёт накопленный буфер при отмене, если выбран FlushFirst
+func (pp *pipe) flushOnCancel(stopCh <-chan struct{}, buf itemBuffer, cookies []int) error {
+	if pp.opts.shutdown != FlushFirst || pp.aborted() || (buf.len() == 0 && len(cookies) == 0) {
+		return nil
+	}
+	if _, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); err != nil {
+		return wrapNextErr(err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// cancellingProducer отдаёт два результата, затем отменяет контекст и
+// продолжает возвращать пустые результаты с тем же cookie, пока pipeline
+// не заметит отмену. Буфер runNext к этому моменту не сброшен.
+type cancellingProducer struct {
+	pipetest.RecordingCommitter
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *cancellingProducer) Next() ([]any, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	switch p.calls {
+	case 1:
+		return []any{"item1"}, 1, nil
+	case 2:
+		return []any{"item2"}, 2, nil
+	}
+	p.cancel()
+	time.Sleep(time.Millisecond)
+	return []any{}, 2, nil
+}
+
+func TestPipe_ShutdownPreference(t *testing.T) {
+	tests := []struct {
+		name      string
+		pref      ShutdownPreference
+		processed []any
+		committed []int
+	}{
+		{name: "fast stop drops buffer", pref: FastStop},
+		{name: "flush first delivers buffer", pref: FlushFirst, processed: []any{"item1", "item2"}, committed: []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			producer := &cancellingProducer{cancel: cancel}
+			consumer := &pipetest.RecordingConsumer{}
+
+			_, err := PipeContext(ctx, producer, consumer, 10, WithShutdownPreference(tt.pref, time.Second))
+			require.ErrorIs(t, err, context.Canceled)
+			require.Equal(t, tt.processed, consumer.Items())
+			require.Equal(t, tt.committed, producer.Committed())
+		})
+	}
+}
+
+func TestPipe_FlushFirstRespectsDrainTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	producer := &cancellingProducer{cancel: cancel}
+	// Потребитель завис: WithDrainTimeout ограничивает и корректную остановку
+	release := make(chan struct{})
+	defer close(release)
+	consumer := ConsumerFunc(func(items []any) error {
+		<-release
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := PipeContext(ctx, producer, consumer, 10,
+			WithShutdownPreference(FlushFirst, 20*time.Millisecond),
+			WithDrainTimeout(100*time.Millisecond))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, err, ErrDrainTimeout)
+		require.Empty(t, producer.Committed())
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipe did not stop")
+	}
+}
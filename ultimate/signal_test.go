@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/EmirShimshir/buffered-reader-writer/signalaware"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptedProducer шлёт сигнал после signalAfter вызовов Next
+type interruptedProducer struct {
+	pipetest.RecordingCommitter
+	signals     chan<- os.Signal
+	draining    <-chan struct{}
+	signalAfter int
+	next        int
+}
+
+func (p *interruptedProducer) Next() ([]any, int, error) {
+	p.next++
+	if p.next == p.signalAfter {
+		p.signals <- syscall.SIGINT
+		<-p.draining
+	}
+	return []any{p.next}, p.next, nil
+}
+
+func TestPipe_SignalAwareDrainsBuffer(t *testing.T) {
+	ch := make(chan os.Signal, 1)
+	s := signalaware.NewWithChannel(ErrEofCommitCookie, ch)
+	defer s.Stop()
+
+	producer := &interruptedProducer{signals: ch, draining: s.Draining(), signalAfter: 3}
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(s.Wrap(producer), consumer, 10)
+	require.NoError(t, err)
+
+	// буфер из трёх элементов обработан и зафиксирован, а не потерян
+	require.Equal(t, []any{1, 2, 3}, consumer.Items())
+	require.Equal(t, []int{1, 2, 3}, producer.Committed())
+}
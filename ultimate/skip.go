@@ -0,0 +1,40 @@
+package main
+
+import "errors"
+
+// ErrSkip возвращается из Process, если потребитель сознательно пропускает
+// батч, например потому что он уже обработан в другом месте. Такой батч не
+// считается ошибкой: его cookie фиксируются как обычно, и pipeline продолжает
+// работу.
+var ErrSkip = errors.New("skip batch")
+
+// skipBatch сбрасывает ErrSkip, в том числе обёрнутую потребителем
+func skipBatch(err error) error {
+	if errors.Is(err, ErrSkip) {
+		return nil
+	}
+	return err
+}
+
+// consumeParts обрабатывает по очереди все n частей батча. Пропуск одной
+// части не прерывает обработку остальных; ErrSkip возвращается, только если
+// пропущены все части.
+func consumeParts(n int, consume func(i int) error) error {
+	var skipErr error
+	skipped := 0
+	for i := range n {
+		err := consume(i)
+		if errors.Is(err, ErrSkip) {
+			skipped++
+			skipErr = err
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if skipped == n {
+		return skipErr
+	}
+	return nil
+}
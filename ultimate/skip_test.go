@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_SkippedBatchesAreCommitted(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6}, 1, 1, 1, 1, 1, 1)
+	calls := 0
+	consumer := &pipetest.RecordingConsumer{
+		// Каждый второй батч пропускается, в том числе с обёрнутой ErrSkip
+		Fail: func(items []any) error {
+			calls++
+			switch calls % 4 {
+			case 2:
+				return ErrSkip
+			case 0:
+				return fmt.Errorf("already imported: %w", ErrSkip)
+			}
+			return nil
+		},
+	}
+
+	err := Pipe(producer, consumer, 1)
+	require.NoError(t, err)
+	require.Equal(t, 6, calls)
+	require.Equal(t, []any{1, 3, 5}, consumer.Items())
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6}, producer.Committed())
+}
+
+func TestPipe_SkippedSplitHalfKeepsOtherHalf(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4}, 4)
+	// целиком батч не помещается, первая половина пропускается
+	consumer := &pipetest.RecordingConsumer{Fail: func(items []any) error {
+		if len(items) > 2 {
+			return ErrBatchTooLarge
+		}
+		if items[0] == 1 {
+			return ErrSkip
+		}
+		return nil
+	}}
+
+	require.NoError(t, Pipe(source, consumer, 4))
+	require.Equal(t, []any{3, 4}, consumer.Items())
+	require.Equal(t, []int{1}, source.Committed())
+}
+
+func TestPipe_SkippedGroupKeepsOtherGroups(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{"a1", "b1", "a2", "c1"}, 4)
+	consumer := &pipetest.RecordingConsumer{Fail: func(items []any) error {
+		if items[0] == "a1" {
+			return ErrSkip
+		}
+		return nil
+	}}
+	byLetter := WithGroupKey(func(item any) any { return item.(string)[:1] })
+
+	require.NoError(t, Pipe(source, consumer, 4, byLetter))
+	require.Equal(t, [][]any{{"b1"}, {"c1"}}, consumer.Batches())
+	require.Equal(t, []int{1}, source.Committed())
+}
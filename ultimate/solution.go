@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -11,20 +17,52 @@ var (
 	ErrNextFailed      = errors.New("next failed")
 	ErrProcessFailed   = errors.New("process failed")
 	ErrCommitFailed    = errors.New("commit failed")
+
+	// ErrInvalidArgument — Pipe вызван с некорректными аргументами
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrDrainTimeout — стадии не завершились за отведённое на shutdown время
+	ErrDrainTimeout = errors.New("drain timeout")
+
+	// ErrPipelineUsed — Pipeline уже запускался и не был сброшен через Reset
+	ErrPipelineUsed = errors.New("pipeline already used")
 )
 
-type Producer interface {
-	Next() (items []any, cookie int, err error)
-	Commit(cookie int) error
+// ProducerOf — источник элементов T с cookie произвольного типа C,
+// например смещениями int64 или непрозрачными строками. Конец данных
+// обозначается только ошибкой ErrEofCommitCookie (или io.EOF), поэтому
+// значение cookie при этом не важно. После конца данных Pipe больше не
+// вызывает Next.
+type ProducerOf[T any, C comparable] interface {
+	Next() (items []T, cookie C, err error)
+	Commit(cookie C) error
+}
+
+// ConsumerOf — потребитель батчей элементов T
+type ConsumerOf[T any] interface {
+	Process(items []T) error
 }
 
-type Consumer interface {
-	Process(items []any) error
+// Producer — источник с int-cookie, с которым работает Pipe
+type Producer = ProducerOf[any, int]
+
+// Consumer — потребитель, с которым работает Pipe
+type Consumer = ConsumerOf[any]
+
+// ContextConsumer — потребитель, которому нужен контекст батча, например
+// для извлечения trace-метаданных. Если Consumer реализует этот интерфейс,
+// вместо Process вызывается ProcessCtx.
+type ContextConsumer interface {
+	ProcessCtx(ctx context.Context, items []any) error
 }
 
 type batch struct {
+	seq     int
 	buf     []any
 	cookies []int
+	span    *tracedBatch
+	// путь части батча после деления, например "/1/0"; пусто — батч целиком
+	part string
 }
 
 // StageError — ошибка стадии с индексом и самой ошибкой
@@ -36,10 +74,20 @@ type StageError struct {
 // StageFunc — функция стадии, возвращает ошибку
 type StageFunc func(cancelCh <-chan struct{}) error
 
-// Pipeline структура
+// Pipeline структура. Один запуск расходует каналы отмены стадий, поэтому
+// перед повторным Run нужно вызвать Reset; сами стадии при этом должны
+// допускать повторный вызов.
 type Pipeline struct {
 	stages      []StageFunc
 	cancelChans []chan struct{}
+	errorMode   ErrorMode
+
+	drainTimeout time.Duration
+	clock        Clock
+
+	mu      sync.Mutex
+	running bool
+	used    bool
 }
 
 // NewPipeline создаёт пустой pipeline
@@ -47,6 +95,7 @@ func NewPipeline() *Pipeline {
 	return &Pipeline{
 		stages:      []StageFunc{},
 		cancelChans: []chan struct{}{},
+		clock:       realClock{},
 	}
 }
 
@@ -56,21 +105,83 @@ func (pl *Pipeline) AddStage(stage StageFunc) {
 	pl.cancelChans = append(pl.cancelChans, make(chan struct{}))
 }
 
+// Reset готовит pipeline к следующему запуску с теми же стадиями и
+// настройками. Пока работает какая-либо стадия, в том числе зависшая и
+// оставленная в фоне после ErrDrainTimeout, возвращает ErrPipelineUsed.
+func (pl *Pipeline) Reset() error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.running {
+		return ErrPipelineUsed
+	}
+	for i := range pl.cancelChans {
+		pl.cancelChans[i] = make(chan struct{})
+	}
+	pl.used = false
+	return nil
+}
+
+// start отмечает начало запуска; повторный запуск без Reset запрещён
+func (pl *Pipeline) start() error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.used {
+		return ErrPipelineUsed
+	}
+	pl.used, pl.running = true, true
+	return nil
+}
+
+func (pl *Pipeline) stop() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.running = false
+}
+
+// SetErrorMode задаёт, как сводятся ошибки стадий, по умолчанию JoinAll
+func (pl *Pipeline) SetErrorMode(mode ErrorMode) {
+	pl.errorMode = mode
+}
+
+// SetDrainTimeout ограничивает время ожидания стадий после первой ошибки
+// или отмены. По истечении RunContext возвращается с ErrDrainTimeout, не
+// дожидаясь зависших стадий. 0 — ждать без ограничения.
+func (pl *Pipeline) SetDrainTimeout(timeout time.Duration) {
+	pl.drainTimeout = timeout
+}
+
+// SetClock подменяет источник времени для таймеров pipeline
+func (pl *Pipeline) SetClock(clock Clock) {
+	pl.clock = clock
+}
+
 // Run запускает pipeline и ждёт завершения
 func (pl *Pipeline) Run() error {
+	return pl.RunContext(context.Background())
+}
+
+// RunContext работает как Run, но отмена ctx останавливает все стадии,
+// как если бы упала последняя из них, а ошибка ctx попадает в результат
+func (pl *Pipeline) RunContext(ctx context.Context) error {
 	if len(pl.stages) == 0 {
 		return nil
 	}
+	if err := pl.start(); err != nil {
+		return err
+	}
 
 	var wg sync.WaitGroup
-	errCh := make(chan StageError, len(pl.stages))
-	doneErrCh := make(chan StageError, len(pl.stages))
+	errCh := make(chan StageError, len(pl.stages)+1) // +1 для отмены ctx
+	doneErrCh := make(chan StageError, len(pl.stages)+1)
 	onceList := make([]sync.Once, len(pl.stages))
+	// каналы отмены этого запуска: стадии, оставшиеся в фоне после
+	// ErrDrainTimeout, не должны дотянуться до каналов следующего
+	cancelChans := slices.Clone(pl.cancelChans)
 
 	// Запуск стадий
 	for i, stage := range pl.stages {
 		wg.Add(1)
-		cancelCh := pl.cancelChans[i]
+		cancelCh := cancelChans[i]
 		index := i
 		go func(st StageFunc, ch chan struct{}, idx int) {
 			defer wg.Done()
@@ -86,115 +197,860 @@ func (pl *Pipeline) Run() error {
 		for se := range errCh {
 			// каскадное закрытие всех предыдущих стадий
 			for i := se.Index; i >= 0; i-- {
-				onceList[i].Do(func() { close(pl.cancelChans[i]) })
+				onceList[i].Do(func() { close(cancelChans[i]) })
 			}
 			doneErrCh <- se
 		}
 	}()
 
-	wg.Wait()
-	close(errCh) // закрыть канал ошибок, чтобы координатор завершил работу
+	// Наблюдатель за внешним контекстом
+	stopped := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-ctx.Done():
+			errCh <- StageError{Index: len(pl.stages) - 1, Err: ctx.Err()}
+		case <-stopped:
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		// запуск завершён, только когда вышли все стадии
+		pl.stop()
+		close(stopped)
+		<-watcherDone
+		close(errCh) // закрыть канал ошибок, чтобы координатор завершил работу
+	}()
 
-	// Собираем все ошибки
+	// Собираем все ошибки. После первой ошибки начинается shutdown, и если
+	// задан drainTimeout, ждём остальные стадии не дольше него.
 	var allErrs []error
-	for se := range doneErrCh {
-		allErrs = append(allErrs, se.Err)
+	var drainCh <-chan time.Time
+	for {
+		select {
+		case se, ok := <-doneErrCh:
+			if !ok {
+				return pl.errorMode.combine(allErrs)
+			}
+			allErrs = append(allErrs, se.Err)
+			if drainCh == nil && pl.drainTimeout > 0 {
+				timer := pl.clock.NewTimer(pl.drainTimeout)
+				defer timer.Stop()
+				drainCh = timer.C()
+			}
+		case <-drainCh:
+			// зависшие стадии продолжат работу в фоне: каналы ошибок
+			// буферизованы, поэтому их завершение ничего не заблокирует
+			return pl.errorMode.combine(append(allErrs, ErrDrainTimeout))
+		}
 	}
+}
+
+// Pipe переносит данные из p в c, группируя их в батчи не более maxItems.
+// maxItems <= 0 отключает буферизацию: каждый результат Next уходит в
+// Process отдельным батчем, и его cookie фиксируется сразу после обработки.
+// Подряд идущие результаты Next с одним cookie — одна транзакция: её cookie
+// фиксируется один раз, после батча с её последними элементами. Без
+// буферизации, при сбросе буфера по времени и по FlushNow во время Next
+// продолжение транзакции ещё неизвестно, и cookie фиксируется с первым её
+// батчем.
+// nil вместо p или c приводит к ErrInvalidArgument.
+func Pipe(p Producer, c Consumer, maxItems int, opts ...Option) error {
+	_, err := PipeWithStats(p, c, maxItems, opts...)
+	return err
+}
 
-	if len(allErrs) > 0 {
-		return errors.Join(allErrs...)
+// PipeWithStats работает как Pipe и дополнительно возвращает статистику
+// запуска, в том числе при аварийном завершении
+func PipeWithStats(p Producer, c Consumer, maxItems int, opts ...Option) (PipeStats, error) {
+	return PipeContext(context.Background(), p, c, maxItems, opts...)
+}
+
+// PipeContext работает как PipeWithStats в рамках ctx. Отмена ctx
+// останавливает все стадии. Потребитель, реализующий ContextConsumer,
+// получает контекст, производный от ctx, для каждого батча.
+func PipeContext(ctx context.Context, p Producer, c Consumer, maxItems int, opts ...Option) (PipeStats, error) {
+	if err := validateArgs(p, c); err != nil {
+		return PipeStats{}, err
+	}
+	pp := newPipe(p, c, maxItems, opts)
+	err := pp.run(ctx)
+	return pp.stats.snapshot(), err
+}
+
+// validateArgs проверяет аргументы Pipe до запуска стадий, чтобы вместо
+// паники внутри горутины вернуть понятную ошибку
+func validateArgs(p Producer, c Consumer) error {
+	switch {
+	case p == nil:
+		return fmt.Errorf("%w: producer is nil", ErrInvalidArgument)
+	case c == nil:
+		return fmt.Errorf("%w: consumer is nil", ErrInvalidArgument)
 	}
 	return nil
 }
 
-func Pipe(p Producer, c Consumer, maxItems int) error {
-	pipeline := NewPipeline()
+// pipe хранит состояние одного запуска Pipe, общее для всех стадий
+type pipe struct {
+	ctx      context.Context
+	p        Producer
+	c        Consumer
+	maxItems int
+	opts     options
+
+	batchCh chan batch
+	// cookie для стадии Commit и сигнал её завершения; при WithInlineCommit
+	// стадии нет, и оба равны nil
+	cookiesCh  chan int
+	commitDone chan struct{}
+
+	inflight *inflightLimiter
+	stats    statsCollector
+	adaptive *adaptiveBatching
+	ctrl     *Controller
+	abort    *abortLatch
+	tracing  *batchTracing
+	failed   atomic.Bool
+	shutdown *shutdown
+	stall    *stallWatch
+	idle     idleSignal
+
+	// максимальный cookie, отправленный на фиксацию в режиме смещений;
+	// используется только стадией обработки
+	offsetSent bool
+	offsetHigh int
+
+	// номер следующего батча; используется только стадией Next
+	nextSeq int
+
+	// контекст обрабатываемого батча; используется только стадией Process
+	processCtx context.Context
+
+	// контекст бюджета времени, nil без WithTimeBudget
+	budget context.Context
+	// источник случайности запуска, nil без WithSeed
+	rng *rand.Rand
+	// обработанные, но не зафиксированные cookie, включая cookie батча в
+	// обработке; без WithMaxUncommitted лимита нет
+	uncommitted *inflightLimiter
+}
+
+func newPipe(p Producer, c Consumer, maxItems int, opts []Option) *pipe {
+	// отрицательный maxItems — тот же режим без буферизации, что и 0
+	maxItems = max(maxItems, 0)
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.dryRun {
+		// журнал фиксаций — тоже надёжная запись, в пробном запуске он не нужен
+		o.commitLog = nil
+	}
+	pp := &pipe{
+		p:        p,
+		c:        c,
+		maxItems: maxItems,
+		opts:     o,
+		batchCh:  make(chan batch, max(o.maxInflightBatches, 1)),
+		inflight: newInflightLimiter(o.maxBufferedItems),
+		ctrl:     newController(),
+		abort:    newAbortLatch(),
+		tracing:  newBatchTracing(o.tracer, o.name),
+		shutdown: newShutdown(),
+		stall:    newStallWatch(o.stallTimeout, o.clock),
+		idle:     newIdleSignal(o.eagerFlushWhenIdle),
+	}
+	if !pp.inlineCommit() {
+		pp.cookiesCh = make(chan int, 256)
+		pp.commitDone = make(chan struct{})
+	}
+	pp.stats.maxItems = maxItems
+	if o.adaptive && maxItems != 0 {
+		pp.adaptive = newAdaptiveBatching(o.adaptiveMin, min(o.adaptiveMax, maxItems), o.adaptiveTarget)
+	}
+	if o.seedSet {
+		pp.rng = newSeededRand(o.seed)
+	}
+	uncommittedLimit := 0
+	if o.commitMode != CommitAtEnd && !pp.inlineCommit() {
+		uncommittedLimit = o.maxUncommitted
+	}
+	pp.uncommitted = newInflightLimiter(uncommittedLimit)
+	return pp
+}
+
+// flushLimit возвращает текущий порог сброса буфера
+func (pp *pipe) flushLimit() int {
+	if pp.adaptive != nil {
+		return pp.adaptive.current()
+	}
+	return pp.maxItems
+}
+
+// merge добавляет новые элементы в буфер
+func (pp *pipe) merge(buf itemBuffer, items []any) {
+	wasEmpty := buf.len() == 0
+	if pp.opts.coalesce != nil {
+		if pp.opts.copyBatch {
+			// слияние может оставить в буфере срез источника, а тот
+			// перезапишет его в следующем Next, ещё до сброса
+			items = slices.Clone(items)
+		}
+		buf.replace(pp.opts.coalesce(buf.view(), items))
+	} else {
+		buf.push(items)
+	}
+	pp.ctrl.buffered.Store(int64(buf.len()))
+	if wasEmpty && buf.len() > 0 && pp.opts.onBufferStart != nil {
+		pp.opts.onBufferStart()
+	}
+}
 
-	batchCh := make(chan batch, 1)
-	cookiesCh := make(chan int, 256)
+// carryCookie отделяет от cookies батча, который отправляется перед
+// результатом Next с cookie next, cookie продолжающейся транзакции. Она
+// переходит в следующий батч и фиксируется после своих последних элементов.
+func carryCookie(cookies []int, next int) (emitted, carried []int) {
+	if n := len(cookies); n > 0 && cookies[n-1] == next {
+		return cookies[: n-1 : n-1], []int{next}
+	}
+	return cookies, []int{}
+}
 
-	pipeline.AddStage(func(cancelCh <-chan struct{}) error {
-		return runNext(cancelCh, p, maxItems, batchCh)
-	})
+// dropBuffer отбрасывает буфер, не отданный в обработку из-за ошибки или
+// отмены, чтобы BufferedItems и хук WithOnBufferEmpty это отразили
+func (pp *pipe) dropBuffer(buf itemBuffer) {
+	if buf.len() > 0 {
+		pp.takeBuffer(buf)
+	}
+}
 
-	pipeline.AddStage(func(cancelCh <-chan struct{}) error {
-		return runProcess(cancelCh, c, batchCh, cookiesCh)
-	})
+// takeBuffer забирает содержимое буфера для батча
+func (pp *pipe) takeBuffer(buf itemBuffer) []any {
+	wasEmpty := buf.len() == 0
+	items := buf.take()
+	pp.ctrl.buffered.Store(0)
+	if !wasEmpty && pp.opts.onBufferEmpty != nil {
+		pp.opts.onBufferEmpty()
+	}
+	return items
+}
 
-	pipeline.AddStage(func(cancelCh <-chan struct{}) error {
-		return runCommit(cancelCh, p, cookiesCh)
-	})
+func (pp *pipe) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stallErrCh <-chan error
+	if pp.stall != nil {
+		stallErrCh = pp.watchStalls(pp.shutdown.done, cancel)
+	}
+	pp.watchAbort(cancel)
+	statsTicked := pp.tickStats(pp.shutdown.done)
+	stopBudget := pp.startTimeBudget(ctx)
+	defer stopBudget()
+	pp.ctx = ctx
+	err := pp.recoverCommits()
+	if err == nil {
+		err = pp.pipeline().RunContext(ctx)
+	}
+	abortedRun := pp.abort.settle()
+	close(pp.shutdown.done)
+	if statsTicked != nil {
+		// после возврата из Pipe хук больше не вызывается
+		<-statsTicked
+	}
+	if stallErrCh != nil {
+		if stallErr := <-stallErrCh; stallErr != nil {
+			err = errors.Join(stallErr, err)
+		}
+	}
+	if abortedRun {
+		err = pp.ctrl.abortErr
+	}
+	if err == nil && pp.opts.timeBudgetErr && pp.budgetExceeded() {
+		err = ErrTimeBudgetExceeded
+	}
+	pp.tracing.finish(err)
+	last, ok := pp.stats.lastCommitted()
+	return newPipeError(err, pp.opts.name, last, ok)
+}
 
-	return pipeline.Run()
+// pipeline собирает стадии запуска. При inline-фиксации отдельная стадия
+// Commit не нужна: cookie фиксирует сама стадия обработки.
+func (pp *pipe) pipeline() *Pipeline {
+	pipeline := NewPipeline()
+	pipeline.SetErrorMode(pp.opts.errorMode)
+	pipeline.SetDrainTimeout(pp.opts.drainTimeout)
+	pipeline.SetClock(pp.opts.clock)
+	pipeline.AddStage(pp.trackStage(StageNext, pp.runNext))
+	pipeline.AddStage(pp.trackStage(StageProcess, pp.runProcess))
+	if !pp.inlineCommit() {
+		pipeline.AddStage(pp.trackStage(StageCommit, pp.runCommit))
+	}
+	return pipeline
 }
 
-func runNext(cancelCh <-chan struct{}, p Producer, maxItems int, batchCh chan<- batch) error {
-	defer close(batchCh)
+func (pp *pipe) inlineCommit() bool {
+	return pp.opts.inlineCommit && pp.opts.commitMode == CommitPerBatch
+}
 
-	buf := make([]any, 0, maxItems)
+// emit отправляет батч в стадию обработки, соблюдая лимит элементов "в полёте"
+func (pp *pipe) emit(cancelCh <-chan struct{}, b batch) (bool, error) {
+	if pp.opts.copyBatch {
+		// копируем сразу: источник может переиспользовать срез уже в следующем Next
+		b.buf = append(make([]any, 0, len(b.buf)), b.buf...)
+	}
+	ok, err := pp.inflight.acquire(cancelCh, pp.opts.clock, len(b.buf), pp.opts.backpressureTimeout)
+	if err != nil || !ok {
+		return false, err
+	}
+	b.seq = pp.nextSeq
+	pp.nextSeq++
+	// батч займёт стадию обработки: прежний сигнал простоя устарел
+	pp.idle.consume()
+	b.span = pp.tracing.start(b)
+	if ok := writeChanWithCancel(cancelCh, pp.batchCh, b); !ok {
+		pp.inflight.release(len(b.buf))
+		return false, nil
+	}
+	return true, nil
+}
+
+func (pp *pipe) runNext(cancelCh <-chan struct{}) (err error) {
+	defer func() {
+		// отметка об ошибке должна быть видна до закрытия канала
+		pp.markFailed(err)
+		close(pp.batchCh)
+	}()
+
+	var flushTimer Timer
+	if pp.opts.flushInterval > 0 {
+		flushTimer = pp.opts.clock.NewTimer(pp.opts.flushInterval)
+		defer flushTimer.Stop()
+	}
+
+	positioned, err := pp.seek()
+	if err != nil {
+		return err
+	}
+	// при FlushFirst отправка батчей переживает отмену
+	stopCh := pp.graceCh(cancelCh)
+
+	buf := newItemBuffer(pp.opts.bufferStrategy, pp.maxItems, pp.opts.headroomItems)
+	defer pp.dropBuffer(buf)
 	var cookies []int
+	// cookie последней транзакции, уже попавший в батч
+	lastCookie, inTxn := 0, false
+	// время поступления самого старого элемента в буфере
+	var bufferedAt time.Time
+	// источник уже отдал последние элементы вместе с EOF
+	eof := false
+	// подряд идущие пустые результаты Next без ошибки
+	emptyRun := 0
 	for {
 		select {
 		case <-cancelCh:
-			return nil
+			return pp.flushOnCancel(stopCh, buf, cookies)
 		default:
-			items, cookie, err := p.Next()
-			if errors.Is(err, ErrEofCommitCookie) {
-				if len(buf) > 0 {
-					if ok := writeChanWithCancel(cancelCh, batchCh, batch{buf: buf, cookies: cookies}); !ok {
-						return nil
+			if resumeCh, paused := pp.ctrl.paused(); paused {
+				// На паузе сначала отдаём накопленное, затем ждём Resume
+				if buf.len() > 0 || len(cookies) > 0 {
+					if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); !ok {
+						return wrapNextErr(err)
+					}
+					cookies = []int{}
+				}
+				select {
+				case <-cancelCh:
+					return pp.flushOnCancel(stopCh, buf, cookies)
+				case <-resumeCh:
+				}
+			}
+			if pp.ctrl.flushRequested() && (buf.len() > 0 || len(cookies) > 0) {
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); !ok {
+					return wrapNextErr(err)
+				}
+				cookies = []int{}
+			}
+
+			var items []any
+			var cookie int
+			var err error
+			if eof || pp.budgetExceeded() {
+				// бюджет времени исчерпан: поток завершается как при конце
+				// данных, и всё прочитанное обрабатывается и фиксируется
+				err = ErrEofCommitCookie
+			} else {
+				flushed, flushErr := true, error(nil)
+				pp.enterStage(StageNext)
+				items, cookie, err = pp.callNext(buf.len() > 0 || len(cookies) > 0, func() bool {
+					// FlushNow, пока Next ещё не вернулся
+					if buf.len() == 0 && len(cookies) == 0 {
+						return true
+					}
+					ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies})
+					if !ok {
+						flushed, flushErr = false, err
+						return false
+					}
+					cookies = []int{}
+					return true
+				})
+				pp.leaveStage(StageNext)
+				if !flushed {
+					return wrapNextErr(flushErr)
+				}
+				if pp.opts.strictProducer || pp.opts.strictMaxItems {
+					if perr := pp.checkProtocol(items, err); perr != nil {
+						return perr
+					}
+				}
+				if err == nil && len(items) == 0 && pp.opts.endOnEmptyRun > 0 {
+					// источник сообщает о конце данных серией пустых результатов
+					if emptyRun++; emptyRun >= pp.opts.endOnEmptyRun {
+						err = ErrEofCommitCookie
+					}
+				} else {
+					emptyRun = 0
+				}
+			}
+			if isEOF(err) && len(items) > 0 {
+				// Источник отдал последние элементы вместе с EOF: обрабатываем
+				// их как обычный результат, а поток завершаем на следующей итерации
+				eof, err = true, nil
+			}
+			if isEOF(err) {
+				// cookie результатов без элементов тоже должны быть зафиксированы
+				if buf.len() > 0 || len(cookies) > 0 {
+					if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); !ok {
+						return wrapNextErr(err)
 					}
 				}
 				return nil
 			}
 			if err != nil {
-				return fmt.Errorf("%w: %v", ErrNextFailed, err)
+				return fmt.Errorf("%w: %w", ErrNextFailed, err)
+			}
+			if !positioned {
+				if pp.skipped(cookie) {
+					continue
+				}
+				positioned = true
+			}
+			if pp.ctrl.flushRequested() && (buf.len() > 0 || len(cookies) > 0) {
+				// FlushNow пришёл во время Next: сбрасываем накопленное до него
+				var emitted []int
+				emitted, cookies = carryCookie(cookies, cookie)
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: emitted}); !ok {
+					return wrapNextErr(err)
+				}
+			}
+			if pp.opts.onOversizedNext != nil && pp.maxItems > 0 && len(items) > pp.maxItems {
+				pp.opts.onOversizedNext(len(items), pp.maxItems)
+			}
+			if pp.maxItems == 0 {
+				// Без буферизации: каждый результат Next — отдельный батч
+				var cookies []int
+				if pp.needsCommit(cookie) {
+					if !inTxn || lastCookie != cookie {
+						pp.stats.produce(cookie)
+						cookies = []int{cookie}
+					}
+					lastCookie, inTxn = cookie, true
+				}
+				if ok, err := pp.emit(stopCh, batch{buf: items, cookies: cookies}); !ok {
+					return wrapNextErr(err)
+				}
+				continue
+			}
+
+			if buf.len() > 0 && pp.opts.boundary != nil && pp.opts.boundary(buf.view(), items) {
+				var emitted []int
+				emitted, cookies = carryCookie(cookies, cookie)
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: emitted}); !ok {
+					return wrapNextErr(err)
+				}
+			}
+
+			if (buf.len() > 0 || len(cookies) > 0) && buf.len()+len(items) > pp.flushLimit() {
+				var emitted []int
+				emitted, cookies = carryCookie(cookies, cookie)
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: emitted}); !ok {
+					return wrapNextErr(err)
+				}
+			}
+			if buf.len() == 0 {
+				bufferedAt = pp.opts.clock.Now()
+			}
+			pp.merge(buf, items)
+			if pp.needsCommit(cookie) {
+				if !inTxn || lastCookie != cookie {
+					pp.stats.produce(cookie)
+					cookies = append(cookies, cookie)
+				}
+				lastCookie, inTxn = cookie, true
+			}
+
+			if flushTimer != nil && timerFired(flushTimer) {
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); !ok {
+					return wrapNextErr(err)
+				}
+				cookies = []int{}
+				flushTimer.Reset(pp.opts.flushInterval)
 			}
 
-			if len(buf)+len(items) > maxItems {
-				if ok := writeChanWithCancel(cancelCh, batchCh, batch{buf: buf, cookies: cookies}); !ok {
-					return nil
+			if pp.opts.partialFlushAfter > 0 && buf.len() > 0 && pp.opts.clock.Now().Sub(bufferedAt) >= pp.opts.partialFlushAfter {
+				// самый старый элемент ждёт слишком долго
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); !ok {
+					return wrapNextErr(err)
 				}
-				buf = make([]any, 0, maxItems)
 				cookies = []int{}
+			}
 
+			if buf.len() > 0 && pp.idle.consume() {
+				// обработка простаивает: не ждём заполнения буфера
+				if ok, err := pp.emit(stopCh, batch{buf: pp.takeBuffer(buf), cookies: cookies}); !ok {
+					return wrapNextErr(err)
+				}
+				cookies = []int{}
 			}
-			buf = append(buf, items...)
-			cookies = append(cookies, cookie)
 		}
 	}
 }
 
-func runProcess(cancelCh <-chan struct{}, c Consumer, batchCh <-chan batch, cookiesCh chan<- int) error {
-	defer close(cookiesCh)
+func (pp *pipe) runProcess(cancelCh <-chan struct{}) (err error) {
+	defer func() {
+		pp.markFailed(err)
+		if pp.cookiesCh != nil {
+			close(pp.cookiesCh)
+		}
+		pp.awaitCommits(err)
+	}()
+	cancelCh = pp.graceCh(cancelCh)
+	nextBatch := pp.batchReader(cancelCh)
+	flush := pp.newFlushGate()
+	defer flush.stop()
 	for {
-		batch, ok := readChanWithCancel(cancelCh, batchCh)
+		if len(pp.batchCh) == 0 {
+			pp.idle.notify()
+		}
+		batch, ok := nextBatch()
 		if !ok {
+			if flush == nil || isClosed(cancelCh) {
+				return nil
+			}
+			// поток закончился: после финального Flush придержанные cookie
+			// можно фиксировать
+			cookies, err := flush.flush()
+			if err != nil {
+				return err
+			}
+			_, err = pp.releaseCookies(cancelCh, nil, cookies)
+			return err
+		}
+		// слоты WithMaxUncommitted занимаются до обработки: батч,
+		// обработанный сверх лимита, уже нельзя было бы не считать
+		if ok, _ := pp.uncommitted.acquire(cancelCh, pp.opts.clock, len(batch.cookies), 0); !ok {
 			return nil
 		}
-		if err := c.Process(batch.buf); err != nil {
-			return fmt.Errorf("%w: %v", ErrProcessFailed, err)
+		pp.stats.processing(batch)
+		start := pp.opts.clock.Now()
+		var current *currentBatch
+		pp.processCtx, current = pp.ctrl.beginBatch(pp.ctx)
+		pp.enterStage(StageProcess)
+		err := pp.process(batch)
+		pp.leaveStage(StageProcess)
+		skipped := pp.ctrl.endBatch(current)
+		if pp.adaptive != nil {
+			pp.adaptive.observe(pp.opts.clock.Now().Sub(start))
 		}
-		for _, cookie := range batch.cookies {
-			if ok := writeChanWithCancel(cancelCh, cookiesCh, cookie); !ok {
-				return nil
+		pp.inflight.release(len(batch.buf))
+		if skipped {
+			// батч пропущен по запросу: ошибка отменённого потребителя не
+			// важна, а cookie не фиксируются
+			pp.stats.processed(batch.cookies)
+			pp.stats.skip(batch.cookies)
+			pp.uncommitted.release(len(batch.cookies))
+			pp.tracing.fail(batch.span, ErrBatchSkipped)
+			continue
+		}
+		filtered := errors.Is(err, errFiltered)
+		if err != nil && !filtered {
+			if !errors.Is(err, ErrProcessFailed) {
+				err = fmt.Errorf("%w: %w", ErrProcessFailed, err)
 			}
+			pp.tracing.fail(batch.span, err)
+			return err
+		}
+		pp.stats.processed(batch.cookies)
+		var cookies []int
+		if filtered {
+			cookies = pp.filteredCookies(batch)
+		} else {
+			cookies = pp.commitCookies(batch.cookies)
+		}
+		// слоты cookie, которые фиксироваться не будут, освобождаются сразу
+		pp.uncommitted.release(len(batch.cookies) - len(cookies))
+		if len(cookies) == 0 && (len(batch.cookies) == 0 || !pp.opts.offsetCommit) {
+			// фиксировать нечего: span батча завершается сразу после обработки.
+			// Покрытый прежним смещением батч закроет committedThrough.
+			pp.tracing.fail(batch.span, nil)
+		}
+		if flush != nil {
+			if cookies, err = flush.hold(cookies); err != nil {
+				return err
+			}
+		}
+		if ok, err := pp.releaseCookies(cancelCh, batch.span, cookies); !ok {
+			return err
 		}
 	}
 
 }
 
-func runCommit(cancelCh <-chan struct{}, p Producer, cookiesCh <-chan int) error {
+// releaseCookies передаёт cookie обработанных данных на фиксацию. Возвращает
+// false, если стадии нужно завершиться: из-за ошибки или отмены.
+func (pp *pipe) releaseCookies(cancelCh <-chan struct{}, span *tracedBatch, cookies []int) (bool, error) {
+	// в режиме CommitAtEnd намерение записывается только перед общей фиксацией
+	if pp.opts.commitMode != CommitAtEnd {
+		if err := pp.recordCommits(cookies); err != nil {
+			pp.tracing.fail(span, err)
+			return false, err
+		}
+	}
+	for _, cookie := range cookies {
+		if pp.inlineCommit() {
+			if err := pp.commit(cookie); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if ok := writeChanWithCancel(cancelCh, pp.cookiesCh, cookie); !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// process передаёт батч потребителю целиком или поэлементно. Батч без
+// элементов несёт только cookie: потребитель его не получает.
+func (pp *pipe) process(b batch) error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	if pp.opts.transform != nil {
+		items, err := pp.opts.transform(b.buf)
+		if err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+		if len(items) == 0 {
+			// всё отфильтровано: обрабатывать нечего, судьбу cookie решает
+			// стадия обработки
+			return errFiltered
+		}
+		b.buf = items
+	}
+	if pp.opts.groupKey != nil {
+		return skipBatch(pp.processGroups(b))
+	}
+	return skipBatch(pp.consumeSplitting(b))
+}
+
+// consume вызывает подходящий метод потребителя
+func (pp *pipe) consume(b batch) error {
+	b.buf = withHeadroom(b.buf, pp.opts.headroomItems)
+	return pp.withRetry(func() error { return pp.consumeOnce(b) })
+}
+
+// consumeOnce выполняет одну попытку обработки батча
+func (pp *pipe) consumeOnce(b batch) error {
+	if pp.opts.perBatchTimeout > 0 {
+		return pp.consumeWithDeadline(b)
+	}
+	if cc, ok := pp.c.(ContextConsumer); ok {
+		return cc.ProcessCtx(pp.batchContext(b), b.buf)
+	}
+	if ic, ok := pp.c.(ItemConsumer); ok {
+		return pp.processItems(ic, b)
+	}
+	return pp.c.Process(b.buf)
+}
+
+func (pp *pipe) runCommit(cancelCh <-chan struct{}) (err error) {
+	defer func() {
+		pp.markFailed(err)
+		close(pp.commitDone)
+	}()
+	cancelCh = pp.graceCh(cancelCh)
+	if pp.opts.commitMode == CommitAtEnd {
+		return pp.runCommitAtEnd(cancelCh)
+	}
+	if pp.opts.orderedCommit {
+		return pp.runCommitOrdered(cancelCh)
+	}
+	if pp.opts.commitDebounce > 0 {
+		return pp.runCommitDebounced(cancelCh)
+	}
+	if ac, ok := pp.p.(AsyncCommitter); ok && !pp.opts.dryRun {
+		return pp.runCommitAsync(ac, cancelCh)
+	}
+	if pp.opts.commitConcurrency > 1 && !pp.opts.offsetCommit {
+		return pp.runCommitConcurrent(cancelCh)
+	}
 	for {
-		cookie, ok := readChanWithCancel(cancelCh, cookiesCh)
+		// отмена важнее очереди: select выбрал бы между ними случайно
+		cookie, ok := 0, false
+		if !isClosed(cancelCh) {
+			cookie, ok = readChanWithCancel(cancelCh, pp.cookiesCh)
+		}
 		if !ok {
+			if pp.drainOnCancel() {
+				return pp.drainCommits()
+			}
+			return nil
+		}
+		if err := pp.commit(cookie); err != nil {
+			return err
+		}
+	}
+
+}
+
+// drainCommits фиксирует cookie, уже лежащие в канале на момент отмены:
+// их батчи обработаны, и без фиксации они были бы повторены
+func (pp *pipe) drainCommits() error {
+	for {
+		select {
+		case cookie, ok := <-pp.cookiesCh:
+			if !ok {
+				return nil
+			}
+			if err := pp.commit(cookie); err != nil {
+				return err
+			}
+		default:
 			return nil
 		}
-		if err := p.Commit(cookie); err != nil {
-			return fmt.Errorf("%w: %v", ErrCommitFailed, err)
+	}
+}
+
+// runCommitAtEnd копит cookie до конца потока и фиксирует их одним проходом,
+// только если предыдущие стадии завершились без ошибок, а поток не был
+// прерван отменой. Отменённый запуск фиксирует накопленное только при
+// FlushFirst или WithCommitDrain.
+func (pp *pipe) runCommitAtEnd(cancelCh <-chan struct{}) error {
+	var pending []int
+	for {
+		cookie, ok := readChanWithCancel(cancelCh, pp.cookiesCh)
+		if !ok {
+			break
+		}
+		pending = append(pending, cookie)
+	}
+	if pp.failed.Load() && (!pp.opts.atLeastOnce || pp.aborted()) {
+		return nil
+	}
+	if pp.cancelled(cancelCh) && pp.opts.shutdown != FlushFirst && !pp.drainOnCancel() {
+		return nil
+	}
+	if pp.opts.offsetCommit && len(pending) > 0 {
+		pending = []int{slices.Max(pending)}
+	}
+	if err := pp.recordCommits(pending); err != nil {
+		return err
+	}
+	for _, cookie := range pending {
+		if err := pp.commit(cookie); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+func (pp *pipe) commit(cookie int) error {
+	if pp.opts.dryRun {
+		return pp.committed(cookie)
+	}
+	pp.enterStage(StageCommit)
+	err := pp.withRetry(func() error { return pp.p.Commit(cookie) })
+	pp.leaveStage(StageCommit)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrCommitFailed, err)
+		pp.tracing.commitFailed(cookie, err)
+		return err
+	}
+	return pp.committed(cookie)
+}
+
+// committed учитывает успешно зафиксированный cookie: подтверждает его в
+// журнале, статистике и трассировке
+func (pp *pipe) committed(cookie int) error {
+	if err := pp.ackCommit(cookie); err != nil {
+		pp.tracing.commitFailed(cookie, err)
+		return err
+	}
+	if pp.opts.offsetCommit {
+		pp.stats.commitThrough(cookie)
+		pp.tracing.committedThrough(cookie)
+		pp.ctrl.commits.commitThrough(cookie)
+	} else {
+		pp.stats.commit(cookie)
+		pp.tracing.committed(cookie)
+		pp.ctrl.commits.commit(cookie)
+	}
+	pp.uncommitted.release(1)
+	return nil
+}
+
+// commitCookies возвращает cookie батча, которые нужно зафиксировать. В
+// режиме смещений это только максимальный cookie, и лишь если он больше уже
+// отправленного на фиксацию: он подтверждает все меньшие.
+func (pp *pipe) commitCookies(cookies []int) []int {
+	if !pp.opts.offsetCommit || len(cookies) == 0 || pp.opts.commitMode == CommitAtEnd {
+		return cookies
+	}
+	high := slices.Max(cookies)
+	if pp.offsetSent && high <= pp.offsetHigh {
+		return nil
+	}
+	pp.offsetSent, pp.offsetHigh = true, high
+	return []int{high}
+}
+
+// markFailed запоминает, что стадия завершилась с ошибкой
+func (pp *pipe) markFailed(err error) {
+	if err != nil {
+		pp.failed.Store(true)
+		pp.shutdown.failOnce.Do(func() { close(pp.shutdown.failedCh) })
+	}
+}
+
+// timerFired неблокирующе проверяет, сработал ли таймер
+func timerFired(t Timer) bool {
+	select {
+	case <-t.C():
+		return true
+	default:
+		return false
+	}
+}
+
+// isClosed неблокирующе проверяет, закрыт ли канал отмены
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// wrapNextErr оборачивает ошибку стадии Next, пропуская nil (штатная отмена)
+func wrapNextErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrNextFailed, err)
 }
 
 func readChanWithCancel[T any](cancelCh <-chan struct{}, dataCh <-chan T) (T, bool) {
@@ -218,3 +1074,8 @@ func writeChanWithCancel[T any](cancelCh <-chan struct{}, dataCh chan<- T, value
 		return true
 	}
 }
+
+// isEOF сообщает о конце данных: io.EOF удобен источникам поверх io.Reader
+func isEOF(err error) bool {
+	return errors.Is(err, ErrEofCommitCookie) || errors.Is(err, io.EOF)
+}
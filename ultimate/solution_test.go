@@ -2,8 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -381,3 +387,227 @@ func TestPipe_GracefulShutdownMultipleStageErrors(t *testing.T) {
 	producer.AssertExpectations(t)
 	consumer.AssertExpectations(t)
 }
+
+func TestPipe_ZeroMaxItemsFlushesEveryNext(t *testing.T) {
+	for _, maxItems := range []int{0, -1} {
+		producer := &MockProducer{}
+		consumer := &MockConsumer{}
+
+		batches := [][]any{{"item1", "item2"}, {"item3"}, {"item4", "item5", "item6"}}
+		for i, b := range batches {
+			producer.On("Next").Return(b, i+1, nil).Once()
+			// Каждый результат Next — отдельные Process и Commit
+			consumer.On("Process", b).Return(nil).Once()
+			producer.On("Commit", i+1).Return(nil).Once()
+		}
+		producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+		err := Pipe(producer, consumer, maxItems)
+		require.NoError(t, err)
+
+		producer.AssertExpectations(t)
+		consumer.AssertExpectations(t)
+	}
+}
+
+func TestPipe_InvalidArguments(t *testing.T) {
+	tests := []struct {
+		name     string
+		producer Producer
+		consumer Consumer
+		maxItems int
+		param    string
+	}{
+		{name: "nil producer", consumer: &MockConsumer{}, maxItems: 1, param: "producer"},
+		{name: "nil consumer", producer: &MockProducer{}, maxItems: 1, param: "consumer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Pipe(tt.producer, tt.consumer, tt.maxItems)
+			require.ErrorIs(t, err, ErrInvalidArgument)
+			require.Contains(t, err.Error(), tt.param)
+		})
+	}
+}
+
+func TestPipe_DuplicateCookieCommittedOnce(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Одна транзакция с cookie 5 разбита на два вызова Next
+	producer.On("Next").Return([]any{"a"}, 5, nil).Once()
+	producer.On("Next").Return([]any{"b"}, 5, nil).Once()
+	producer.On("Next").Return([]any{"c"}, 6, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+
+	consumer.On("Process", []any{"a", "b", "c"}).Return(nil).Once()
+	producer.On("Commit", 5).Return(nil).Once()
+	producer.On("Commit", 6).Return(nil).Once()
+
+	stats, err := PipeWithStats(producer, consumer, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int{5, 6}, stats.CommittedCookies)
+	require.Empty(t, stats.UncommittedCookies)
+	require.Empty(t, stats.UnprocessedCookies)
+
+	producer.AssertExpectations(t)
+	producer.AssertNumberOfCalls(t, "Commit", 2)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_DuplicateCookieAcrossBatches(t *testing.T) {
+	// транзакция 5 не помещается в один батч
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{"a"}, Cookie: 4},
+		pipetest.Step{Items: []any{"b"}, Cookie: 5},
+		pipetest.Step{Items: []any{"c"}, Cookie: 5},
+		pipetest.Step{Items: []any{"d"}, Cookie: 6},
+	)
+	var processed atomic.Int32
+	var processedAtCommit sync.Map
+	consumer := ConsumerFunc(func(items []any) error {
+		processed.Add(int32(len(items)))
+		return nil
+	})
+
+	err := Pipe(&commitProbe{Producer: producer, onCommit: func(cookie int) {
+		processedAtCommit.Store(cookie, processed.Load())
+	}}, consumer, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 5, 6}, producer.Committed())
+	// cookie 5 фиксируется один раз и только после элемента c
+	n, _ := processedAtCommit.Load(5)
+	require.GreaterOrEqual(t, n, int32(3))
+}
+
+// commitProbe вызывает onCommit перед каждым Commit
+type commitProbe struct {
+	Producer
+	onCommit func(cookie int)
+}
+
+func (p *commitProbe) Commit(cookie int) error {
+	p.onCommit(cookie)
+	return p.Producer.Commit(cookie)
+}
+
+func TestPipe_MemoryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for maxItems := 1; maxItems <= 20; maxItems++ {
+		t.Run(fmt.Sprintf("maxItems=%d", maxItems), func(t *testing.T) {
+			source := pipetest.NewRandomMemorySource(ErrEofCommitCookie, rng, 100, maxItems)
+			sink := &pipetest.MemorySink{}
+
+			err := Pipe(source, sink, maxItems)
+			require.NoError(t, err)
+			pipetest.AssertRoundTrip(t, source, sink, maxItems)
+		})
+	}
+}
+
+func TestPipe_IOEOFFlushesBuffer(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Источник поверх io.Reader сообщает о конце данных через io.EOF
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, io.EOF).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipe_EOFWithItems(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок данных приходит вместе с EOF
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 10)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+
+	t.Run("MultiProducer", func(t *testing.T) {
+		first := &MockProducer{}
+		second := &MockProducer{}
+		consumer := &MockConsumer{}
+
+		// исчерпанный источник не теряет элементы, пришедшие с его EOF
+		first.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+		second.On("Next").Return([]any{"b1"}, 1, nil).Once()
+		second.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+		consumer.On("Process", []any{"last", "b1"}).Return(nil).Once()
+		first.On("Commit", 9).Return(nil).Once()
+		second.On("Commit", 1).Return(nil).Once()
+
+		err := Pipe(NewMultiProducer(first, second), consumer, 10)
+		require.NoError(t, err)
+
+		first.AssertExpectations(t)
+		second.AssertExpectations(t)
+		consumer.AssertExpectations(t)
+	})
+
+	t.Run("PipeBytes", func(t *testing.T) {
+		producer := &eofBytesProducer{}
+		consumer := &bytesRecorder{}
+
+		err := PipeBytes(producer, consumer, 10)
+		require.NoError(t, err)
+		require.Equal(t, []int{len("item1") + len("last")}, consumer.sizes)
+		require.Equal(t, []int{1, 9}, producer.committed)
+	})
+}
+
+// eofBytesProducer отдаёт последний фрагмент вместе с EOF
+type eofBytesProducer struct {
+	n         int
+	committed []int
+}
+
+func (p *eofBytesProducer) Next() ([][]byte, int, error) {
+	p.n++
+	if p.n == 1 {
+		return [][]byte{[]byte("item1")}, 1, nil
+	}
+	return [][]byte{[]byte("last")}, 9, ErrEofCommitCookie
+}
+
+func (p *eofBytesProducer) Commit(cookie int) error {
+	p.committed = append(p.committed, cookie)
+	return nil
+}
+
+func TestPipe_EOFWithItemsOverflow(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+
+	// Последний кусок не помещается в буфер и уходит отдельным батчем
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"last"}, 9, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"last"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 9).Return(nil).Once()
+
+	err := Pipe(producer, consumer, 2)
+	require.NoError(t, err)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
@@ -0,0 +1,29 @@
+package main
+
+import "errors"
+
+// ErrBatchTooLarge возвращается из Process, если батч слишком велик для
+// получателя. Pipe делит такой батч пополам и повторяет обработку каждой
+// половины, вплоть до отдельных элементов.
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// consumeSplitting обрабатывает батч, деля его при ErrBatchTooLarge.
+// Элемент, отвергнутый и поодиночке, завершает обработку ошибкой.
+//
+// Cookie привязаны к вызовам Next, а не к элементам, и результат одного Next
+// может оказаться по обе стороны разреза. Поэтому cookie батча фиксируются,
+// только если успешно обработаны все его части; при ошибке в любой части
+// батч целиком остаётся незафиксированным и будет повторён. Часть,
+// пропущенная через ErrSkip, не мешает обработке остальных.
+func (pp *pipe) consumeSplitting(b batch) error {
+	err := pp.consume(b)
+	if !errors.Is(err, ErrBatchTooLarge) || len(b.buf) <= 1 {
+		return err
+	}
+	mid := len(b.buf) / 2
+	// ограничиваем ёмкость, чтобы append потребителя не затёр вторую половину
+	halves := [2]batch{batchPart(b, 0, b.buf[:mid:mid]), batchPart(b, 1, b.buf[mid:])}
+	return consumeParts(len(halves), func(i int) error {
+		return pp.consumeSplitting(halves[i])
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// rejectLarger отвергает батчи длиннее limit
+func rejectLarger(limit int) func(items []any) error {
+	return func(items []any) error {
+		if len(items) > limit {
+			return fmt.Errorf("payload of %d items: %w", len(items), ErrBatchTooLarge)
+		}
+		return nil
+	}
+}
+
+func TestPipe_BatchTooLargeSplits(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5}, 2, 3)
+	sink := &pipetest.MemorySink{RecordingConsumer: pipetest.RecordingConsumer{Fail: rejectLarger(2)}}
+
+	err := Pipe(source, sink, 5)
+	require.NoError(t, err)
+
+	// 5 → 2 + 3, а 3 → 1 + 2
+	require.Equal(t, [][]any{{1, 2}, {3}, {4, 5}}, sink.Batches())
+	require.Equal(t, []int{1, 2}, source.Committed())
+}
+
+func TestPipe_BatchTooLargeSingleItem(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 3)
+	sink := &pipetest.MemorySink{RecordingConsumer: pipetest.RecordingConsumer{Fail: rejectLarger(0)}}
+
+	stats, err := PipeWithStats(source, sink, 3)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorIs(t, err, ErrBatchTooLarge)
+	require.Empty(t, source.Committed())
+	require.Empty(t, stats.UncommittedCookies)
+	require.Equal(t, []int{1}, stats.UnprocessedCookies)
+}
+
+func TestPipe_BatchTooLargePartialFailure(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4}, 2, 2)
+	// Первая половина проходит, во второй отвергается элемент 4
+	fail := func(items []any) error {
+		if len(items) > 2 {
+			return ErrBatchTooLarge
+		}
+		for _, item := range items {
+			if item == 4 {
+				return ErrBatchTooLarge
+			}
+		}
+		return nil
+	}
+	sink := &pipetest.MemorySink{RecordingConsumer: pipetest.RecordingConsumer{Fail: fail}}
+
+	err := Pipe(source, sink, 4)
+	require.ErrorIs(t, err, ErrBatchTooLarge)
+	// cookie батча не фиксируются, пока не обработаны все его части
+	require.Empty(t, source.Committed())
+	require.Equal(t, [][]any{{1, 2}, {3}}, sink.Batches())
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SQLTxBeginner — часть *sql.DB, нужная SQLConsumer
+type SQLTxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// SQLConsumer записывает батч в таблицу многострочным upsert внутри одной
+// транзакции. Process возвращается только после Commit транзакции, поэтому
+// cookie батча фиксируются, лишь когда строки надёжно сохранены; при ошибке
+// транзакция откатывается, и pipeline останавливается с ErrProcessFailed.
+//
+// По умолчанию используется синтаксис PostgreSQL: плейсхолдеры $1, $2, ...
+// и INSERT ... ON CONFLICT (...) DO UPDATE. Имена таблицы и колонок
+// подставляются в запрос как есть и должны быть доверенными.
+type SQLConsumer struct {
+	// Placeholder возвращает плейсхолдер n-го параметра, начиная с 1;
+	// по умолчанию $n. Для MySQL и SQLite подходит func(int) string { return "?" }.
+	Placeholder func(n int) string
+	// MaxRowsPerStatement ограничивает число строк в одном INSERT, чтобы не
+	// упереться в лимит параметров драйвера; 0 — весь батч одним запросом.
+	// Все запросы батча выполняются в одной транзакции.
+	MaxRowsPerStatement int
+
+	db       SQLTxBeginner
+	table    string
+	columns  []string
+	conflict []string
+	mapRow   func(item any) ([]any, error)
+}
+
+// NewSQLConsumer создаёт потребителя, вставляющего в table по строке на
+// элемент. mapRow возвращает значения колонок columns в том же порядке.
+// conflict — колонки уникального ключа: при совпадении ключа остальные
+// колонки обновляются; пустой conflict означает обычный INSERT. Строки батча
+// с одинаковым ключом схлопываются в последнюю: ON CONFLICT не может дважды
+// обновить одну строку в одном запросе.
+func NewSQLConsumer(db SQLTxBeginner, table string, columns, conflict []string, mapRow func(item any) ([]any, error)) *SQLConsumer {
+	return &SQLConsumer{db: db, table: table, columns: columns, conflict: conflict, mapRow: mapRow}
+}
+
+func (c *SQLConsumer) Process(items []any) error {
+	return c.ProcessCtx(context.Background(), items)
+}
+
+// ProcessCtx выполняет upsert батча; отмена ctx откатывает транзакцию
+func (c *SQLConsumer) ProcessCtx(ctx context.Context, items []any) (err error) {
+	rows := make([][]any, 0, len(items))
+	for i, item := range items {
+		row, err := c.mapRow(item)
+		if err != nil {
+			return fmt.Errorf("map item %d: %w", i, err)
+		}
+		if len(row) != len(c.columns) {
+			return fmt.Errorf("map item %d: %d values for %d columns", i, len(row), len(c.columns))
+		}
+		rows = append(rows, row)
+	}
+	rows = c.dedupe(rows)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	step := c.MaxRowsPerStatement
+	if step <= 0 {
+		step = len(rows)
+	}
+	for start := 0; start < len(rows); start += step {
+		chunk := rows[start:min(start+step, len(rows))]
+		query, args := c.upsert(chunk)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("upsert into %s: %w", c.table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// dedupe оставляет для каждого ключа conflict последнюю строку на месте
+// первого её вхождения
+func (c *SQLConsumer) dedupe(rows [][]any) [][]any {
+	if len(c.conflict) == 0 {
+		return rows
+	}
+	var keyCols []int
+	for i, col := range c.columns {
+		if slices.Contains(c.conflict, col) {
+			keyCols = append(keyCols, i)
+		}
+	}
+	seen := make(map[string]int, len(rows))
+	out := rows[:0]
+	for _, row := range rows {
+		key := make([]any, len(keyCols))
+		for i, col := range keyCols {
+			key[i] = row[col]
+		}
+		k := fmt.Sprintf("%#v", key)
+		if i, ok := seen[k]; ok {
+			out[i] = row
+			continue
+		}
+		seen[k] = len(out)
+		out = append(out, row)
+	}
+	return out
+}
+
+// upsert строит многострочный INSERT для rows и его аргументы
+func (c *SQLConsumer) upsert(rows [][]any) (string, []any) {
+	placeholder := c.Placeholder
+	if placeholder == nil {
+		placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+
+	var q strings.Builder
+	fmt.Fprintf(&q, "INSERT INTO %s (%s) VALUES ", c.table, strings.Join(c.columns, ", "))
+	args := make([]any, 0, len(rows)*len(c.columns))
+	for i, row := range rows {
+		if i > 0 {
+			q.WriteString(", ")
+		}
+		q.WriteByte('(')
+		for j, v := range row {
+			if j > 0 {
+				q.WriteString(", ")
+			}
+			args = append(args, v)
+			q.WriteString(placeholder(len(args)))
+		}
+		q.WriteByte(')')
+	}
+
+	if len(c.conflict) == 0 {
+		return q.String(), args
+	}
+	fmt.Fprintf(&q, " ON CONFLICT (%s) ", strings.Join(c.conflict, ", "))
+	var updates []string
+	for _, col := range c.columns {
+		if !slices.Contains(c.conflict, col) {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+		}
+	}
+	if len(updates) == 0 {
+		q.WriteString("DO NOTHING")
+	} else {
+		q.WriteString("DO UPDATE SET " + strings.Join(updates, ", "))
+	}
+	return q.String(), args
+}
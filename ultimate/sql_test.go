@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+type userRow struct {
+	id   int
+	name string
+}
+
+func mapUser(item any) ([]any, error) {
+	u := item.(userRow)
+	return []any{u.id, u.name}, nil
+}
+
+const userUpsert = "INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name"
+
+// orderedCommitter проверяет, что к моменту Commit cookie транзакция его
+// батча уже зафиксирована в базе
+type orderedCommitter struct {
+	pipetest.RecordingCommitter
+	mock sqlmock.Sqlmock
+	t    *testing.T
+}
+
+func (c *orderedCommitter) Commit(cookie int) error {
+	require.NoError(c.t, c.mock.ExpectationsWereMet())
+	return c.RecordingCommitter.Commit(cookie)
+}
+
+func TestSQLConsumer_BatchedUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(userUpsert)).
+		WithArgs(1, "ann", 2, "bob").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	source := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{userRow{1, "ann"}}, Cookie: 10},
+		pipetest.Step{Items: []any{userRow{2, "bob"}}, Cookie: 11},
+	)
+	producer := &struct {
+		*pipetest.ScriptedProducer
+		*orderedCommitter
+	}{source, &orderedCommitter{mock: mock, t: t}}
+	consumer := NewSQLConsumer(db, "users", []string{"id", "name"}, []string{"id"}, mapUser)
+
+	require.NoError(t, Pipe(producer, consumer, 10))
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Equal(t, []int{10, 11}, producer.orderedCommitter.Committed())
+}
+
+func TestSQLConsumer_RollbackStopsPipeline(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(userUpsert)).WillReturnError(errors.New("deadlock"))
+	mock.ExpectRollback()
+
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{userRow{1, "ann"}, userRow{2, "bob"}}, Cookie: 1},
+	)
+	consumer := NewSQLConsumer(db, "users", []string{"id", "name"}, []string{"id"}, mapUser)
+
+	err = Pipe(producer, consumer, 10)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.ErrorContains(t, err, "deadlock")
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Empty(t, producer.Committed())
+}
+
+func TestSQLConsumer_ChunkedStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name) VALUES (?, ?), (?, ?)")).
+		WithArgs(1, "ann", 2, "bob").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name) VALUES (?, ?)")).
+		WithArgs(3, "cid").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	consumer := NewSQLConsumer(db, "users", []string{"id", "name"}, nil, mapUser)
+	consumer.Placeholder = func(int) string { return "?" }
+	consumer.MaxRowsPerStatement = 2
+
+	require.NoError(t, consumer.Process([]any{userRow{1, "ann"}, userRow{2, "bob"}, userRow{3, "cid"}}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLConsumer_DuplicateKeysKeepLast(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(userUpsert)).
+		WithArgs(1, "ann2", 2, "bob").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	consumer := NewSQLConsumer(db, "users", []string{"id", "name"}, []string{"id"}, mapUser)
+	require.NoError(t, consumer.Process([]any{userRow{1, "ann"}, userRow{2, "bob"}, userRow{1, "ann2"}}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrStalled — pipeline дольше StallTimeout не продвигался и был остановлен
+var ErrStalled = errors.New("pipeline stalled")
+
+// Названия стадий, которые сообщает детектор зависаний
+const (
+	StageNext    = "next"
+	StageProcess = "process"
+	StageCommit  = "commit"
+	// StagePipeline — прогресса нет, но ни одна стадия не ждёт вызова
+	// источника или потребителя: все стоят на каналах
+	StagePipeline = "pipeline"
+)
+
+// stallCall — вызовы Next, Process или Commit одной стадии, ещё не вернувшиеся
+type stallCall struct {
+	count int
+	since time.Time
+}
+
+// stallWatch отслеживает прогресс стадий: время последнего завершённого
+// вызова и вызовы, которые идут прямо сейчас
+type stallWatch struct {
+	clock Clock
+
+	mu   sync.Mutex
+	last time.Time
+	busy map[string]*stallCall
+}
+
+func newStallWatch(timeout time.Duration, clock Clock) *stallWatch {
+	if timeout <= 0 {
+		return nil
+	}
+	return &stallWatch{clock: clock, last: clock.Now(), busy: map[string]*stallCall{}}
+}
+
+// enter отмечает начало вызова в стадии
+func (w *stallWatch) enter(stage string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	call, ok := w.busy[stage]
+	if !ok {
+		call = &stallCall{since: w.clock.Now()}
+		w.busy[stage] = call
+	}
+	call.count++
+}
+
+// leave отмечает завершение вызова — это и есть прогресс
+func (w *stallWatch) leave(stage string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = w.clock.Now()
+	if call, ok := w.busy[stage]; ok {
+		if call.count--; call.count == 0 {
+			delete(w.busy, stage)
+		}
+	}
+}
+
+// blocked возвращает стадию, из-за которой нет прогресса дольше timeout:
+// ту, чей незавершённый вызов начался раньше всех
+func (w *stallWatch) blocked(timeout time.Duration) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.clock.Now()
+	if now.Sub(w.last) < timeout {
+		return "", false
+	}
+	stage, since := StagePipeline, now
+	for s, call := range w.busy {
+		if call.since.Before(since) {
+			stage, since = s, call.since
+		}
+	}
+	return stage, true
+}
+
+// watchStalls проверяет прогресс, пока не закрыт done. О каждом зависании
+// OnStall узнаёт один раз; при WithAbortOnStall первое зависание отменяет
+// запуск через cancel и возвращается как ошибка.
+func (pp *pipe) watchStalls(done <-chan struct{}, cancel context.CancelFunc) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		timeout := pp.opts.stallTimeout
+		reported := false
+		for {
+			timer := pp.opts.clock.NewTimer(max(timeout/4, time.Millisecond))
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			if _, paused := pp.ctrl.paused(); paused {
+				// на паузе отсутствие прогресса ожидаемо
+				continue
+			}
+			stage, stalled := pp.stall.blocked(timeout)
+			if !stalled {
+				reported = false
+				continue
+			}
+			if reported {
+				continue
+			}
+			reported = true
+			if pp.opts.onStall != nil {
+				pp.opts.onStall(stage)
+			}
+			if pp.opts.abortOnStall {
+				errCh <- fmt.Errorf("%w: %s stage made no progress for %v", ErrStalled, stage, timeout)
+				cancel()
+				return
+			}
+		}
+	}()
+	return errCh
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// stuckConsumer зависает в Process, пока не закрыт release, или, при
+// вызове через ProcessCtx, до отмены контекста
+type stuckConsumer struct {
+	release chan struct{}
+}
+
+func (c *stuckConsumer) Process(items []any) error {
+	<-c.release
+	return nil
+}
+
+func (c *stuckConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	select {
+	case <-c.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestPipe_StallReportsBlockedStage(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	consumer := &stuckConsumer{release: make(chan struct{})}
+
+	var mu sync.Mutex
+	var stalls []string
+	onStall := func(stage string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stalls = append(stalls, stage)
+		if len(stalls) == 1 {
+			// диагностика получена, отпускаем потребителя
+			close(consumer.release)
+		}
+	}
+
+	err := Pipe(producer, ConsumerFunc(consumer.Process), 1, WithStallTimeout(20*time.Millisecond, onStall))
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{StageProcess}, stalls)
+	require.Equal(t, []int{1, 2}, producer.Committed())
+}
+
+func TestPipe_AbortOnStall(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	consumer := &stuckConsumer{release: make(chan struct{})}
+
+	var stalled []string
+	err := Pipe(producer, consumer, 1,
+		WithStallTimeout(20*time.Millisecond, func(stage string) { stalled = append(stalled, stage) }),
+		WithAbortOnStall())
+	require.ErrorIs(t, err, ErrStalled)
+	require.ErrorContains(t, err, "process stage")
+	require.Equal(t, []string{StageProcess}, stalled)
+	require.Empty(t, producer.Committed())
+}
+
+func TestPipe_StallNotReportedWhileProgressing(t *testing.T) {
+	producer := pipetest.NewCountingProducer(ErrEofCommitCookie, 50, 1)
+	consumer := ConsumerFunc(func(items []any) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	stalled := false
+	err := Pipe(producer, consumer, 1,
+		WithStallTimeout(200*time.Millisecond, func(string) { stalled = true }),
+		WithAbortOnStall())
+	require.NoError(t, err)
+	require.False(t, stalled)
+}
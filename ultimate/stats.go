@@ -0,0 +1,160 @@
+package main
+
+import "sync"
+
+// PipeStats — итоговая статистика запуска Pipe
+type PipeStats struct {
+	// Batches — сколько батчей передано в Process
+	Batches int
+	// Items — сколько элементов передано в Process
+	Items int
+	// Commits — сколько cookie успешно зафиксировано
+	Commits int
+	// CommittedCookies — зафиксированные cookie: эти данные сохранены
+	// надёжно, и после перезапуска источник продолжит после них
+	CommittedCookies []int
+	// UncommittedCookies — cookie успешно обработанных батчей, чей Commit
+	// так и не завершился успешно, в порядке их обработки
+	UncommittedCookies []int
+	// UnprocessedCookies — cookie, полученные от источника, но так и не
+	// обработанные успешно: не переданные в Process или из упавшего батча
+	UnprocessedCookies []int
+	// SkippedBatches — сколько батчей пропущено через
+	// Controller.SkipCurrentBatch
+	SkippedBatches int
+	// SkippedCookies — cookie пропущенных батчей: они не фиксировались и
+	// не входят в UncommittedCookies
+	SkippedCookies []int
+	// FinalBatchPartial — последний переданный в Process батч содержал
+	// меньше maxItems элементов. При maxItems == 0 всегда false.
+	FinalBatchPartial bool
+}
+
+// statsCollector накапливает статистику из разных стадий
+type statsCollector struct {
+	mu        sync.Mutex
+	maxItems  int
+	batches   int
+	items     int
+	lastSize  int   // размер последнего батча, переданного в Process
+	produced  []int // cookie в порядке выдачи источником
+	handed    []int // cookie обработанных батчей в порядке обработки
+	committed []int // при последовательной фиксации это префикс handed
+	skipped   []int // cookie пропущенных батчей
+	skips     int
+}
+
+func (s *statsCollector) produce(cookie int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.produced = append(s.produced, cookie)
+}
+
+func (s *statsCollector) processing(b batch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	s.items += len(b.buf)
+	s.lastSize = len(b.buf)
+}
+
+// processed отмечает cookie батча, обработка которого завершилась: успешно
+// или пропуском. Cookie упавшего батча остаются необработанными.
+func (s *statsCollector) processed(cookies []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handed = append(s.handed, cookies...)
+}
+
+// skip отмечает батч с cookies пропущенным
+func (s *statsCollector) skip(cookies []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skips++
+	s.skipped = append(s.skipped, cookies...)
+}
+
+func (s *statsCollector) commit(cookie int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = append(s.committed, cookie)
+}
+
+// commitThrough отмечает зафиксированными все переданные в Process cookie
+// вплоть до cookie включительно: в режиме смещений он подтверждает их все
+func (s *statsCollector) commitThrough(cookie int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.committed); i < len(s.handed); i++ {
+		if s.handed[i] == cookie {
+			s.committed = append(s.committed, s.handed[len(s.committed):i+1]...)
+			return
+		}
+	}
+}
+
+// lastCommitted возвращает последний зафиксированный cookie
+func (s *statsCollector) lastCommitted() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.committed) == 0 {
+		return 0, false
+	}
+	return s.committed[len(s.committed)-1], true
+}
+
+func (s *statsCollector) snapshot() PipeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := PipeStats{
+		Batches: s.batches,
+		Items:   s.items,
+		Commits: len(s.committed),
+
+		FinalBatchPartial: s.batches > 0 && s.lastSize < s.maxItems,
+	}
+	if len(s.committed) > 0 {
+		st.CommittedCookies = append([]int(nil), s.committed...)
+	}
+	if len(s.committed)+len(s.skipped) < len(s.handed) {
+		st.UncommittedCookies = s.uncommittedLocked()
+	}
+	st.SkippedBatches = s.skips
+	if len(s.skipped) > 0 {
+		st.SkippedCookies = append([]int(nil), s.skipped...)
+	}
+	if len(s.handed) < len(s.produced) {
+		// при LIFO батчи передаются не в порядке выдачи, поэтому handed —
+		// не префикс produced
+		st.UnprocessedCookies = subtractCookies(s.produced, s.handed)
+	}
+	return st
+}
+
+// uncommittedLocked возвращает переданные в Process, но не зафиксированные
+// cookie в порядке handed. При параллельной фиксации committed уже не
+// префикс handed, поэтому вычитаются вхождения, а не длина. Cookie
+// пропущенных батчей вычитаются так же.
+func (s *statsCollector) uncommittedLocked() []int {
+	return subtractCookies(s.handed, s.committed, s.skipped)
+}
+
+// subtractCookies возвращает cookies без вхождений из excluded с учётом
+// кратности, сохраняя порядок cookies
+func subtractCookies(cookies []int, excluded ...[]int) []int {
+	done := make(map[int]int)
+	for _, list := range excluded {
+		for _, cookie := range list {
+			done[cookie]++
+		}
+	}
+	var rest []int
+	for _, cookie := range cookies {
+		if done[cookie] > 0 {
+			done[cookie]--
+			continue
+		}
+		rest = append(rest, cookie)
+	}
+	return rest
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeWithStats_HappyPath(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 2
+
+	producer.On("Next").Return([]any{"item1", "item2"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2"}).Return(nil).Once()
+	consumer.On("Process", []any{"item3"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once()
+	producer.On("Commit", 2).Return(nil).Once()
+
+	stats, err := PipeWithStats(producer, consumer, maxItems)
+	require.NoError(t, err)
+	require.Equal(t, PipeStats{Batches: 2, Items: 3, Commits: 2, CommittedCookies: []int{1, 2}, FinalBatchPartial: true}, stats)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeWithStats_UncommittedCookiesOnCommitError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 5
+
+	// Все три пакета попадают в один батч
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", []any{"item1", "item2", "item3"}).Return(nil).Once()
+
+	// Первый коммит успешен, второй падает
+	producer.On("Commit", 1).Return(nil).Once()
+	commitErr := errors.New("commit error")
+	producer.On("Commit", 2).Return(commitErr).Once()
+
+	stats, err := PipeWithStats(producer, consumer, maxItems)
+	require.ErrorIs(t, err, ErrCommitFailed)
+	require.Equal(t, 1, stats.Commits)
+	require.Equal(t, []int{2, 3}, stats.UncommittedCookies)
+
+	producer.AssertExpectations(t)
+	producer.AssertNotCalled(t, "Commit", 3)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeWithStats_CommittedSurvivesLaterProcessFailure(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	maxItems := 1
+
+	producer.On("Next").Return([]any{"item1"}, 1, nil).Once()
+	producer.On("Next").Return([]any{"item2"}, 2, nil).Once()
+	producer.On("Next").Return([]any{"item3"}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Maybe()
+
+	// Батч 1 обработан и зафиксирован, батч 2 падает в Process
+	committed := make(chan struct{})
+	consumer.On("Process", []any{"item1"}).Return(nil).Once()
+	producer.On("Commit", 1).Return(nil).Once().Run(func(mock.Arguments) { close(committed) })
+	consumer.On("Process", []any{"item2"}).Return(errors.New("consumer error")).Once().
+		Run(func(mock.Arguments) { <-committed })
+
+	stats, err := PipeWithStats(producer, consumer, maxItems)
+	require.ErrorIs(t, err, ErrProcessFailed)
+	require.Equal(t, []int{1}, stats.CommittedCookies)
+	// батч 2 упал в Process: его cookie не обработаны, а не ждут фиксации
+	require.Empty(t, stats.UncommittedCookies)
+	require.Equal(t, 2, stats.UnprocessedCookies[0])
+	// Батч 3 мог быть прочитан до отмены, но в Process не попал
+	require.Subset(t, []int{2, 3}, stats.UnprocessedCookies)
+
+	producer.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
+
+func TestPipeWithStats_FinalBatchPartial(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		partial bool
+	}{
+		{name: "not a multiple of maxItems", total: 7, partial: true},
+		{name: "multiple of maxItems", total: 6, partial: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]any, tt.total)
+			steps := make([]int, tt.total)
+			for i := range steps {
+				steps[i] = 1
+			}
+			producer := pipetest.NewMemorySource(ErrEofCommitCookie, items, steps...)
+			consumer := &pipetest.MemorySink{}
+
+			stats, err := PipeWithStats(producer, consumer, 3)
+			require.NoError(t, err)
+			require.Equal(t, tt.partial, stats.FinalBatchPartial)
+		})
+	}
+}
+
+func TestPipe_OnStatsTick(t *testing.T) {
+	clock := newFakeClock()
+	producer := &endlessProducer{}
+	ticks := make(chan PipeStats, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(producer, ConsumerFunc(func([]any) error { return nil }), 1,
+			WithClock(clock), WithOnStatsTick(time.Second, func(s PipeStats) { ticks <- s }))
+	}()
+
+	var snapshots []PipeStats
+	for i := 0; i < 3; i++ {
+		// ждём, пока тикер заведёт таймер, и даём pipeline поработать
+		require.Eventually(t, func() bool { return clock.activeTimers() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		clock.Advance(time.Second)
+		snapshots = append(snapshots, <-ticks)
+	}
+	producer.eof.Store(true)
+	require.NoError(t, <-done)
+
+	for i := 1; i < len(snapshots); i++ {
+		require.GreaterOrEqual(t, snapshots[i].Items, snapshots[i-1].Items)
+		require.GreaterOrEqual(t, snapshots[i].Commits, snapshots[i-1].Commits)
+	}
+	require.Greater(t, snapshots[2].Items, 0)
+}
@@ -0,0 +1,25 @@
+package main
+
+// tickStats раз в statsTickInterval передаёт снимок статистики в
+// onStatsTick, пока не закрыт done. Возвращённый канал закрывается после
+// последнего вызова хука; nil, если хук не задан.
+func (pp *pipe) tickStats(done <-chan struct{}) <-chan struct{} {
+	if pp.opts.onStatsTick == nil || pp.opts.statsTickInterval <= 0 {
+		return nil
+	}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			timer := pp.opts.clock.NewTimer(pp.opts.statsTickInterval)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			pp.opts.onStatsTick(pp.stats.snapshot())
+		}
+	}()
+	return finished
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// streamBuffer — сколько итогов Stream хранит для читателя
+const streamBuffer = 1024
+
+// Stream — запуск Pipe, итоги батчей которого можно наблюдать по ходу работы
+type Stream struct {
+	results chan BatchResult
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+
+	done  chan struct{}
+	stats PipeStats
+	err   error
+}
+
+// PipeStream запускает Pipe в фоне и сразу возвращает Stream. Итог каждого
+// батча — размер, cookie, ошибки обработки и фиксации, время начала и
+// окончания — появляется в Results, когда батч зафиксирован или отброшен.
+//
+// Стадии pipeline никогда не ждут читателя: Results хранит до streamBuffer
+// непрочитанных итогов, а сверх этого новые итоги отбрасываются и
+// учитываются в Dropped. Канал закрывается сразу по завершении pipeline;
+// непрочитанные итоги остаются в нём, и брошенный Stream не держит горутин.
+func PipeStream(ctx context.Context, p Producer, c Consumer, maxItems int, opts ...Option) *Stream {
+	s := &Stream{
+		results: make(chan BatchResult, streamBuffer),
+		done:    make(chan struct{}),
+	}
+	if err := validateArgs(p, c); err != nil {
+		s.err = err
+		close(s.done)
+		s.close()
+		return s
+	}
+
+	pp := newPipe(p, c, maxItems, opts)
+	pp.tracing = newBatchTracing(&streamTracer{next: pp.opts.tracer, clock: pp.opts.clock, s: s}, pp.opts.name)
+	go func() {
+		err := pp.run(ctx)
+		s.stats = pp.stats.snapshot()
+		s.err = err
+		close(s.done)
+		s.close()
+	}()
+	return s
+}
+
+// Results возвращает канал итогов батчей. Канал закрывается после
+// завершения pipeline.
+func (s *Stream) Results() <-chan BatchResult {
+	return s.results
+}
+
+// Err ждёт завершения pipeline и возвращает его итоговую ошибку. Ожидание не
+// зависит от чтения Results.
+func (s *Stream) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Stats ждёт завершения pipeline и возвращает статистику запуска
+func (s *Stream) Stats() PipeStats {
+	<-s.done
+	return s.stats
+}
+
+// Dropped возвращает число итогов, не попавших в Results из-за того, что
+// читатель отстал больше чем на streamBuffer итогов
+func (s *Stream) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Stream) push(r BatchResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		// стадия, оставшаяся в фоне после ErrDrainTimeout
+		s.dropped++
+		return
+	}
+	select {
+	case s.results <- r:
+	default:
+		s.dropped++
+	}
+}
+
+func (s *Stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.results)
+}
+
+// streamTracer превращает span батчей в итоги для Stream, передавая их
+// дальше трейсеру пользователя, если он задан
+type streamTracer struct {
+	next  Tracer
+	clock Clock
+	s     *Stream
+}
+
+func (t *streamTracer) StartBatch(size int, cookies []int) func(err error) {
+	return t.StartNamedBatch("", size, cookies)
+}
+
+func (t *streamTracer) StartNamedBatch(pipeline string, size int, cookies []int) func(err error) {
+	var end func(err error)
+	if nt, ok := t.next.(NamedTracer); ok && pipeline != "" {
+		end = nt.StartNamedBatch(pipeline, size, cookies)
+	} else if t.next != nil {
+		end = t.next.StartBatch(size, cookies)
+	}
+	r := BatchResult{Size: size, Cookies: cookies, Started: t.clock.Now()}
+	return func(err error) {
+		if end != nil {
+			end(err)
+		}
+		r.Finished = t.clock.Now()
+		if errors.Is(err, ErrCommitFailed) {
+			r.CommitErr = err
+		} else {
+			r.ProcessErr = err
+		}
+		t.s.push(r)
+	}
+}
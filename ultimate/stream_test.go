@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeStream_MultiBatch(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5}, 2, 2, 1)
+	consumer := &pipetest.RecordingConsumer{}
+
+	stream := PipeStream(context.Background(), producer, consumer, 2)
+	var results []BatchResult
+	for r := range stream.Results() {
+		results = append(results, r)
+	}
+
+	require.NoError(t, stream.Err())
+	require.Len(t, results, 3)
+	for i, r := range results {
+		require.Equal(t, []int{i + 1}, r.Cookies)
+		require.NoError(t, r.ProcessErr)
+		require.NoError(t, r.CommitErr)
+		require.False(t, r.Finished.Before(r.Started))
+	}
+	require.Equal(t, []int{2, 2, 1}, []int{results[0].Size, results[1].Size, results[2].Size})
+	require.Equal(t, 3, stream.Stats().Batches)
+}
+
+// noCommitFeed отдаёт элементы из канала feed с cookie NoCommitCookie;
+// закрытие feed — конец данных
+type noCommitFeed struct {
+	feed chan any
+}
+
+func (p *noCommitFeed) Next() ([]any, int, error) {
+	item, ok := <-p.feed
+	if !ok {
+		return nil, 0, ErrEofCommitCookie
+	}
+	return []any{item}, NoCommitCookie, nil
+}
+
+func (p *noCommitFeed) Commit(int) error { return nil }
+
+func TestPipeStream_BatchesWithoutCookiesReportedLive(t *testing.T) {
+	producer := &noCommitFeed{feed: make(chan any)}
+	stream := PipeStream(context.Background(), producer, &pipetest.RecordingConsumer{}, 0,
+		WithNoCommitCookie(NoCommitCookie))
+	defer func() {
+		close(producer.feed)
+		require.NoError(t, stream.Err())
+	}()
+
+	// итог батча без cookie приходит, пока pipeline ещё работает
+	for _, item := range []any{"heartbeat", "metrics"} {
+		producer.feed <- item
+		select {
+		case r := <-stream.Results():
+			require.Equal(t, 1, r.Size)
+			require.Empty(t, r.Cookies)
+			require.NoError(t, r.ProcessErr)
+		case <-time.After(time.Second):
+			t.Fatalf("no live result for %q", item)
+		}
+	}
+}
+
+func TestPipeStream_ReportsErrors(t *testing.T) {
+	producer := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2}, 1, 1)
+	producer.FailOn = map[int]error{1: errors.New("commit error")}
+	consumer := &pipetest.RecordingConsumer{}
+
+	stream := PipeStream(context.Background(), producer, consumer, 1)
+	var results []BatchResult
+	for r := range stream.Results() {
+		results = append(results, r)
+	}
+
+	require.ErrorIs(t, stream.Err(), ErrCommitFailed)
+	require.NotEmpty(t, results)
+	require.Equal(t, []int{1}, results[0].Cookies)
+	require.ErrorIs(t, results[0].CommitErr, ErrCommitFailed)
+	require.NoError(t, results[0].ProcessErr)
+}
+
+func TestPipeStream_UnreadResultsDoNotBlock(t *testing.T) {
+	producer := pipetest.NewCountingProducer(ErrEofCommitCookie, 100, 1)
+
+	stream := PipeStream(context.Background(), producer, pipetest.NullConsumer{}, 1)
+	// Никто не читает Results, но pipeline доходит до конца
+	require.NoError(t, stream.Err())
+	require.Equal(t, 100, stream.Stats().Commits)
+
+	// непрочитанные итоги остаются в закрытом канале
+	results := 0
+	for range stream.Results() {
+		results++
+	}
+	require.Equal(t, 100, results)
+	require.Zero(t, stream.Dropped())
+}
+
+func TestPipeStream_AbandonedStreamLeaksNothing(t *testing.T) {
+	before := runtime.NumGoroutine()
+	total := streamBuffer + 10
+	producer := pipetest.NewCountingProducer(ErrEofCommitCookie, total, 1)
+
+	stream := PipeStream(context.Background(), producer, pipetest.NullConsumer{}, 1)
+	require.NoError(t, stream.Err())
+
+	// ни одной горутины Stream не осталось, хотя итоги никто не читал.
+	// Eventually не подходит: он сам запускает горутины.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before)
+	// очередь ограничена: лишние итоги отброшены
+	require.Equal(t, 10, stream.Dropped())
+	require.Len(t, stream.Results(), streamBuffer)
+}
+
+func TestPipeStream_InvalidArgs(t *testing.T) {
+	stream := PipeStream(context.Background(), nil, pipetest.NullConsumer{}, 1)
+	require.ErrorIs(t, stream.Err(), ErrInvalidArgument)
+	_, ok := <-stream.Results()
+	require.False(t, ok)
+}
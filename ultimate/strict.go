@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrProtocol — в режиме WithStrictProducer источник нарушил контракт
+// Producer
+var ErrProtocol = errors.New("producer protocol violation")
+
+// checkProtocol проверяет результат Next на нарушения контракта Producer:
+// элементы вместе с ошибкой, отличной от конца данных, и результат больше
+// maxItems элементов. Первое проверяется только в режиме
+// WithStrictProducer, второе — и в нём, и в WithStrictMaxItems.
+func (pp *pipe) checkProtocol(items []any, err error) error {
+	switch {
+	case pp.opts.strictProducer && err != nil && !isEOF(err) && len(items) > 0:
+		return fmt.Errorf("%w: %w: Next returned %d items with error %q", ErrNextFailed, ErrProtocol, len(items), err)
+	case pp.maxItems > 0 && len(items) > pp.maxItems:
+		if pp.opts.strictProducer {
+			return fmt.Errorf("%w: %w: %w: Next returned %d items, maxItems is %d", ErrNextFailed, ErrProtocol, ErrBatchTooLarge, len(items), pp.maxItems)
+		}
+		return fmt.Errorf("%w: %w: Next returned %d items, maxItems is %d", ErrNextFailed, ErrBatchTooLarge, len(items), pp.maxItems)
+	}
+	return nil
+}
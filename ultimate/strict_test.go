@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe_StrictProducerViolations(t *testing.T) {
+	nextErr := errors.New("broker unavailable")
+	tests := []struct {
+		name string
+		step pipetest.Step
+		want string
+	}{
+		{
+			name: "items with error",
+			step: pipetest.Step{Items: []any{1}, Cookie: 1, Err: nextErr},
+			want: "Next returned 1 items with error",
+		},
+		{
+			name: "more than maxItems",
+			step: pipetest.Step{Items: []any{1, 2, 3}, Cookie: 1},
+			want: "Next returned 3 items, maxItems is 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := pipetest.NewScriptedProducer(ErrEofCommitCookie, tt.step)
+			consumer := &pipetest.RecordingConsumer{}
+
+			err := Pipe(producer, consumer, 2, WithStrictProducer())
+			require.ErrorIs(t, err, ErrProtocol)
+			require.ErrorIs(t, err, ErrNextFailed)
+			require.ErrorContains(t, err, tt.want)
+			require.Empty(t, consumer.Items())
+			require.Empty(t, producer.Committed())
+		})
+	}
+}
+
+func TestPipe_StrictProducerAcceptsValidResults(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1, 2}, Cookie: 1},
+		pipetest.Step{Cookie: 2},
+		// последние элементы вместе с концом данных — допустимый результат
+		pipetest.Step{Items: []any{3}, Cookie: 3, Err: ErrEofCommitCookie},
+	)
+	consumer := &pipetest.RecordingConsumer{}
+
+	require.NoError(t, Pipe(producer, consumer, 2, WithStrictProducer()))
+	require.Equal(t, []any{1, 2, 3}, consumer.Items())
+	// после конца данных Next больше не вызывается
+	require.Equal(t, 3, producer.NextCalls())
+}
+
+func TestPipe_NonStrictProducerDoesNotCheck(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1, 2, 3}, Cookie: 1},
+	)
+	consumer := &pipetest.RecordingConsumer{}
+
+	require.NoError(t, Pipe(producer, consumer, 2))
+	require.Equal(t, []any{1, 2, 3}, consumer.Items())
+}
+
+func TestPipe_StrictMaxItems(t *testing.T) {
+	producer := pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1, 2}, Cookie: 1},
+		pipetest.Step{Items: []any{3, 4, 5}, Cookie: 2},
+	)
+	consumer := &pipetest.RecordingConsumer{}
+
+	err := Pipe(producer, consumer, 2, WithStrictMaxItems())
+	require.ErrorIs(t, err, ErrBatchTooLarge)
+	require.ErrorIs(t, err, ErrNextFailed)
+	require.NotErrorIs(t, err, ErrProtocol)
+	require.ErrorContains(t, err, "Next returned 3 items, maxItems is 2")
+	require.NotContains(t, consumer.Items(), 3)
+
+	// элементы вместе с ошибкой — забота WithStrictProducer, а не этого режима
+	nextErr := errors.New("broker unavailable")
+	producer = pipetest.NewScriptedProducer(ErrEofCommitCookie,
+		pipetest.Step{Items: []any{1}, Cookie: 1, Err: nextErr},
+	)
+	err = Pipe(producer, &pipetest.RecordingConsumer{}, 2, WithStrictMaxItems())
+	require.ErrorIs(t, err, nextErr)
+	require.NotErrorIs(t, err, ErrProtocol)
+}
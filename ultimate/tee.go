@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// TeeConsumer передаёт батчи потребителю и одновременно отправляет их копии
+// в канал tap — например, чтобы при отладке видеть всё, что получает
+// потребитель, не меняя его. Копия отправляется до вызова потребителя,
+// поэтому tap видит и батчи, на которых тот упал. По умолчанию, если tap
+// заполнен, копия отбрасывается, и pipeline не тормозит из-за отстающего
+// наблюдателя.
+type TeeConsumer struct {
+	// Block ждёт места в tap вместо отбрасывания копии. Ожидание прерывается
+	// отменой контекста батча.
+	Block bool
+
+	c       Consumer
+	tap     chan<- []any
+	dropped atomic.Int64
+}
+
+// NewTeeConsumer создаёт потребителя, дублирующего батчи c в tap
+func NewTeeConsumer(c Consumer, tap chan<- []any) *TeeConsumer {
+	return &TeeConsumer{c: c, tap: tap}
+}
+
+func (t *TeeConsumer) Process(items []any) error {
+	return t.ProcessCtx(context.Background(), items)
+}
+
+// ProcessCtx отправляет копию батча в tap и передаёт батч потребителю,
+// сохраняя контекст, если потребитель реализует ContextConsumer
+func (t *TeeConsumer) ProcessCtx(ctx context.Context, items []any) error {
+	// потребитель может изменить срез, поэтому в tap уходит копия
+	batch := append([]any(nil), items...)
+	if t.Block {
+		select {
+		case t.tap <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		select {
+		case t.tap <- batch:
+		default:
+			t.dropped.Add(1)
+		}
+	}
+	if cc, ok := t.c.(ContextConsumer); ok {
+		return cc.ProcessCtx(ctx, items)
+	}
+	return t.c.Process(items)
+}
+
+// Dropped возвращает число копий, отброшенных из-за заполненного tap
+func (t *TeeConsumer) Dropped() int {
+	return int(t.dropped.Load())
+}
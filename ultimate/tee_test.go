@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeeConsumer_TapReceivesCopies(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5}, 2, 2, 1)
+	sink := &pipetest.RecordingConsumer{}
+	tap := make(chan []any, 10)
+	// потребитель портит полученный срез: копия в tap не должна измениться
+	mutating := ConsumerFunc(func(items []any) error {
+		if err := sink.Process(items); err != nil {
+			return err
+		}
+		for i := range items {
+			items[i] = nil
+		}
+		return nil
+	})
+	tee := NewTeeConsumer(mutating, tap)
+
+	require.NoError(t, Pipe(source, tee, 2))
+	close(tap)
+
+	var tapped [][]any
+	for batch := range tap {
+		tapped = append(tapped, batch)
+	}
+	require.Equal(t, [][]any{{1, 2}, {3, 4}, {5}}, tapped)
+	require.Equal(t, []any{1, 2, 3, 4, 5}, sink.Items())
+	require.Zero(t, tee.Dropped())
+}
+
+func TestTeeConsumer_FullTapDoesNotBlock(t *testing.T) {
+	items := make([]any, 50)
+	for i := range items {
+		items[i] = i
+	}
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, items)
+	sink := &pipetest.RecordingConsumer{}
+	// наблюдатель ничего не читает
+	tap := make(chan []any, 1)
+	tee := NewTeeConsumer(sink, tap)
+
+	done := make(chan error, 1)
+	go func() { done <- Pipe(source, tee, 0) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline blocked on a full tap")
+	}
+	require.Equal(t, items, sink.Items())
+	require.Len(t, tap, 1)
+	require.Equal(t, tee.Dropped(), len(sink.Batches())-1)
+}
+
+func TestTeeConsumer_Block(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3}, 1, 1, 1)
+	tap := make(chan []any)
+	tee := NewTeeConsumer(&pipetest.RecordingConsumer{}, tap)
+	tee.Block = true
+
+	done := make(chan error, 1)
+	go func() { done <- Pipe(source, tee, 0) }()
+	// без чтения из tap pipeline стоит, и ни одна копия не теряется
+	for want := 1; want <= 3; want++ {
+		require.Equal(t, []any{want}, <-tap)
+	}
+	require.NoError(t, <-done)
+	require.Zero(t, tee.Dropped())
+}
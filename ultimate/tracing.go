@@ -0,0 +1,178 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// Tracer открывает span на каждый батч. StartBatch вызывается при отправке
+// батча в обработку и возвращает функцию завершения span: она вызывается
+// ровно один раз — с nil после фиксации всех cookie батча или с ошибкой,
+// из-за которой батч не был обработан или зафиксирован.
+//
+// Интерфейс намеренно не зависит от OpenTelemetry: адаптер находится в
+// пакете oteltrace.
+type Tracer interface {
+	StartBatch(size int, cookies []int) (end func(err error))
+}
+
+// NamedTracer — трейсер, которому нужно имя pipeline из WithName. Если
+// трейсер реализует этот интерфейс и имя задано, вместо StartBatch
+// вызывается StartNamedBatch.
+type NamedTracer interface {
+	StartNamedBatch(pipeline string, size int, cookies []int) (end func(err error))
+}
+
+// tracedBatch — открытый span батча
+type tracedBatch struct {
+	end     func(err error)
+	pending []int // ещё не зафиксированные cookie батча
+	high    int   // максимальный cookie батча
+}
+
+// batchTracing отслеживает открытые span. Фиксируемый cookie относится к
+// самому старому открытому батчу, который его содержит: при FIFO это всегда
+// голова очереди, при LIFO — не обязательно.
+type batchTracing struct {
+	tracer Tracer
+	name   string
+
+	mu   sync.Mutex
+	open []*tracedBatch
+	done bool
+}
+
+func newBatchTracing(tracer Tracer, name string) *batchTracing {
+	if tracer == nil {
+		return nil
+	}
+	return &batchTracing{tracer: tracer, name: name}
+}
+
+// startSpan открывает span у трейсера, передавая имя pipeline, если трейсер
+// его принимает
+func (t *batchTracing) startSpan(size int, cookies []int) func(err error) {
+	if nt, ok := t.tracer.(NamedTracer); ok && t.name != "" {
+		return nt.StartNamedBatch(t.name, size, cookies)
+	}
+	return t.tracer.StartBatch(size, cookies)
+}
+
+// start открывает span для батча
+func (t *batchTracing) start(b batch) *tracedBatch {
+	if t == nil {
+		return nil
+	}
+	span := &tracedBatch{
+		end:     t.startSpan(len(b.buf), b.cookies),
+		pending: slices.Clone(b.cookies),
+	}
+	if len(b.cookies) > 0 {
+		span.high = slices.Max(b.cookies)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open = append(t.open, span)
+	return span
+}
+
+// fail закрывает span батча с ошибкой
+func (t *batchTracing) fail(span *tracedBatch, err error) {
+	if t == nil || span == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, s := range t.open {
+		if s == span {
+			t.open = append(t.open[:i], t.open[i+1:]...)
+			t.endLocked(span, err)
+			return
+		}
+	}
+}
+
+// committed отмечает фиксацию cookie
+func (t *batchTracing) committed(cookie int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i, j, ok := t.findLocked(cookie)
+	if !ok {
+		return
+	}
+	span := t.open[i]
+	span.pending = slices.Delete(span.pending, j, j+1)
+	if len(span.pending) == 0 {
+		t.open = slices.Delete(t.open, i, i+1)
+		t.endLocked(span, nil)
+	}
+}
+
+// findLocked ищет самый старый открытый батч с незафиксированным cookie и
+// возвращает индексы батча и cookie в нём
+func (t *batchTracing) findLocked(cookie int) (int, int, bool) {
+	for i, span := range t.open {
+		if j := slices.Index(span.pending, cookie); j >= 0 {
+			return i, j, true
+		}
+	}
+	return 0, 0, false
+}
+
+// committedThrough отмечает фиксацию смещения cookie: закрываются все
+// самые старые батчи, которые оно подтверждает
+func (t *batchTracing) committedThrough(cookie int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.open) > 0 && t.open[0].high <= cookie {
+		head := t.open[0]
+		t.open = t.open[1:]
+		t.endLocked(head, nil)
+	}
+}
+
+// commitFailed закрывает span батча, чей cookie не удалось зафиксировать
+func (t *batchTracing) commitFailed(cookie int, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i, _, ok := t.findLocked(cookie)
+	if !ok {
+		if len(t.open) == 0 {
+			return
+		}
+		i = 0
+	}
+	span := t.open[i]
+	t.open = slices.Delete(t.open, i, i+1)
+	t.endLocked(span, err)
+}
+
+// finish закрывает все оставшиеся span итоговой ошибкой запуска. Стадии,
+// брошенные по drainTimeout, после этого span уже не трогают.
+func (t *batchTracing) finish(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, span := range t.open {
+		t.endLocked(span, err)
+	}
+	t.open = nil
+	t.done = true
+}
+
+func (t *batchTracing) endLocked(span *tracedBatch, err error) {
+	if !t.done {
+		span.end(err)
+	}
+}
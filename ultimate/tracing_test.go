@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSpan — записанный span батча
+type fakeSpan struct {
+	size    int
+	cookies []int
+	ended   int
+	err     error
+}
+
+// fakeTracer запоминает все открытые span
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) StartBatch(size int, cookies []int) func(error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &fakeSpan{size: size, cookies: append([]int(nil), cookies...)}
+	t.spans = append(t.spans, span)
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		span.ended++
+		span.err = err
+	}
+}
+
+func TestPipe_TracerSpansPerBatch(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	tracer := &fakeTracer{}
+
+	producer.On("Next").Return([]any{1, 2}, 1, nil).Once()
+	producer.On("Next").Return([]any{3}, 2, nil).Once()
+	producer.On("Next").Return([]any{4}, 3, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(nil)
+	producer.On("Commit", mock.Anything).Return(nil)
+
+	err := Pipe(producer, consumer, 3, WithTracer(tracer))
+	require.NoError(t, err)
+
+	require.Len(t, tracer.spans, 2)
+	require.Equal(t, 3, tracer.spans[0].size)
+	require.Equal(t, []int{1, 2}, tracer.spans[0].cookies)
+	require.Equal(t, 1, tracer.spans[1].size)
+	require.Equal(t, []int{3}, tracer.spans[1].cookies)
+	for _, span := range tracer.spans {
+		require.Equal(t, 1, span.ended)
+		require.NoError(t, span.err)
+	}
+}
+
+func TestPipe_TracerRecordsErrors(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	tracer := &fakeTracer{}
+	processErr := errors.New("process failed")
+
+	producer.On("Next").Return([]any{1}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(processErr)
+
+	err := Pipe(producer, consumer, 1, WithTracer(tracer))
+	require.ErrorIs(t, err, processErr)
+
+	require.Len(t, tracer.spans, 1)
+	require.Equal(t, 1, tracer.spans[0].ended)
+	require.ErrorIs(t, tracer.spans[0].err, ErrProcessFailed)
+	require.ErrorIs(t, tracer.spans[0].err, processErr)
+}
+
+func TestPipe_TracerCommitError(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	tracer := &fakeTracer{}
+	commitErr := errors.New("commit failed")
+
+	producer.On("Next").Return([]any{1}, 1, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(nil)
+	producer.On("Commit", 1).Return(commitErr)
+
+	err := Pipe(producer, consumer, 1, WithTracer(tracer))
+	require.ErrorIs(t, err, commitErr)
+
+	require.Len(t, tracer.spans, 1)
+	require.Equal(t, 1, tracer.spans[0].ended)
+	require.ErrorIs(t, tracer.spans[0].err, ErrCommitFailed)
+}
+
+func TestPipe_TracerOffsetCommit(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	tracer := &fakeTracer{}
+
+	producer.On("Next").Return([]any{1}, 1, nil).Once()
+	producer.On("Next").Return([]any{2}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(nil)
+	producer.On("Commit", mock.Anything).Return(nil)
+
+	err := Pipe(producer, consumer, 2, WithTracer(tracer), WithOffsetCommitMode())
+	require.NoError(t, err)
+
+	require.Len(t, tracer.spans, 1)
+	require.Equal(t, 1, tracer.spans[0].ended)
+	require.NoError(t, tracer.spans[0].err)
+}
+
+// namedTracer записывает имена pipeline, переданные в StartNamedBatch
+type namedTracer struct {
+	fakeTracer
+	names []string
+}
+
+func (t *namedTracer) StartNamedBatch(pipeline string, size int, cookies []int) func(error) {
+	t.mu.Lock()
+	t.names = append(t.names, pipeline)
+	t.mu.Unlock()
+	return t.StartBatch(size, cookies)
+}
+
+func TestPipe_TracerReceivesPipelineName(t *testing.T) {
+	producer := &MockProducer{}
+	consumer := &MockConsumer{}
+	tracer := &namedTracer{}
+
+	producer.On("Next").Return([]any{1}, 1, nil).Once()
+	producer.On("Next").Return([]any{2}, 2, nil).Once()
+	producer.On("Next").Return([]any{}, 0, ErrEofCommitCookie).Once()
+	consumer.On("Process", mock.Anything).Return(nil)
+	producer.On("Commit", mock.Anything).Return(nil)
+
+	err := Pipe(producer, consumer, 1, WithTracer(tracer), WithName("orders"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"orders", "orders"}, tracer.names)
+	require.Len(t, tracer.spans, 2)
+}
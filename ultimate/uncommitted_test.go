@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmirShimshir/buffered-reader-writer/pipetest"
+	"github.com/stretchr/testify/require"
+)
+
+// permitCommitter выполняет каждый Commit только по разрешению из permits;
+// закрытие permits снимает ограничение
+type permitCommitter struct {
+	*pipetest.ScriptedProducer
+	permits chan struct{}
+}
+
+func (p *permitCommitter) Commit(cookie int) error {
+	<-p.permits
+	return p.ScriptedProducer.Commit(cookie)
+}
+
+func TestPipe_MaxUncommittedBlocksProcess(t *testing.T) {
+	var steps []pipetest.Step
+	for i := 1; i <= 10; i++ {
+		steps = append(steps, pipetest.Step{Items: []any{i}, Cookie: i})
+	}
+	scripted := pipetest.NewScriptedProducer(ErrEofCommitCookie, steps...)
+	producer := &permitCommitter{ScriptedProducer: scripted, permits: make(chan struct{})}
+	var processed atomic.Int32
+	consumer := ConsumerFunc(func([]any) error {
+		processed.Add(1)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- Pipe(producer, consumer, 1, WithMaxUncommitted(2)) }()
+
+	// два обработанных cookie ждут фиксации, третий батч не обрабатывается
+	require.Eventually(t, func() bool { return processed.Load() == 2 }, time.Second, time.Millisecond)
+	require.Never(t, func() bool { return processed.Load() > 2 }, 50*time.Millisecond, 5*time.Millisecond)
+	require.Empty(t, scripted.Committed())
+
+	// одна фиксация освобождает место ровно для одного батча
+	producer.permits <- struct{}{}
+	require.Eventually(t, func() bool { return processed.Load() == 3 }, time.Second, time.Millisecond)
+	require.Never(t, func() bool { return processed.Load() > 3 }, 50*time.Millisecond, 5*time.Millisecond)
+	require.Equal(t, []int{1}, scripted.Committed())
+
+	close(producer.permits)
+	require.NoError(t, <-done)
+	require.EqualValues(t, 10, processed.Load())
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, scripted.Committed())
+}
+
+func TestPipe_MaxUncommittedDebouncedOffsets(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6}, 1, 1, 1, 1, 1, 1)
+	sink := &pipetest.RecordingConsumer{}
+
+	// свёрнутые в одно смещение cookie тоже освобождают слоты
+	err := Pipe(source, sink, 1, WithMaxUncommitted(2), WithOffsetCommitMode(), WithCommitDebounce(time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, []any{1, 2, 3, 4, 5, 6}, sink.Items())
+	require.Equal(t, 6, slices.Max(source.Committed()))
+}
+
+func TestPipe_MaxUncommittedReleasesFilteredCookies(t *testing.T) {
+	source := pipetest.NewMemorySource(ErrEofCommitCookie, []any{1, 2, 3, 4, 5, 6}, 1, 1, 1, 1, 1, 1)
+	sink := &pipetest.RecordingConsumer{}
+	evens := WithTransform(func(items []any) ([]any, error) {
+		var kept []any
+		for _, item := range items {
+			if item.(int)%2 == 0 {
+				kept = append(kept, item)
+			}
+		}
+		return kept, nil
+	})
+	var filtered []int
+
+	// cookie отфильтрованных батчей не фиксируются и не должны держать слот
+	err := Pipe(source, sink, 1, WithMaxUncommitted(1), evens,
+		WithOnFilteredCookies(func(cookies []int) { filtered = append(filtered, cookies...) }, false))
+	require.NoError(t, err)
+	require.Equal(t, []any{2, 4, 6}, sink.Items())
+	require.Equal(t, []int{1, 3, 5}, filtered)
+	require.Equal(t, []int{2, 4, 6}, source.Committed())
+}